@@ -1,15 +1,42 @@
 package main
 
 import (
+	"encoding/json"
+	"flag"
 	"fmt"
 	internal "foc_api/internal"
+	"io"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 var PORT string = os.Getenv("PORT")
 
+// minimum gap in minutes a performer needs between two performances
+var CHANGEOVER_BUFFER_MINUTES string = os.Getenv("CHANGEOVER_BUFFER_MINUTES")
+
+// api key that is always accepted as an admin, used to create the first real users
+var ADMIN_API_KEY string = os.Getenv("ADMIN_API_KEY")
+
+// smtp server (host:port) used to email performers their login codes. when unset, emails are
+// written to MAIL_OUTBOX_DIR instead
+var SMTP_ADDR string = os.Getenv("SMTP_ADDR")
+var SMTP_USERNAME string = os.Getenv("SMTP_USERNAME")
+var SMTP_PASSWORD string = os.Getenv("SMTP_PASSWORD")
+var MAIL_FROM string = os.Getenv("MAIL_FROM")
+var MAIL_OUTBOX_DIR string = os.Getenv("MAIL_OUTBOX_DIR")
+
+// festival dates (RFC3339) that performances have to be scheduled between
+var FESTIVAL_START string = os.Getenv("FESTIVAL_START")
+var FESTIVAL_END string = os.Getenv("FESTIVAL_END")
+
+// comma separated genres performances are allowed to have. any genre is allowed when unset
+var ALLOWED_GENRES string = os.Getenv("ALLOWED_GENRES")
+
 func main() {
 	db, err := internal.InitDB("database/db.sqlite")
 	if err != nil {
@@ -18,8 +45,49 @@ func main() {
 	defer db.Close()
 
 	wrapper := internal.CreateDBWrapper(db)
+	if CHANGEOVER_BUFFER_MINUTES != "" {
+		minutes, err := strconv.Atoi(CHANGEOVER_BUFFER_MINUTES)
+		if err != nil {
+			log.Fatalf("Invalid CHANGEOVER_BUFFER_MINUTES: %v", err)
+		}
+		wrapper.SetChangeoverBuffer(time.Duration(minutes) * time.Minute)
+	}
+
+	rules, err := validationRules()
+	if err != nil {
+		log.Fatalf("Invalid validation settings: %v", err)
+	}
+	wrapper.SetValidationRules(rules)
+
+	// `foc_api import ...` runs a bulk import instead of starting the server
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		code := runImport(wrapper.WithActor("cli:import"), os.Args[2:])
+		// os.Exit skips deferred calls, so close the db ourselves
+		db.Close()
+		os.Exit(code)
+	}
+
+	if ADMIN_API_KEY != "" {
+		err = wrapper.EnsureAdminKey(ADMIN_API_KEY)
+		if err != nil {
+			log.Fatalf("Invalid ADMIN_API_KEY: %v", err)
+		}
+	}
+
 	api := internal.NewAPI(wrapper)
 
+	if MAIL_FROM == "" {
+		MAIL_FROM = "foc-api@localhost"
+	}
+	if SMTP_ADDR != "" {
+		api.SetMailer(&internal.SMTPMailer{Addr: SMTP_ADDR, From: MAIL_FROM, Username: SMTP_USERNAME, Password: SMTP_PASSWORD})
+	} else {
+		if MAIL_OUTBOX_DIR == "" {
+			MAIL_OUTBOX_DIR = "database/outbox"
+		}
+		api.SetMailer(&internal.OutboxMailer{Dir: MAIL_OUTBOX_DIR, From: MAIL_FROM})
+	}
+
 	if PORT == "" {
 		PORT = "8000"
 	}
@@ -29,6 +97,7 @@ func main() {
 
 	mux.HandleFunc("/performances", api.PerformanceHandler)
 	mux.HandleFunc("/performances/", api.PerformanceHandler)
+	mux.HandleFunc("/performances.ics", api.CalendarHandler)
 
 	mux.HandleFunc("/performers", api.PerformerHandler)
 	mux.HandleFunc("/performers/", api.PerformerHandler)
@@ -39,10 +108,119 @@ func main() {
 	mux.HandleFunc("/junctions", api.JunctionHandler)
 	mux.HandleFunc("/junctions/", api.JunctionHandler)
 
+	mux.HandleFunc("/conflicts", api.ConflictHandler)
+	mux.HandleFunc("/schedule/", api.ScheduleHandler)
+
+	mux.HandleFunc("/now", api.NowHandler)
+	mux.HandleFunc("/events", api.EventsHandler)
+	mux.HandleFunc("/reports/", api.ReportHandler)
+
+	mux.HandleFunc("/editions", api.EditionHandler)
+	mux.HandleFunc("/editions/", api.EditionHandler)
+
+	mux.HandleFunc("/groups", api.GroupHandler)
+	mux.HandleFunc("/groups/", api.GroupHandler)
+	mux.HandleFunc("/genres", api.GenreHandler)
+	mux.HandleFunc("/genres/", api.GenreHandler)
+	mux.HandleFunc("/locations", api.LocationHandler)
+	mux.HandleFunc("/locations/", api.LocationHandler)
+
+	mux.HandleFunc("/search", api.SearchHandler)
+
+	mux.HandleFunc("/import", api.ImportHandler)
+
+	mux.HandleFunc("/users", api.UserHandler)
+	mux.HandleFunc("/users/", api.UserHandler)
+
+	mux.HandleFunc("/me", api.MeHandler)
+	mux.HandleFunc("/me/", api.MeHandler)
+
+	mux.HandleFunc("/audit", api.AuditHandler)
+
+	mux.HandleFunc("/export", api.ExportHandler)
+	mux.HandleFunc("/restore", api.RestoreHandler)
+
 	fmt.Printf("Listening on port %s\n", PORT)
-	log.Fatal(http.ListenAndServe(":"+PORT, mux))
+	// every request is checked against the route policies before reaching the mux
+	log.Fatal(http.ListenAndServe(":"+PORT, api.AuthMiddleware(mux)))
+}
+
+// reads the festival dates and allowed genres from the environment
+func validationRules() (internal.ValidationRules, error) {
+	rules := internal.ValidationRules{}
+
+	var err error
+	if FESTIVAL_START != "" {
+		rules.FestivalStart, err = time.Parse(time.RFC3339, FESTIVAL_START)
+		if err != nil {
+			return rules, fmt.Errorf("FESTIVAL_START: %v", err)
+		}
+	}
+	if FESTIVAL_END != "" {
+		rules.FestivalEnd, err = time.Parse(time.RFC3339, FESTIVAL_END)
+		if err != nil {
+			return rules, fmt.Errorf("FESTIVAL_END: %v", err)
+		}
+	}
+	if !rules.FestivalStart.IsZero() && !rules.FestivalEnd.IsZero() && !rules.FestivalEnd.After(rules.FestivalStart) {
+		return rules, fmt.Errorf("FESTIVAL_END must be after FESTIVAL_START")
+	}
+
+	for _, genre := range strings.Split(ALLOWED_GENRES, ",") {
+		if genre = strings.TrimSpace(genre); genre != "" {
+			rules.AllowedGenres = append(rules.AllowedGenres, genre)
+		}
+	}
+	return rules, nil
 }
 
 func testRequest(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "Welcome to the FOC REST API! request path: %s", r.URL.RawPath)
 }
+
+// imports the csv files named on the command line, printing the report. returns the exit code
+func runImport(wrapper *internal.DBWrapper, args []string) int {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	performersPath := flags.String("performers", "", "csv of performers (name, email)")
+	performancesPath := flags.String("performances", "", "csv of performances (itemName, genreName, groupName, location, startTime, endTime)")
+	junctionsPath := flags.String("junctions", "", "csv of assignments (email or performerId, itemName or performanceId)")
+	dryRun := flags.Bool("dry-run", false, "validate the files without saving anything")
+	flags.Parse(args)
+
+	files := internal.ImportFiles{}
+	targets := []struct {
+		path   string
+		target *io.Reader
+	}{
+		{*performersPath, &files.Performers},
+		{*performancesPath, &files.Performances},
+		{*junctionsPath, &files.Junctions},
+	}
+	for _, t := range targets {
+		if t.path == "" {
+			continue
+		}
+		file, err := os.Open(t.path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to open %s: %v\n", t.path, err)
+			return 1
+		}
+		defer file.Close()
+		*t.target = file
+	}
+
+	report, err := wrapper.Import(files, *dryRun)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Import failed: %v\n", err)
+		return 1
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
+
+	if len(report.Errors) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,453 @@
+package internal
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const (
+	auditActionRestore = "restore"
+	auditActionPurge   = "purge"
+)
+
+// limits a list to archived rows with ?deleted=only, or includes them with ?deleted=include.
+// archived rows are left out by default
+func (q *listQuery) filterDeleted(params url.Values, column string) error {
+	switch params.Get("deleted") {
+	case "", "exclude":
+		q.where(column + " = 0")
+	case "only":
+		q.where(column + " = 1")
+	case "include":
+	default:
+		return queryErrorf("deleted must be exclude, include or only")
+	}
+	return nil
+}
+
+// Return the performance with the given id whether or not it has been deleted
+func (dbw *DBWrapper) getPerformanceRecord(id int) (*ExportedPerformance, error) {
+	dbQuery := `
+		SELECT ` + performanceColumns + `, p.deleted
+		FROM performances AS p
+		WHERE p.id = ?
+	`
+
+	p := &ExportedPerformance{}
+	err := dbw.db.QueryRow(dbQuery, id).
+		Scan(&p.Id, &p.ItemName, &p.GenreName, &p.GenreId, &p.GroupName, &p.GroupId, &p.Location, &p.LocationId, &p.EditionId, &p.StartTime, &p.EndTime, &p.Duration, &p.PlannedStartTime, &p.PlannedEndTime, &p.ActualStartTime, &p.ActualEndTime, &p.Version, &p.Deleted)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Return the performer with the given id whether or not they have been deleted
+func (dbw *DBWrapper) getPerformerRecord(id int) (*ExportedPerformer, error) {
+	dbQuery := `
+		SELECT ` + performerColumns + `, p.deleted
+		FROM performers AS p
+		WHERE p.id = ?
+	`
+
+	p := &ExportedPerformer{}
+	err := dbw.db.QueryRow(dbQuery, id).
+		Scan(&p.Id, &p.Name, &p.Email, &p.Version, &p.Deleted)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Brings back the deleted performance with the given id. returns sql.ErrNoRows if there's no
+// deleted performance with that id
+func (dbw *DBWrapper) RestorePerformanceById(id int) error {
+	return dbw.restorePerformanceById(id, false)
+}
+
+// Brings back the deleted performance even if it now clashes with another performance at the same location
+func (dbw *DBWrapper) ForceRestorePerformanceById(id int) error {
+	return dbw.restorePerformanceById(id, true)
+}
+
+func (dbw *DBWrapper) restorePerformanceById(id int, force bool) error {
+	return dbw.InTransaction(func(tx *DBWrapper) error {
+		record, err := tx.getPerformanceRecord(id)
+		if err != nil {
+			return err
+		}
+		if record == nil || !record.Deleted {
+			return sql.ErrNoRows
+		}
+		p := &record.Performance
+
+		// the location may have been deleted or renamed while the performance was archived. if
+		// it's gone, the performance is booked into a location by its name again
+		err = tx.resolveLocation(p)
+		if errors.Is(err, ErrUnknownLocation) {
+			p.LocationId = 0
+			err = tx.resolveLocation(p)
+		}
+		if err != nil {
+			return err
+		}
+		// so may its genre, in which case it's filed by its genre name again
+		err = tx.resolveGenre(p)
+		if errors.Is(err, ErrUnknownGenre) {
+			p.GenreId = 0
+			err = tx.resolveGenre(p)
+		}
+		if err != nil {
+			return err
+		}
+		err = tx.resolveGroup(p)
+		if errors.Is(err, ErrUnknownGroup) {
+			p.GroupId = 0
+			err = tx.resolveGroup(p)
+		}
+		if err != nil {
+			return err
+		}
+		err = tx.resolveEdition(p, 0)
+		if err != nil {
+			return err
+		}
+
+		// the slot may have been given to something else in the meantime
+		if !force {
+			err = tx.checkLocationClashes(p)
+			if err != nil {
+				return err
+			}
+		}
+		err = tx.checkPerformanceConflicts(id, p)
+		if err != nil {
+			return err
+		}
+
+		dbQuery := `
+			UPDATE performances
+			SET deleted = 0, location = ?, locationId = ?, genreName = ?, genreId = ?, groupName = ?, groupId = ?, version = version + 1
+			WHERE id = ?
+		`
+		_, err = tx.db.Exec(dbQuery, p.Location, nullableId(p.LocationId), p.GenreName, nullableId(p.GenreId), p.GroupName, nullableId(p.GroupId), id)
+		if err != nil {
+			return err
+		}
+		p.Version++
+
+		err = tx.reindexPerformance(id)
+		if err != nil {
+			return err
+		}
+		err = tx.audit(auditEntityPerformance, strconv.Itoa(id), auditActionRestore, nil, p)
+		if err != nil {
+			return err
+		}
+
+		// and the group's members may have changed too
+		return tx.syncGroupJunctions(id)
+	})
+}
+
+// Brings back the deleted performer with the given id. returns sql.ErrNoRows if there's no
+// deleted performer with that id
+func (dbw *DBWrapper) RestorePerformerById(id int) error {
+	return dbw.restorePerformerById(id, false)
+}
+
+// Brings back the deleted performer even if their performances now overlap
+func (dbw *DBWrapper) ForceRestorePerformerById(id int) error {
+	return dbw.restorePerformerById(id, true)
+}
+
+func (dbw *DBWrapper) restorePerformerById(id int, force bool) error {
+	return dbw.InTransaction(func(tx *DBWrapper) error {
+		record, err := tx.getPerformerRecord(id)
+		if err != nil {
+			return err
+		}
+		if record == nil || !record.Deleted {
+			return sql.ErrNoRows
+		}
+
+		// their performances may have been moved into each other while they were archived
+		if !force {
+			conflicts, err := tx.getConflictsForPerformers([]int{id})
+			if err != nil {
+				return err
+			}
+			if len(conflicts) > 0 {
+				return &ConflictError{Conflicts: conflicts}
+			}
+		}
+
+		_, err = tx.db.Exec(`UPDATE performers SET deleted = 0, version = version + 1 WHERE id = ?`, id)
+		if err != nil {
+			return err
+		}
+		record.Version++
+
+		err = tx.reindexPerformer(id)
+		if err != nil {
+			return err
+		}
+		err = tx.audit(auditEntityPerformer, strconv.Itoa(id), auditActionRestore, nil, &record.Performer)
+		if err != nil {
+			return err
+		}
+
+		// they're still in their groups, so book them into anything the groups took on meanwhile
+		return tx.syncPerformerGroups(id, force)
+	})
+}
+
+// re-syncs the performances of every group the performer is in. returns a ConflictError if
+// they'd be double-booked, unless forced, in which case those bookings are skipped. clashes
+// for other members were already there and are left for the group's next edit
+func (dbw *DBWrapper) syncPerformerGroups(performerId int, force bool) error {
+	rows, err := dbw.db.Query(`SELECT groupId FROM group_members WHERE performerId = ? ORDER BY groupId ASC`, performerId)
+	if err != nil {
+		return err
+	}
+	groupIds := []int{}
+	for rows.Next() {
+		var groupId int
+		err := rows.Scan(&groupId)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		groupIds = append(groupIds, groupId)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	conflicts := []*Conflict{}
+	for _, groupId := range groupIds {
+		err := dbw.syncGroupPerformances(groupId)
+		var conflictErr *ConflictError
+		if errors.As(err, &conflictErr) {
+			for _, c := range conflictErr.Conflicts {
+				if c.PerformerId == performerId {
+					conflicts = append(conflicts, c)
+				}
+			}
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if len(conflicts) > 0 && !force {
+		return &ConflictError{Conflicts: conflicts}
+	}
+	return nil
+}
+
+// removes every junction row matching column = id, recording each one in the audit log
+func (dbw *DBWrapper) purgeJunctions(column string, id int) error {
+	junctions, err := dbw.getJunctions(column, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = dbw.db.Exec(`DELETE FROM junction WHERE `+column+` = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	for _, j := range junctions {
+		err = dbw.audit(auditEntityJunction, junctionAuditId(j.PerformerId, j.PerformanceId), auditActionDelete, j, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Permanently deletes the performance with the given id, deleted or not, along with its junctions
+// and tech rider. returns sql.ErrNoRows if there's no such performance
+func (dbw *DBWrapper) PurgePerformanceById(id int) error {
+	return dbw.InTransaction(func(tx *DBWrapper) error {
+		record, err := tx.getPerformanceRecord(id)
+		if err != nil {
+			return err
+		}
+		if record == nil {
+			return sql.ErrNoRows
+		}
+
+		err = tx.purgeJunctions("performance_id", id)
+		if err != nil {
+			return err
+		}
+		err = tx.DeleteRider(id)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.db.Exec(`DELETE FROM performances WHERE id = ?`, id)
+		if err != nil {
+			return err
+		}
+
+		err = tx.reindexPerformance(id)
+		if err != nil {
+			return err
+		}
+		return tx.audit(auditEntityPerformance, strconv.Itoa(id), auditActionPurge, record, nil)
+	})
+}
+
+// Permanently deletes the performer with the given id, deleted or not, along with their junctions
+// and logins. returns sql.ErrNoRows if there's no such performer
+func (dbw *DBWrapper) PurgePerformerById(id int) error {
+	return dbw.InTransaction(func(tx *DBWrapper) error {
+		record, err := tx.getPerformerRecord(id)
+		if err != nil {
+			return err
+		}
+		if record == nil {
+			return sql.ErrNoRows
+		}
+
+		err = tx.purgeJunctions("performer_id", id)
+		if err != nil {
+			return err
+		}
+
+		for _, table := range []string{"performer_login_codes", "performer_sessions", "group_members"} {
+			_, err = tx.db.Exec(`DELETE FROM `+table+` WHERE performerId = ?`, id)
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.db.Exec(`DELETE FROM performers WHERE id = ?`, id)
+		if err != nil {
+			return err
+		}
+
+		err = tx.reindexPerformer(id)
+		if err != nil {
+			return err
+		}
+		return tx.audit(auditEntityPerformer, strconv.Itoa(id), auditActionPurge, record, nil)
+	})
+}
+
+// reports whether the request asked for a hard delete with ?purge=true
+func isPurge(r *http.Request) bool {
+	return queryFlag(r, "purge")
+}
+
+// POST /performances/:id/restore - brings back a deleted performance. ?force=true restores it
+// even if its slot has since been given to something else at the same location
+func (api *API) RestorePerformance(w http.ResponseWriter, r *http.Request) {
+	id, err := api.extractId(r.URL.Path)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid ID provided")
+		return
+	}
+
+	if isForced(r) {
+		err = api.wrapperFor(r).ForceRestorePerformanceById(id)
+	} else {
+		err = api.wrapperFor(r).RestorePerformanceById(id)
+	}
+	if api.respondIfInvalid(w, err) || api.respondIfConflict(w, err) || api.respondIfLocationClash(w, err) {
+		return
+	}
+	if err == sql.ErrNoRows {
+		api.respondError(w, http.StatusNotFound, "Deleted Performance Not Found")
+		return
+	}
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Error restoring performance")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// POST /performers/:id/restore - brings back a deleted performer, unless their performances now
+// overlap and ?force=true isn't passed
+func (api *API) RestorePerformer(w http.ResponseWriter, r *http.Request) {
+	id, err := api.extractId(r.URL.Path)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid ID provided")
+		return
+	}
+
+	if isForced(r) {
+		err = api.wrapperFor(r).ForceRestorePerformerById(id)
+	} else {
+		err = api.wrapperFor(r).RestorePerformerById(id)
+	}
+	if api.respondIfConflict(w, err) {
+		return
+	}
+	if err == sql.ErrNoRows {
+		api.respondError(w, http.StatusNotFound, "Deleted Performer Not Found")
+		return
+	}
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Error restoring performer")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// DELETE /performances/:id?purge=true - permanently deletes the performance with the specified id
+func (api *API) PurgePerformance(w http.ResponseWriter, r *http.Request) {
+	id, err := api.extractId(r.URL.Path)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid ID provided")
+		return
+	}
+
+	err = api.wrapperFor(r).PurgePerformanceById(id)
+	if err == sql.ErrNoRows {
+		api.respondError(w, http.StatusNotFound, "Performance Not Found")
+		return
+	}
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Error purging performance")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// DELETE /performers/:id?purge=true - permanently deletes the performer with the specified id
+func (api *API) PurgePerformer(w http.ResponseWriter, r *http.Request) {
+	id, err := api.extractId(r.URL.Path)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid ID provided")
+		return
+	}
+
+	err = api.wrapperFor(r).PurgePerformerById(id)
+	if err == sql.ErrNoRows {
+		api.respondError(w, http.StatusNotFound, "Performer Not Found")
+		return
+	}
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Error purging performer")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
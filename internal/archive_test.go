@@ -0,0 +1,253 @@
+package internal_test
+
+import (
+	"database/sql"
+	internal "foc_api/internal"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListPerformancesDeletedFilter(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	start := time.Date(2025, 9, 1, 18, 0, 0, 0, time.UTC)
+	kept := createTestPerformance(t, dbw, "Kept", "Kept Stage", start, time.Hour)
+	archived := createTestPerformance(t, dbw, "Archived", "Archived Stage", start, time.Hour)
+	require.NoError(t, dbw.DeletePerformanceById(archived.Id))
+
+	// act
+	defaultList, _, err := dbw.ListPerformances(url.Values{})
+	require.NoError(t, err, "ListPerformances() failed: %v", err)
+	onlyDeleted, _, err := dbw.ListPerformances(url.Values{"deleted": {"only"}})
+	require.NoError(t, err, "ListPerformances() failed: %v", err)
+	everything, _, err := dbw.ListPerformances(url.Values{"deleted": {"include"}})
+	require.NoError(t, err, "ListPerformances() failed: %v", err)
+	_, _, invalidErr := dbw.ListPerformances(url.Values{"deleted": {"sometimes"}})
+
+	// assert
+	require.Len(t, defaultList, 1, "Archived performances should be hidden by default")
+	assert.Equal(t, kept.Id, defaultList[0].Id)
+	require.Len(t, onlyDeleted, 1, "Expected only the archived performance")
+	assert.Equal(t, archived.Id, onlyDeleted[0].Id)
+	assert.Len(t, everything, 2, "Expected both performances")
+	var queryErr *internal.QueryError
+	assert.ErrorAs(t, invalidErr, &queryErr, "Invalid deleted value was accepted")
+}
+
+func TestRestorePerformance(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	performance, err := dbw.CreatePerformance(getTestPerformance())
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+	require.NoError(t, dbw.DeletePerformanceById(performance.Id))
+
+	// act
+	err = dbw.RestorePerformanceById(performance.Id)
+	againErr := dbw.RestorePerformanceById(performance.Id)
+
+	// assert
+	require.NoError(t, err, "RestorePerformanceById() failed: %v", err)
+	assert.Equal(t, sql.ErrNoRows, againErr, "Restoring a performance that isn't deleted should fail")
+
+	restored, err := dbw.GetPerformanceById(performance.Id)
+	require.NoError(t, err, "GetPerformanceById() failed: %v", err)
+	require.NotNil(t, restored, "Performance was not restored")
+	assert.Equal(t, performance.ItemName, restored.ItemName)
+
+	results, err := dbw.Search(performance.ItemName, "performance", 10)
+	require.NoError(t, err, "Search() failed: %v", err)
+	assert.Len(t, results, 1, "Restored performance was not searchable")
+}
+
+func TestRestorePerformanceRejectsTakenSlot(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	start := time.Date(2025, 9, 1, 18, 0, 0, 0, time.UTC)
+	archived := createTestPerformance(t, dbw, "Archived", "Archived Stage", start, time.Hour)
+	require.NoError(t, dbw.DeletePerformanceById(archived.Id))
+
+	// something else takes the slot while the first performance is archived
+	replacement := getTestPerformance()
+	replacement.ItemName = "Replacement"
+	replacement.Location = archived.Location
+	replacement.StartTime = start
+	replacement.EndTime = start.Add(time.Hour)
+	_, err := dbw.CreatePerformance(replacement)
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+
+	// act
+	err = dbw.RestorePerformanceById(archived.Id)
+	forceErr := dbw.ForceRestorePerformanceById(archived.Id)
+
+	// assert
+	var clashErr *internal.LocationClashError
+	assert.ErrorAs(t, err, &clashErr, "Restore into a taken slot should clash")
+	assert.NoError(t, forceErr, "Forced restore failed: %v", forceErr)
+}
+
+func TestPurgePerformanceRemovesJunctions(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	performer, err := dbw.CreatePerformer(getTestPerformer())
+	require.NoError(t, err, "CreatePerformer() failed: %v", err)
+	performance, err := dbw.CreatePerformance(getTestPerformance())
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+	require.NoError(t, dbw.CreateJunction(performer.Id, performance.Id))
+
+	// act
+	err = dbw.PurgePerformanceById(performance.Id)
+	missingErr := dbw.PurgePerformanceById(performance.Id)
+
+	// assert
+	require.NoError(t, err, "PurgePerformanceById() failed: %v", err)
+	assert.Equal(t, sql.ErrNoRows, missingErr, "Purging a missing performance should fail")
+
+	var count int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM performances WHERE id = ?`, performance.Id).Scan(&count))
+	assert.Equal(t, 0, count, "Performance row was not removed")
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM junction`).Scan(&count))
+	assert.Equal(t, 0, count, "Junction rows were not removed")
+
+	entries, _, err := dbw.ListAuditEntries(url.Values{"action": {"purge"}})
+	require.NoError(t, err, "ListAuditEntries() failed: %v", err)
+	assert.Len(t, entries, 1, "Purge was not recorded")
+}
+
+func TestPurgePerformerRemovesEverything(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	performer, err := dbw.CreatePerformer(getTestPerformer())
+	require.NoError(t, err, "CreatePerformer() failed: %v", err)
+	performance, err := dbw.CreatePerformance(getTestPerformance())
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+	require.NoError(t, dbw.CreateJunction(performer.Id, performance.Id))
+	_, _, err = dbw.CreatePerformerLoginCode(performer.Email)
+	require.NoError(t, err, "CreatePerformerLoginCode() failed: %v", err)
+
+	// act
+	err = dbw.PurgePerformerById(performer.Id)
+
+	// assert
+	require.NoError(t, err, "PurgePerformerById() failed: %v", err)
+	for _, table := range []string{"performers", "junction", "performer_login_codes"} {
+		var count int
+		require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM `+table).Scan(&count))
+		assert.Equal(t, 0, count, "%s rows were left behind", table)
+	}
+}
+
+func TestPurgeRequiresAdmin(t *testing.T) {
+	// arrange
+	dbw, handler, _ := setUpAuthTest(t)
+
+	_, organiserKey, err := dbw.CreateUser(&internal.User{Name: "Organiser", Role: internal.RoleOrganiser})
+	require.NoError(t, err, "CreateUser() failed: %v", err)
+	_, adminKey, err := dbw.CreateUser(&internal.User{Name: "Admin", Role: internal.RoleAdmin})
+	require.NoError(t, err, "CreateUser() failed: %v", err)
+
+	cases := []struct {
+		path, key string
+		expected  int
+	}{
+		{"/performances/1", organiserKey, http.StatusTeapot},
+		{"/performances/1?purge=true", organiserKey, http.StatusForbidden},
+		{"/performers/1?purge=true", organiserKey, http.StatusForbidden},
+		{"/performances/1?purge=true", adminKey, http.StatusTeapot},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest("DELETE", c.path, nil)
+		r.Header.Set("X-API-Key", c.key)
+		w := httptest.NewRecorder()
+
+		// act
+		handler.ServeHTTP(w, r)
+
+		// assert
+		assert.Equal(t, c.expected, w.Code, "Unexpected status for DELETE %s", c.path)
+	}
+}
+
+func TestRestorePerformerHandler(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+	api := internal.NewAPI(dbw)
+
+	performer, err := dbw.CreatePerformer(getTestPerformer())
+	require.NoError(t, err, "CreatePerformer() failed: %v", err)
+	require.NoError(t, dbw.DeletePerformerById(performer.Id))
+
+	r := httptest.NewRequest("POST", "/performers/1/restore", nil)
+	w := httptest.NewRecorder()
+
+	// act
+	api.PerformerHandler(w, r)
+
+	// assert
+	assert.Equal(t, http.StatusOK, w.Code, "Expected 200, got %d: %s", w.Code, w.Body.String())
+	restored, err := dbw.GetPerformerById(performer.Id)
+	require.NoError(t, err, "GetPerformerById() failed: %v", err)
+	assert.NotNil(t, restored, "Performer was not restored")
+}
+
+func TestRestorePerformerRejectsOverlappingPerformances(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+	api := internal.NewAPI(dbw)
+
+	performer, err := dbw.CreatePerformer(getTestPerformer())
+	require.NoError(t, err, "CreatePerformer() failed: %v", err)
+	start := time.Date(2025, 9, 1, 18, 0, 0, 0, time.UTC)
+	first := createTestPerformance(t, dbw, "First", "Main Stage", start, time.Hour)
+	second := createTestPerformance(t, dbw, "Second", "Side Stage", start.Add(2*time.Hour), time.Hour)
+	require.NoError(t, dbw.CreateJunction(performer.Id, first.Id))
+	require.NoError(t, dbw.CreateJunction(performer.Id, second.Id))
+	require.NoError(t, dbw.DeletePerformerById(performer.Id))
+
+	// the second performance is moved on top of the first while the performer is archived
+	second.StartTime = start
+	second.EndTime = start.Add(time.Hour)
+	second.Version = 0
+	require.NoError(t, dbw.UpdatePerformanceById(second.Id, second))
+
+	// act
+	r := httptest.NewRequest("POST", "/performers/1/restore", nil)
+	refused := httptest.NewRecorder()
+	api.PerformerHandler(refused, r)
+
+	r = httptest.NewRequest("POST", "/performers/1/restore?force=true", nil)
+	forced := httptest.NewRecorder()
+	api.PerformerHandler(forced, r)
+
+	// assert
+	assert.Equal(t, http.StatusConflict, refused.Code, "Restoring a double-booked performer should be refused")
+	assert.Equal(t, http.StatusOK, forced.Code, "Forced restore failed: %s", forced.Body.String())
+	restored, err := dbw.GetPerformerById(performer.Id)
+	require.NoError(t, err, "GetPerformerById() failed: %v", err)
+	assert.NotNil(t, restored, "Performer was not restored")
+}
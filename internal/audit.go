@@ -0,0 +1,192 @@
+package internal
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	auditEntityPerformance = "performance"
+	auditEntityPerformer   = "performer"
+	auditEntityJunction    = "junction"
+	auditEntityEdition     = "edition"
+	auditEntityGenre       = "genre"
+	auditEntityGroup       = "group"
+	auditEntityRider       = "rider"
+	auditEntityLocation    = "location"
+	// the whole db, for restores from an export
+	auditEntityDatabase = "database"
+
+	auditActionCreate = "create"
+	auditActionUpdate = "update"
+	auditActionDelete = "delete"
+
+	// who changes are recorded against when nobody is logged in, e.g. changes made at startup
+	systemActor = "system"
+)
+
+// a single recorded change. Before is null for creates and After is null for deletes
+type AuditEntry struct {
+	Id       int    `json:"id"`
+	Entity   string `json:"entity"`
+	EntityId string `json:"entityId"`
+	Action   string `json:"action"`
+	// "user:<id>" or "performer:<id>" for changes made through the api
+	Actor     string          `json:"actor"`
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+// returns a copy of the wrapper that records changes against actor in the audit log
+func (dbw *DBWrapper) WithActor(actor string) *DBWrapper {
+	acting := *dbw
+	acting.actor = actor
+	return &acting
+}
+
+// appends a change to the audit log. before and after are stored as json, with nil (or a nil
+// pointer) stored as null
+func (dbw *DBWrapper) audit(entity, entityId, action string, before, after interface{}) error {
+	actor := dbw.actor
+	if actor == "" {
+		actor = systemActor
+	}
+
+	beforeJSON, err := auditJSON(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := auditJSON(after)
+	if err != nil {
+		return err
+	}
+
+	dbQuery := `
+		INSERT INTO audit_log (entity, entityId, action, actor, before, after, createdAt)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err = dbw.db.Exec(dbQuery, entity, entityId, action, actor, beforeJSON, afterJSON, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	// everything that's audited is also worth telling live screens about
+	dbw.notify(entity, entityId, action)
+	return nil
+}
+
+func auditJSON(value interface{}) (interface{}, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	if string(encoded) == "null" {
+		return nil, nil
+	}
+	return string(encoded), nil
+}
+
+// junctions have no id of their own, so they're recorded as "performerId:performanceId"
+func junctionAuditId(performerId, performanceId int) string {
+	return fmt.Sprintf("%d:%d", performerId, performanceId)
+}
+
+// the fields audit entries can be sorted by, and the columns they map to
+var auditSortColumns = map[string]string{
+	"id":        "id",
+	"createdAt": "createdAt",
+	"entity":    "entity",
+	"actor":     "actor",
+}
+
+// the parameters audit entries can be filtered on, and the columns they map to
+var auditFilterColumns = map[string]string{
+	"entity": "entity",
+	"id":     "entityId",
+	"action": "action",
+	"actor":  "actor",
+}
+
+// returns one page of the audit entries matching the limit, cursor, sort and filter parameters
+func (dbw *DBWrapper) ListAuditEntries(params url.Values) ([]*AuditEntry, *Pagination, error) {
+	q, err := parseListQuery(params, auditSortColumns, "id")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	q.filterEqual(params, auditFilterColumns)
+	err = q.filterTimeRange(params, "createdAt", "from", "to")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	total := 0
+	err = dbw.db.QueryRow(`SELECT COUNT(*) FROM audit_log`+q.whereSQL(), q.args...).Scan(&total)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pageClause, args := q.pageSQL()
+	dbQuery := `SELECT id, entity, entityId, action, actor, before, after, createdAt FROM audit_log` + q.whereSQL() + pageClause
+	rows, err := dbw.db.Query(dbQuery, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	entries := []*AuditEntry{}
+	for rows.Next() {
+		e := &AuditEntry{}
+		var before, after sql.NullString
+		err := rows.Scan(&e.Id, &e.Entity, &e.EntityId, &e.Action, &e.Actor, &before, &after, &e.CreatedAt)
+		if err != nil {
+			return nil, nil, err
+		}
+		if before.Valid {
+			e.Before = json.RawMessage(before.String)
+		}
+		if after.Valid {
+			e.After = json.RawMessage(after.String)
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, q.pagination(total), rows.Err()
+}
+
+// returns the wrapper to make changes through for a request, so they're recorded against whoever made it
+func (api *API) wrapperFor(r *http.Request) *DBWrapper {
+	if user := UserFromContext(r.Context()); user != nil {
+		return api.wrapper.WithActor(fmt.Sprintf("user:%d", user.Id))
+	}
+	return api.wrapper
+}
+
+// Handles requests for the audit log
+func (api *API) AuditHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		api.GetAuditLog(w, r)
+	}
+}
+
+// GET /audit - returns recorded changes, oldest first. filter with ?entity=, &id=, &action=,
+// &actor= and a &from=/&to= time range
+func (api *API) GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	entries, page, err := api.wrapper.ListAuditEntries(r.URL.Query())
+	if isQueryError(err) {
+		api.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Unable to read audit log")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, map[string]interface{}{"entries": entries, "pagination": page})
+}
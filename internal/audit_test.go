@@ -0,0 +1,151 @@
+package internal_test
+
+import (
+	"encoding/json"
+	internal "foc_api/internal"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditRecordsPerformanceChanges(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db).WithActor("user:7")
+
+	performance, err := dbw.CreatePerformance(getTestPerformance())
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+
+	updated := *performance
+	updated.ItemName = "Renamed"
+
+	// act
+	err = dbw.UpdatePerformanceById(performance.Id, &updated)
+	require.NoError(t, err, "UpdatePerformanceById() failed: %v", err)
+	err = dbw.DeletePerformanceById(performance.Id)
+	require.NoError(t, err, "DeletePerformanceById() failed: %v", err)
+
+	entries, _, err := dbw.ListAuditEntries(url.Values{"entity": {"performance"}, "id": {strconv.Itoa(performance.Id)}})
+
+	// assert
+	require.NoError(t, err, "ListAuditEntries() failed: %v", err)
+	require.Len(t, entries, 3, "Expected a create, an update and a delete")
+
+	actions := []string{}
+	for _, entry := range entries {
+		actions = append(actions, entry.Action)
+		assert.Equal(t, "user:7", entry.Actor, "Change recorded against the wrong actor")
+	}
+	assert.Equal(t, []string{"create", "update", "delete"}, actions, "Changes recorded out of order")
+
+	assert.Nil(t, entries[0].Before, "Create should have no before")
+
+	var before, after internal.Performance
+	require.NoError(t, json.Unmarshal(entries[1].Before, &before))
+	require.NoError(t, json.Unmarshal(entries[1].After, &after))
+	assert.Equal(t, performance.ItemName, before.ItemName, "Update before is wrong")
+	assert.Equal(t, "Renamed", after.ItemName, "Update after is wrong")
+
+	assert.Nil(t, entries[2].After, "Delete should have no after")
+}
+
+func TestAuditRecordsJunctionChanges(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	performer, err := dbw.CreatePerformer(getTestPerformer())
+	require.NoError(t, err, "CreatePerformer() failed: %v", err)
+	performance, err := dbw.CreatePerformance(getTestPerformance())
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+
+	// act
+	err = dbw.CreateJunction(performer.Id, performance.Id)
+	require.NoError(t, err, "CreateJunction() failed: %v", err)
+	err = dbw.DeleteJunction(performer.Id, performance.Id)
+	require.NoError(t, err, "DeleteJunction() failed: %v", err)
+	// already gone, so nothing should be recorded
+	err = dbw.DeleteJunction(performer.Id, performance.Id)
+	require.NoError(t, err, "DeleteJunction() failed: %v", err)
+
+	entries, _, err := dbw.ListAuditEntries(url.Values{"entity": {"junction"}})
+
+	// assert
+	require.NoError(t, err, "ListAuditEntries() failed: %v", err)
+	require.Len(t, entries, 2, "Expected a create and a delete")
+	expectedId := strconv.Itoa(performer.Id) + ":" + strconv.Itoa(performance.Id)
+	assert.Equal(t, expectedId, entries[0].EntityId, "Junction recorded with the wrong id")
+	assert.Equal(t, "system", entries[0].Actor, "Changes without an actor should be recorded against the system")
+}
+
+func TestAuditSkipsFailedChanges(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	// act
+	err := dbw.UpdatePerformanceById(999, getTestPerformance())
+	entries, _, listErr := dbw.ListAuditEntries(url.Values{"action": {"update"}})
+
+	// assert
+	assert.Error(t, err, "Updating a missing performance should fail")
+	require.NoError(t, listErr, "ListAuditEntries() failed: %v", listErr)
+	assert.Empty(t, entries, "A failed update was recorded")
+}
+
+func TestAuditLogIsAppendOnly(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	_, err := dbw.CreatePerformer(getTestPerformer())
+	require.NoError(t, err, "CreatePerformer() failed: %v", err)
+
+	// act
+	_, updateErr := db.Exec(`UPDATE audit_log SET actor = 'someone else'`)
+	_, deleteErr := db.Exec(`DELETE FROM audit_log`)
+
+	// assert
+	assert.Error(t, updateErr, "Audit entries could be changed")
+	assert.Error(t, deleteErr, "Audit entries could be deleted")
+}
+
+func TestGetAuditLogHandler(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+	api := internal.NewAPI(dbw)
+
+	for _, performer := range getTestPerformers(3) {
+		_, err := dbw.CreatePerformer(performer)
+		require.NoError(t, err, "CreatePerformer() failed: %v", err)
+	}
+
+	r := httptest.NewRequest("GET", "/audit?entity=performer&id=2", nil)
+	w := httptest.NewRecorder()
+
+	// act
+	api.AuditHandler(w, r)
+
+	// assert
+	require.Equal(t, http.StatusOK, w.Code, "Expected 200, got %d: %s", w.Code, w.Body.String())
+
+	var body struct {
+		Entries    []*internal.AuditEntry `json:"entries"`
+		Pagination internal.Pagination    `json:"pagination"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&body))
+	require.Len(t, body.Entries, 1, "Expected only performer 2's entry")
+	assert.Equal(t, "2", body.Entries[0].EntityId, "Wrong entry returned")
+	assert.Equal(t, 1, body.Pagination.Total, "Wrong total")
+}
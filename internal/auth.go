@@ -0,0 +1,436 @@
+package internal
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+type Role string
+
+const (
+	RoleReadOnly  Role = "read-only"
+	RoleOrganiser Role = "organiser"
+	RoleAdmin     Role = "admin"
+
+	// stands in for a role when a route doesn't need anyone to be logged in
+	rolePublic Role = ""
+
+	// api keys start with this so they're easy to spot if one leaks into a log or a repo
+	apiKeyPrefix = "foc_"
+)
+
+// higher levels can do everything lower levels can
+var roleLevels = map[Role]int{
+	rolePublic:    0,
+	RoleReadOnly:  1,
+	RoleOrganiser: 2,
+	RoleAdmin:     3,
+}
+
+type User struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+	Role Role   `json:"role"`
+}
+
+var ErrInvalidRole = errors.New("role must be admin, organiser or read-only")
+
+// reports whether the role is one users can actually have
+func (role Role) valid() bool {
+	level, ok := roleLevels[role]
+	return ok && level > 0
+}
+
+// reports whether the role grants at least the access of required
+func (role Role) allows(required Role) bool {
+	return roleLevels[role] >= roleLevels[required]
+}
+
+// the role needed for requests to a path. prefix matches whole path segments, methods
+// limits the policy to those methods (every method if empty), and flag limits it to requests
+// with that query parameter set to true
+type routePolicy struct {
+	prefix  string
+	methods []string
+	flag    string
+	role    Role
+}
+
+// checked in order, the first match wins. requests that match nothing are public if they
+// only read, and need an organiser if they change anything
+var routePolicies = []routePolicy{
+	// hard deletes can't be undone
+	{prefix: "/performances", methods: []string{http.MethodDelete}, flag: "purge", role: RoleAdmin},
+	{prefix: "/performers", methods: []string{http.MethodDelete}, flag: "purge", role: RoleAdmin},
+	{prefix: "/users", role: RoleAdmin},
+	{prefix: "/restore", role: RoleAdmin},
+	// the export includes every performer's email address
+	{prefix: "/export", role: RoleReadOnly},
+	// before and after snapshots include performers' email addresses too
+	{prefix: "/audit", role: RoleReadOnly},
+	// attendance is a record of who did and didn't turn up
+	{prefix: "/reports", role: RoleReadOnly},
+	// performers log in with their own session tokens, which the /me handlers check themselves
+	{prefix: "/me", role: rolePublic},
+}
+
+// works out the role a request needs
+func requiredRole(r *http.Request) Role {
+	for _, policy := range routePolicies {
+		if !pathHasPrefix(r.URL.Path, policy.prefix) {
+			continue
+		}
+		if len(policy.methods) > 0 && !containsString(policy.methods, r.Method) {
+			continue
+		}
+		if policy.flag != "" && !queryFlag(r, policy.flag) {
+			continue
+		}
+		return policy.role
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return rolePublic
+	default:
+		return RoleOrganiser
+	}
+}
+
+// reports whether path is prefix or somewhere underneath it, so /users matches /users/1 but not /usersettings
+func pathHasPrefix(path, prefix string) bool {
+	return path == prefix || strings.HasPrefix(path, strings.TrimSuffix(prefix, "/")+"/")
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+type contextKey string
+
+const userContextKey contextKey = "user"
+
+// returns the user who made the request, or nil if it wasn't authenticated
+func UserFromContext(ctx context.Context) *User {
+	user, _ := ctx.Value(userContextKey).(*User)
+	return user
+}
+
+// checks every request against routePolicies before passing it on to next
+func (api *API) AuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		required := requiredRole(r)
+
+		key := apiKeyFromRequest(r)
+		if key == "" {
+			if required != rolePublic {
+				api.respondError(w, http.StatusUnauthorized, "Authentication required")
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, err := api.wrapper.GetUserByAPIKey(key)
+		if err != nil {
+			api.respondError(w, http.StatusInternalServerError, "Unable to check credentials")
+			return
+		}
+		if user == nil {
+			api.respondError(w, http.StatusUnauthorized, "Invalid API key")
+			return
+		}
+		if !user.Role.allows(required) {
+			api.respondError(w, http.StatusForbidden, "Insufficient permissions")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userContextKey, user)))
+	})
+}
+
+// reads the key from "Authorization: Bearer <key>" or "X-API-Key: <key>"
+func apiKeyFromRequest(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		key, found := strings.CutPrefix(auth, "Bearer ")
+		if found && strings.HasPrefix(key, apiKeyPrefix) {
+			return strings.TrimSpace(key)
+		}
+	}
+	return strings.TrimSpace(r.Header.Get("X-API-Key"))
+}
+
+// keys are only ever stored hashed, so a leaked db doesn't leak working keys
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func generateAPIKey() (string, error) {
+	bytes := make([]byte, 32)
+	_, err := rand.Read(bytes)
+	if err != nil {
+		return "", err
+	}
+	return apiKeyPrefix + hex.EncodeToString(bytes), nil
+}
+
+// creates a user with a freshly generated api key. the key is returned here and never again
+func (dbw *DBWrapper) CreateUser(u *User) (*User, string, error) {
+	if !u.Role.valid() {
+		return nil, "", ErrInvalidRole
+	}
+
+	key, err := generateAPIKey()
+	if err != nil {
+		return nil, "", err
+	}
+
+	u, err = dbw.createUserWithKey(u, key)
+	if err != nil {
+		return nil, "", err
+	}
+	return u, key, nil
+}
+
+func (dbw *DBWrapper) createUserWithKey(u *User, key string) (*User, error) {
+	dbQuery := `
+		INSERT INTO users (name, role, apiKeyHash)
+		VALUES (?, ?, ?)
+		RETURNING id
+	`
+
+	err := dbw.db.QueryRow(dbQuery, u.Name, u.Role, hashAPIKey(key)).
+		Scan(&u.Id)
+
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// makes sure key works as an admin key, creating an admin user for it if needed.
+// used to bootstrap the first admin from the ADMIN_API_KEY environment variable
+func (dbw *DBWrapper) EnsureAdminKey(key string) error {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return errors.New("admin api key must start with " + apiKeyPrefix)
+	}
+
+	user, err := dbw.GetUserByAPIKey(key)
+	if err != nil {
+		return err
+	}
+	if user != nil {
+		if user.Role != RoleAdmin {
+			return errors.New("admin api key belongs to a user who isn't an admin")
+		}
+		return nil
+	}
+
+	_, err = dbw.createUserWithKey(&User{Name: "admin", Role: RoleAdmin}, key)
+	return err
+}
+
+// Return the user the api key belongs to, or nil if it doesn't belong to anyone
+func (dbw *DBWrapper) GetUserByAPIKey(key string) (*User, error) {
+	dbQuery := `
+		SELECT id, name, role
+		FROM users
+		WHERE apiKeyHash = ? AND deleted = 0
+	`
+
+	u := &User{}
+	err := dbw.db.QueryRow(dbQuery, hashAPIKey(key)).
+		Scan(&u.Id, &u.Name, &u.Role)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// returns a slice with all the users in the db
+func (dbw *DBWrapper) GetAllUsers() ([]*User, error) {
+	dbQuery := `
+		SELECT id, name, role
+		FROM users
+		WHERE deleted = 0
+		ORDER BY id ASC
+	`
+
+	rows, err := dbw.db.Query(dbQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*User{}
+	for rows.Next() {
+		u := &User{}
+		err := rows.Scan(&u.Id, &u.Name, &u.Role)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+
+	return users, nil
+}
+
+// Updates the name and role of the user with the given id
+func (dbw *DBWrapper) UpdateUserById(id int, u *User) error {
+	if !u.Role.valid() {
+		return ErrInvalidRole
+	}
+
+	dbQuery := `
+		UPDATE users
+		SET name = ?, role = ?
+		WHERE id = ? AND deleted = 0
+	`
+
+	result, err := dbw.db.Exec(dbQuery, u.Name, u.Role, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	// error if no matching rows were found and updated
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// Deletes the user with the given id, which revokes their api key
+func (dbw *DBWrapper) DeleteUserById(id int) error {
+	dbQuery := `
+		UPDATE users
+		SET deleted = 1
+		WHERE id = ?
+	`
+	_, err := dbw.db.Exec(dbQuery, id)
+	return err
+}
+
+// Handles all requests related to users
+func (api *API) UserHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		api.GetAllUsers(w, r)
+	case http.MethodPost:
+		api.CreateNewUser(w, r)
+	case http.MethodPut:
+		api.UpdateUser(w, r)
+	case http.MethodDelete:
+		api.DeleteUser(w, r)
+	}
+}
+
+// GET /users - returns all users
+func (api *API) GetAllUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := api.wrapper.GetAllUsers()
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Unable to find users")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, map[string][]*User{"users": users})
+}
+
+// POST /users - creates a user and returns their api key, which can't be retrieved again
+func (api *API) CreateNewUser(w http.ResponseWriter, r *http.Request) {
+	var user User
+
+	err := json.NewDecoder(r.Body).Decode(&user)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	if strings.TrimSpace(user.Name) == "" {
+		api.respondError(w, http.StatusBadRequest, "Cannot be blank")
+		return
+	}
+
+	newUser, key, err := api.wrapper.CreateUser(&user)
+	if errors.Is(err, ErrInvalidRole) {
+		api.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Failed to create user")
+		return
+	}
+
+	api.respondJSON(w, http.StatusCreated, map[string]interface{}{"user": newUser, "apiKey": key})
+}
+
+// PUT /users/:id - updates the name and role of the user with the specified id
+func (api *API) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	var user User
+
+	err := json.NewDecoder(r.Body).Decode(&user)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	id, err := api.extractId(r.URL.Path)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid ID provided")
+		return
+	}
+
+	err = api.wrapper.UpdateUserById(id, &user)
+	if errors.Is(err, ErrInvalidRole) {
+		api.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err == sql.ErrNoRows {
+		api.respondError(w, http.StatusNotFound, "User Not Found")
+		return
+	}
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Error updating user")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// DELETE /users/:id - deletes the user with the specified id and revokes their api key
+func (api *API) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	id, err := api.extractId(r.URL.Path)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid ID provided")
+		return
+	}
+
+	err = api.wrapper.DeleteUserById(id)
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Error deleting user")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
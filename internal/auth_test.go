@@ -0,0 +1,143 @@
+package internal_test
+
+import (
+	"bytes"
+	"encoding/json"
+	internal "foc_api/internal"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// puts the auth middleware in front of a handler that records who reached it
+func setUpAuthTest(t *testing.T) (*internal.DBWrapper, http.Handler, **internal.User) {
+	db := setUpTestDB(t)
+	t.Cleanup(func() { db.Close() })
+	dbw := internal.CreateDBWrapper(db)
+	api := internal.NewAPI(dbw)
+
+	var reachedBy *internal.User
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reachedBy = internal.UserFromContext(r.Context())
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	return dbw, api.AuthMiddleware(next), &reachedBy
+}
+
+func TestAuthMiddlewareLeavesReadsPublic(t *testing.T) {
+	// arrange
+	_, handler, _ := setUpAuthTest(t)
+
+	r := httptest.NewRequest("GET", "/performances/1", nil)
+	w := httptest.NewRecorder()
+
+	// act
+	handler.ServeHTTP(w, r)
+
+	// assert
+	assert.Equal(t, http.StatusTeapot, w.Code, "Public GET was blocked")
+}
+
+func TestAuthMiddlewareRequiresKeyForWrites(t *testing.T) {
+	// arrange
+	_, handler, _ := setUpAuthTest(t)
+
+	r := httptest.NewRequest("DELETE", "/performances/1", nil)
+	w := httptest.NewRecorder()
+
+	// act
+	handler.ServeHTTP(w, r)
+
+	// assert
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "Unauthenticated DELETE was allowed")
+}
+
+func TestAuthMiddlewareEnforcesRoles(t *testing.T) {
+	// arrange
+	dbw, handler, reachedBy := setUpAuthTest(t)
+
+	_, readOnlyKey, err := dbw.CreateUser(&internal.User{Name: "Viewer", Role: internal.RoleReadOnly})
+	require.NoError(t, err, "CreateUser() failed: %v", err)
+	organiser, organiserKey, err := dbw.CreateUser(&internal.User{Name: "Organiser", Role: internal.RoleOrganiser})
+	require.NoError(t, err, "CreateUser() failed: %v", err)
+
+	cases := []struct {
+		method, path, key string
+		expected          int
+	}{
+		{"DELETE", "/performances/1", readOnlyKey, http.StatusForbidden},
+		{"DELETE", "/performances/1", organiserKey, http.StatusTeapot},
+		{"POST", "/users", organiserKey, http.StatusForbidden},
+		{"GET", "/users", organiserKey, http.StatusForbidden},
+		{"GET", "/export", readOnlyKey, http.StatusTeapot},
+		{"GET", "/export", "", http.StatusUnauthorized},
+		{"GET", "/reports/attendance", "", http.StatusUnauthorized},
+		{"POST", "/junctions", "foc_not-a-real-key", http.StatusUnauthorized},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest(c.method, c.path, nil)
+		if c.key != "" {
+			r.Header.Set("Authorization", "Bearer "+c.key)
+		}
+		w := httptest.NewRecorder()
+
+		// act
+		handler.ServeHTTP(w, r)
+
+		// assert
+		assert.Equal(t, c.expected, w.Code, "%s %s returned the wrong status", c.method, c.path)
+	}
+
+	// the user is passed along to the handler
+	r := httptest.NewRequest("POST", "/performances", nil)
+	r.Header.Set("X-API-Key", organiserKey)
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	require.NotNil(t, *reachedBy)
+	assert.Equal(t, organiser.Id, (*reachedBy).Id)
+}
+
+func TestEnsureAdminKey(t *testing.T) {
+	// arrange
+	dbw, handler, _ := setUpAuthTest(t)
+	key := "foc_bootstrap-key"
+
+	// act
+	err := dbw.EnsureAdminKey(key)
+	require.NoError(t, err, "EnsureAdminKey() failed: %v", err)
+	// running it again on every start mustn't create another admin
+	err = dbw.EnsureAdminKey(key)
+	require.NoError(t, err, "EnsureAdminKey() failed: %v", err)
+
+	// assert
+	users, err := dbw.GetAllUsers()
+	require.NoError(t, err, "GetAllUsers() failed: %v", err)
+	assert.Len(t, users, 1)
+
+	r := httptest.NewRequest("POST", "/users", nil)
+	r.Header.Set("Authorization", "Bearer "+key)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusTeapot, w.Code, "Bootstrap key was not accepted as an admin")
+}
+
+func TestCreateUserEndpointRejectsUnknownRole(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	api := internal.NewAPI(internal.CreateDBWrapper(db))
+
+	body, _ := json.Marshal(map[string]string{"name": "Someone", "role": "superuser"})
+	r := httptest.NewRequest("POST", "/users", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+
+	// act
+	api.UserHandler(w, r)
+
+	// assert
+	assert.Equal(t, http.StatusBadRequest, w.Code, "UserHandler() returned status %v", w.Code)
+}
@@ -0,0 +1,619 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// bump whenever the shape of ExportDocument changes, and teach Restore to read the old shape
+const exportFormatVersion = 1
+
+// a snapshot of everything in the db, soft-deleted rows included
+type ExportDocument struct {
+	Version       int                    `json:"version"`
+	SchemaVersion int                    `json:"schemaVersion"`
+	ExportedAt    time.Time              `json:"exportedAt"`
+	Editions      []*ExportedEdition     `json:"editions"`
+	Locations     []*ExportedLocation    `json:"locations"`
+	Genres        []*ExportedGenre       `json:"genres"`
+	Groups        []*ExportedGroup       `json:"groups"`
+	Performances  []*ExportedPerformance `json:"performances"`
+	Performers    []*ExportedPerformer   `json:"performers"`
+	Junctions     []*ExportedJunction    `json:"junctions"`
+	Riders        []*TechRider           `json:"riders"`
+}
+
+type ExportedEdition struct {
+	Edition
+	Deleted bool `json:"deleted"`
+}
+
+type ExportedLocation struct {
+	Location
+	Deleted bool `json:"deleted"`
+}
+
+type ExportedGenre struct {
+	Genre
+	Deleted bool `json:"deleted"`
+}
+
+type ExportedGroup struct {
+	Group
+	Deleted bool `json:"deleted"`
+}
+
+type ExportedPerformance struct {
+	Performance
+	Deleted bool `json:"deleted"`
+}
+
+type ExportedPerformer struct {
+	Performer
+	Deleted bool `json:"deleted"`
+}
+
+type ExportedJunction struct {
+	PerformerId   int `json:"performerId"`
+	PerformanceId int `json:"performanceId"`
+	// whether the performer turned up: present, absent, or blank if they haven't been checked in
+	Attendance  string    `json:"attendance"`
+	CheckedInAt time.Time `json:"checkedInAt"`
+	// the group the performer was booked in with. 0 if they were booked on their own
+	GroupId int `json:"groupId"`
+	JunctionDetails
+}
+
+// what a performer does in a performance. all of it is optional
+type JunctionDetails struct {
+	// e.g. "leader" or "backing vocals"
+	Role       string `json:"role"`
+	Instrument string `json:"instrument"`
+	Notes      string `json:"notes"`
+}
+
+// returns every row in the db, including soft-deleted ones
+func (dbw *DBWrapper) Export() (*ExportDocument, error) {
+	doc := &ExportDocument{
+		Version:       exportFormatVersion,
+		SchemaVersion: LatestSchemaVersion(),
+		ExportedAt:    time.Now().UTC(),
+		Editions:      []*ExportedEdition{},
+		Locations:     []*ExportedLocation{},
+		Genres:        []*ExportedGenre{},
+		Groups:        []*ExportedGroup{},
+		Riders:        []*TechRider{},
+		Performances:  []*ExportedPerformance{},
+		Performers:    []*ExportedPerformer{},
+		Junctions:     []*ExportedJunction{},
+	}
+
+	err := dbw.InTransaction(func(tx *DBWrapper) error {
+		rows, err := tx.db.Query(`SELECT ` + editionColumns + `, e.deleted FROM editions AS e ORDER BY e.id ASC`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			e := &ExportedEdition{}
+			err := rows.Scan(&e.Id, &e.Name, &e.StartTime, &e.EndTime, &e.Current, &e.Deleted)
+			if err != nil {
+				return err
+			}
+			doc.Editions = append(doc.Editions, e)
+		}
+
+		rows, err = tx.db.Query(`SELECT id, name, deleted FROM locations ORDER BY id ASC`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			l := &ExportedLocation{}
+			err := rows.Scan(&l.Id, &l.Name, &l.Deleted)
+			if err != nil {
+				return err
+			}
+			doc.Locations = append(doc.Locations, l)
+		}
+
+		rows, err = tx.db.Query(`SELECT id, name, deleted FROM genres ORDER BY id ASC`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		genres := map[int]*ExportedGenre{}
+		for rows.Next() {
+			g := &ExportedGenre{Genre: Genre{Aliases: []string{}}}
+			err := rows.Scan(&g.Id, &g.Name, &g.Deleted)
+			if err != nil {
+				return err
+			}
+			doc.Genres = append(doc.Genres, g)
+			genres[g.Id] = g
+		}
+
+		rows, err = tx.db.Query(`SELECT genreId, alias FROM genre_aliases ORDER BY alias ASC`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var genreId int
+			var alias string
+			err := rows.Scan(&genreId, &alias)
+			if err != nil {
+				return err
+			}
+			if g, ok := genres[genreId]; ok {
+				g.Aliases = append(g.Aliases, alias)
+			}
+		}
+
+		rows, err = tx.db.Query(`SELECT id, name, deleted FROM groups ORDER BY id ASC`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		groups := map[int]*ExportedGroup{}
+		for rows.Next() {
+			g := &ExportedGroup{Group: Group{MemberIds: []int{}}}
+			err := rows.Scan(&g.Id, &g.Name, &g.Deleted)
+			if err != nil {
+				return err
+			}
+			doc.Groups = append(doc.Groups, g)
+			groups[g.Id] = g
+		}
+
+		// deleted performers stay members, so restoring them puts them back in their groups
+		rows, err = tx.db.Query(`SELECT groupId, performerId FROM group_members ORDER BY performerId ASC`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var groupId, performerId int
+			err := rows.Scan(&groupId, &performerId)
+			if err != nil {
+				return err
+			}
+			if g, ok := groups[groupId]; ok {
+				g.MemberIds = append(g.MemberIds, performerId)
+			}
+		}
+
+		rows, err = tx.db.Query(`SELECT ` + performanceColumns + `, p.deleted FROM performances AS p ORDER BY p.id ASC`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			p := &ExportedPerformance{}
+			err := rows.Scan(&p.Id, &p.ItemName, &p.GenreName, &p.GenreId, &p.GroupName, &p.GroupId, &p.Location, &p.LocationId, &p.EditionId, &p.StartTime, &p.EndTime, &p.Duration, &p.PlannedStartTime, &p.PlannedEndTime, &p.ActualStartTime, &p.ActualEndTime, &p.Version, &p.Deleted)
+			if err != nil {
+				return err
+			}
+			doc.Performances = append(doc.Performances, p)
+		}
+
+		rows, err = tx.db.Query(`SELECT ` + performerColumns + `, p.deleted FROM performers AS p ORDER BY p.id ASC`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			p := &ExportedPerformer{}
+			err := rows.Scan(&p.Id, &p.Name, &p.Email, &p.Version, &p.Deleted)
+			if err != nil {
+				return err
+			}
+			doc.Performers = append(doc.Performers, p)
+		}
+
+		rows, err = tx.db.Query(`SELECT ` + junctionColumns + ` FROM junction ORDER BY performer_id ASC, performance_id ASC`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			j, err := scanJunction(rows)
+			if err != nil {
+				return err
+			}
+			doc.Junctions = append(doc.Junctions, j)
+		}
+
+		// deleted performances keep their riders, so they come back with them
+		for _, p := range doc.Performances {
+			rider, err := tx.GetRider(p.Id)
+			if err != nil {
+				return err
+			}
+			if rider != nil {
+				doc.Riders = append(doc.Riders, rider)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+// checks a document is something Restore can load without leaving dangling references, and that
+// its rows pass the same validation they would through the api
+func (dbw *DBWrapper) validateExportDocument(doc *ExportDocument) error {
+	if doc.Version < 1 || doc.Version > exportFormatVersion {
+		return fmt.Errorf("unsupported export version %d", doc.Version)
+	}
+
+	editions := map[int]bool{}
+	editionNames := map[string]bool{}
+	current := 0
+	for _, e := range doc.Editions {
+		if e.Id <= 0 || editions[e.Id] {
+			return fmt.Errorf("edition id %d is missing or duplicated", e.Id)
+		}
+		normaliseEdition(&e.Edition)
+		err := validateEdition(&e.Edition)
+		if err != nil {
+			return fmt.Errorf("edition %d is invalid: %v", e.Id, err)
+		}
+		err = checkNameFree(editionNames, e.Name, e.Deleted)
+		if err != nil {
+			return fmt.Errorf("edition %d: %v", e.Id, err)
+		}
+		if e.Current && !e.Deleted {
+			current++
+		}
+		editions[e.Id] = true
+	}
+	if current > 1 {
+		return fmt.Errorf("%d editions are current, only one can be", current)
+	}
+
+	locations := map[int]bool{}
+	locationNames := map[string]bool{}
+	for _, l := range doc.Locations {
+		if l.Id <= 0 || locations[l.Id] {
+			return fmt.Errorf("location id %d is missing or duplicated", l.Id)
+		}
+		l.Name = strings.TrimSpace(l.Name)
+		if l.Name == "" {
+			return fmt.Errorf("location %d has no name", l.Id)
+		}
+		if utf8.RuneCountInString(l.Name) > maxLocationLength {
+			return fmt.Errorf("location %d has a name longer than %d characters", l.Id, maxLocationLength)
+		}
+		err := checkNameFree(locationNames, l.Name, l.Deleted)
+		if err != nil {
+			return fmt.Errorf("location %d: %v", l.Id, err)
+		}
+		locations[l.Id] = true
+	}
+
+	genres := map[int]bool{}
+	genreNames := map[string]bool{}
+	for _, g := range doc.Genres {
+		if g.Id <= 0 || genres[g.Id] {
+			return fmt.Errorf("genre id %d is missing or duplicated", g.Id)
+		}
+		normaliseGenre(&g.Genre)
+		err := validateGenre(&g.Genre)
+		if err != nil {
+			return fmt.Errorf("genre %d is invalid: %v", g.Id, err)
+		}
+		err = checkNameFree(genreNames, genreKey(g.Name), g.Deleted)
+		if err != nil {
+			return fmt.Errorf("genre %d: %v", g.Id, err)
+		}
+		genres[g.Id] = true
+	}
+
+	groups := map[int]bool{}
+	groupNames := map[string]bool{}
+	for _, g := range doc.Groups {
+		if g.Id <= 0 || groups[g.Id] {
+			return fmt.Errorf("group id %d is missing or duplicated", g.Id)
+		}
+		normaliseGroup(&g.Group)
+		err := validateGroup(&g.Group)
+		if err != nil {
+			return fmt.Errorf("group %d is invalid: %v", g.Id, err)
+		}
+		err = checkNameFree(groupNames, g.Name, g.Deleted)
+		if err != nil {
+			return fmt.Errorf("group %d: %v", g.Id, err)
+		}
+		groups[g.Id] = true
+	}
+
+	performances := map[int]bool{}
+	for _, p := range doc.Performances {
+		if p.Id <= 0 || performances[p.Id] {
+			return fmt.Errorf("performance id %d is missing or duplicated", p.Id)
+		}
+		if p.LocationId != 0 && !locations[p.LocationId] {
+			return fmt.Errorf("performance %d refers to unknown location %d", p.Id, p.LocationId)
+		}
+		if p.GenreId != 0 && !genres[p.GenreId] {
+			return fmt.Errorf("performance %d refers to unknown genre %d", p.Id, p.GenreId)
+		}
+		if p.GroupId != 0 && !groups[p.GroupId] {
+			return fmt.Errorf("performance %d refers to unknown group %d", p.Id, p.GroupId)
+		}
+		if p.EditionId != 0 && !editions[p.EditionId] {
+			return fmt.Errorf("performance %d refers to unknown edition %d", p.Id, p.EditionId)
+		}
+		normalisePerformanceTimes(&p.Performance)
+		err := dbw.validatePerformance(&p.Performance)
+		if err != nil {
+			return fmt.Errorf("performance %d is invalid: %v", p.Id, err)
+		}
+		performances[p.Id] = true
+	}
+
+	performers := map[int]bool{}
+	for _, p := range doc.Performers {
+		if p.Id <= 0 || performers[p.Id] {
+			return fmt.Errorf("performer id %d is missing or duplicated", p.Id)
+		}
+		err := validatePerformer(&p.Performer)
+		if err != nil {
+			return fmt.Errorf("performer %d is invalid: %v", p.Id, err)
+		}
+		performers[p.Id] = true
+	}
+
+	for _, g := range doc.Groups {
+		for _, performerId := range g.MemberIds {
+			if !performers[performerId] {
+				return fmt.Errorf("group %d refers to unknown performer %d", g.Id, performerId)
+			}
+		}
+	}
+
+	junctions := map[[2]int]bool{}
+	for _, j := range doc.Junctions {
+		if !performers[j.PerformerId] || !performances[j.PerformanceId] {
+			return fmt.Errorf("junction %d:%d refers to an unknown performer or performance", j.PerformerId, j.PerformanceId)
+		}
+		if j.GroupId != 0 && !groups[j.GroupId] {
+			return fmt.Errorf("junction %d:%d refers to unknown group %d", j.PerformerId, j.PerformanceId, j.GroupId)
+		}
+		key := [2]int{j.PerformerId, j.PerformanceId}
+		if junctions[key] {
+			return fmt.Errorf("junction %d:%d is duplicated", j.PerformerId, j.PerformanceId)
+		}
+		junctions[key] = true
+	}
+
+	riders := map[int]bool{}
+	for _, r := range doc.Riders {
+		if !performances[r.PerformanceId] {
+			return fmt.Errorf("rider refers to unknown performance %d", r.PerformanceId)
+		}
+		if riders[r.PerformanceId] {
+			return fmt.Errorf("rider of performance %d is duplicated", r.PerformanceId)
+		}
+		normaliseRider(r)
+		err := validateRider(r)
+		if err != nil {
+			return fmt.Errorf("rider of performance %d is invalid: %v", r.PerformanceId, err)
+		}
+		riders[r.PerformanceId] = true
+	}
+
+	return nil
+}
+
+// names of rows that aren't deleted have to be unique, matched ignoring case like the db does.
+// records name in seen when it's free
+func checkNameFree(seen map[string]bool, name string, deleted bool) error {
+	if deleted {
+		return nil
+	}
+	key := strings.ToLower(name)
+	if seen[key] {
+		return fmt.Errorf("name %q is used more than once", name)
+	}
+	seen[key] = true
+	return nil
+}
+
+// replaces everything in the db with the contents of doc, in a single transaction
+func (dbw *DBWrapper) Restore(doc *ExportDocument) error {
+	err := dbw.validateExportDocument(doc)
+	if err != nil {
+		return &RestoreError{err}
+	}
+
+	return dbw.InTransaction(func(tx *DBWrapper) error {
+		// children first so nothing is left pointing at a deleted row. performer logins go too,
+		// since the restored performer with the same id may well be someone else
+		for _, table := range []string{"performer_login_codes", "performer_sessions", "junction", "rider_files", "rider_equipment", "rider_inputs", "riders", "performances", "group_members", "performers", "groups", "genre_aliases", "genres", "locations", "editions"} {
+			_, err := tx.db.Exec(fmt.Sprintf(`DELETE FROM %s`, table))
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, e := range doc.Editions {
+			normaliseEdition(&e.Edition)
+			_, err := tx.db.Exec(`INSERT INTO editions (id, name, startTime, endTime, isCurrent, deleted) VALUES (?, ?, ?, ?, ?, ?)`, e.Id, e.Name, e.StartTime, e.EndTime, e.Current && !e.Deleted, e.Deleted)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, l := range doc.Locations {
+			_, err := tx.db.Exec(`INSERT INTO locations (id, name, deleted) VALUES (?, ?, ?)`, l.Id, l.Name, l.Deleted)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, g := range doc.Genres {
+			normaliseGenre(&g.Genre)
+			_, err := tx.db.Exec(`INSERT INTO genres (id, name, deleted) VALUES (?, ?, ?)`, g.Id, g.Name, g.Deleted)
+			if err != nil {
+				return err
+			}
+			err = tx.saveGenreAliases(&g.Genre)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, g := range doc.Groups {
+			_, err := tx.db.Exec(`INSERT INTO groups (id, name, deleted) VALUES (?, ?, ?)`, g.Id, g.Name, g.Deleted)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, p := range doc.Performances {
+			normalisePerformanceTimes(&p.Performance)
+			_, err := tx.db.Exec(`
+				INSERT INTO performances (id, itemName, genreName, genreId, groupName, groupId, location, locationId, editionId, startTime, endTime, duration, plannedStartTime, plannedEndTime, actualStartTime, actualEndTime, version, deleted)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			`, p.Id, p.ItemName, p.GenreName, nullableId(p.GenreId), p.GroupName, nullableId(p.GroupId), p.Location, nullableId(p.LocationId), nullableId(p.EditionId), p.StartTime, p.EndTime, p.Duration, p.PlannedStartTime, p.PlannedEndTime, p.ActualStartTime, p.ActualEndTime, restoredVersion(p.Version), p.Deleted)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, p := range doc.Performers {
+			_, err := tx.db.Exec(`INSERT INTO performers (id, name, email, version, deleted) VALUES (?, ?, ?, ?, ?)`, p.Id, p.Name, p.Email, restoredVersion(p.Version), p.Deleted)
+			if err != nil {
+				return err
+			}
+		}
+
+		// groups are put in before performers, so their members can only be added now
+		for _, g := range doc.Groups {
+			normaliseGroup(&g.Group)
+			err := tx.saveGroupMembers(&g.Group)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, j := range doc.Junctions {
+			_, err := tx.db.Exec(`INSERT INTO junction (performer_id, performance_id, attendance, checkedInAt, groupId, role, instrument, notes) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+				j.PerformerId, j.PerformanceId, j.Attendance, nullableTime(j.CheckedInAt), nullableId(j.GroupId), j.Role, j.Instrument, j.Notes)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, r := range doc.Riders {
+			if r.UpdatedAt.IsZero() {
+				r.UpdatedAt = time.Now()
+			}
+			r.UpdatedAt = r.UpdatedAt.UTC()
+			err := tx.insertRider(r)
+			if err != nil {
+				return err
+			}
+		}
+
+		err := tx.rebuildSearchIndex()
+		if err != nil {
+			return err
+		}
+
+		// the log itself is kept, so this entry marks where the restored data starts
+		summary := map[string]interface{}{
+			"exportedAt":   doc.ExportedAt,
+			"editions":     len(doc.Editions),
+			"locations":    len(doc.Locations),
+			"genres":       len(doc.Genres),
+			"groups":       len(doc.Groups),
+			"performances": len(doc.Performances),
+			"performers":   len(doc.Performers),
+			"junctions":    len(doc.Junctions),
+			"riders":       len(doc.Riders),
+		}
+		return tx.audit(auditEntityDatabase, "", auditActionRestore, nil, summary)
+	})
+}
+
+// exports from before rows had versions don't include them, so their rows start again at 1
+func restoredVersion(version int) int {
+	if version < 1 {
+		return 1
+	}
+	return version
+}
+
+// returned by Restore when the document itself is invalid
+type RestoreError struct {
+	err error
+}
+
+func (e *RestoreError) Error() string {
+	return "invalid export document: " + e.err.Error()
+}
+
+// Handles requests for exporting the whole db
+func (api *API) ExportHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		api.Export(w, r)
+	}
+}
+
+// Handles requests for restoring the whole db
+func (api *API) RestoreHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		api.Restore(w, r)
+	}
+}
+
+// GET /export - returns a snapshot of the whole db
+func (api *API) Export(w http.ResponseWriter, r *http.Request) {
+	doc, err := api.wrapper.Export()
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Export failed")
+		return
+	}
+
+	filename := fmt.Sprintf("foc-export-%s.json", doc.ExportedAt.Format("2006-01-02"))
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	api.respondJSON(w, http.StatusOK, doc)
+}
+
+// POST /restore - replaces the whole db with the snapshot in the body
+func (api *API) Restore(w http.ResponseWriter, r *http.Request) {
+	var doc ExportDocument
+
+	err := json.NewDecoder(r.Body).Decode(&doc)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	err = api.wrapperFor(r).Restore(&doc)
+	var restoreErr *RestoreError
+	if errors.As(err, &restoreErr) {
+		api.respondError(w, http.StatusUnprocessableEntity, restoreErr.Error())
+		return
+	}
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Restore failed")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
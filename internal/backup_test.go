@@ -0,0 +1,234 @@
+package internal_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	internal "foc_api/internal"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportAndRestore(t *testing.T) {
+	// arrange
+	source := setUpTestDB(t)
+	defer source.Close()
+	sourceDbw := internal.CreateDBWrapper(source)
+
+	performer, err := sourceDbw.CreatePerformer(getTestPerformer())
+	require.NoError(t, err, "CreatePerformer() failed: %v", err)
+	edition, err := sourceDbw.CreateEdition(&internal.Edition{Name: "2025", Current: true})
+	require.NoError(t, err, "CreateEdition() failed: %v", err)
+
+	start := time.Date(2025, 9, 1, 18, 0, 0, 0, time.UTC)
+	// the kept performance brings a genre and a group along with it
+	kept := getTestPerformance()
+	kept.StartTime = start
+	kept.EndTime = start.Add(5 * time.Minute)
+	kept, err = sourceDbw.CreatePerformance(kept)
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+	deleted := createTestPerformance(t, sourceDbw, "Deleted", "Deleted Stage", start, 5*time.Minute)
+	err = sourceDbw.UpdateGenreById(kept.GenreId, &internal.Genre{Name: kept.GenreName, Aliases: []string{"Test Alias"}})
+	require.NoError(t, err, "UpdateGenreById() failed: %v", err)
+
+	err = sourceDbw.CreateJunction(performer.Id, kept.Id)
+	require.NoError(t, err, "CreateJunction() failed: %v", err)
+	_, err = sourceDbw.CheckInPerformer(performer.Id, kept.Id, "present", start)
+	require.NoError(t, err, "CheckInPerformer() failed: %v", err)
+	checkIn, err := sourceDbw.UpdateJunction(performer.Id, kept.Id, &internal.JunctionDetails{Role: "leader", Instrument: "Drums"})
+	require.NoError(t, err, "UpdateJunction() failed: %v", err)
+	_, err = sourceDbw.SaveRider(kept.Id, &internal.TechRider{Inputs: []*internal.RiderInput{{Name: "Vocal", Kind: "mic"}}})
+	require.NoError(t, err, "SaveRider() failed: %v", err)
+	rider, err := sourceDbw.GetRider(kept.Id)
+	require.NoError(t, err, "GetRider() failed: %v", err)
+	err = sourceDbw.DeletePerformanceById(deleted.Id)
+	require.NoError(t, err, "DeletePerformanceById() failed: %v", err)
+	err = sourceDbw.UpdateGroupById(kept.GroupId, &internal.Group{Name: kept.GroupName, MemberIds: []int{performer.Id}})
+	require.NoError(t, err, "UpdateGroupById() failed: %v", err)
+
+	// act
+	doc, err := sourceDbw.Export()
+	require.NoError(t, err, "Export() failed: %v", err)
+
+	target := setUpTestDB(t)
+	defer target.Close()
+	targetDbw := internal.CreateDBWrapper(target)
+
+	// whatever was in the target beforehand gets replaced
+	_, err = targetDbw.CreatePerformer(&internal.Performer{Name: "Stale", Email: "stale@test.com"})
+	require.NoError(t, err, "CreatePerformer() failed: %v", err)
+
+	err = targetDbw.Restore(doc)
+	require.NoError(t, err, "Restore() failed: %v", err)
+
+	// assert
+	require.Len(t, doc.Performances, 2)
+	assert.True(t, doc.Performances[1].Deleted, "Soft-deleted performance not flagged in export")
+
+	performers, err := targetDbw.GetAllPerformers()
+	require.NoError(t, err, "GetAllPerformers() failed: %v", err)
+	assert.Equal(t, []*internal.Performer{performer}, performers)
+
+	performances, err := targetDbw.GetPerformancesByPerformerId(performer.Id)
+	require.NoError(t, err, "GetPerformancesByPerformerId() failed: %v", err)
+	require.Len(t, performances, 1)
+	assert.Equal(t, kept.Id, performances[0].Id)
+	assert.True(t, kept.StartTime.Equal(performances[0].StartTime), "StartTime not restored")
+	assert.Equal(t, edition.Id, performances[0].EditionId, "EditionId not restored")
+
+	assert.Equal(t, kept.GenreId, performances[0].GenreId, "GenreId not restored")
+
+	genres, err := targetDbw.GetAllGenres()
+	require.NoError(t, err, "GetAllGenres() failed: %v", err)
+	require.Len(t, genres, 1)
+	assert.Equal(t, []string{"Test Alias"}, genres[0].Aliases, "Genre aliases not restored")
+
+	group, err := targetDbw.GetGroupById(kept.GroupId)
+	require.NoError(t, err, "GetGroupById() failed: %v", err)
+	require.NotNil(t, group, "Group not restored")
+	assert.Equal(t, []int{performer.Id}, group.MemberIds, "Group members not restored")
+
+	current, err := targetDbw.GetCurrentEdition()
+	require.NoError(t, err, "GetCurrentEdition() failed: %v", err)
+	assert.Equal(t, edition, current)
+
+	junction, err := targetDbw.GetJunction(performer.Id, kept.Id)
+	require.NoError(t, err, "GetJunction() failed: %v", err)
+	assert.Equal(t, checkIn, junction, "Check-in and role not restored")
+
+	restoredRider, err := targetDbw.GetRider(kept.Id)
+	require.NoError(t, err, "GetRider() failed: %v", err)
+	assert.Equal(t, rider, restoredRider, "Tech rider not restored")
+
+	restoredDeleted, err := targetDbw.GetPerformanceById(deleted.Id)
+	require.NoError(t, err, "GetPerformanceById() failed: %v", err)
+	assert.Nil(t, restoredDeleted, "Soft-deleted performance restored as live")
+}
+
+func TestRestoreRejectsDanglingJunction(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	existing, err := dbw.CreatePerformer(getTestPerformer())
+	require.NoError(t, err, "CreatePerformer() failed: %v", err)
+
+	doc, err := dbw.Export()
+	require.NoError(t, err, "Export() failed: %v", err)
+	doc.Junctions = append(doc.Junctions, &internal.ExportedJunction{PerformerId: existing.Id, PerformanceId: 42})
+
+	// act
+	err = dbw.Restore(doc)
+
+	// assert
+	var restoreErr *internal.RestoreError
+	require.ErrorAs(t, err, &restoreErr, "Dangling junction was not rejected")
+
+	actual, err := dbw.GetPerformerById(existing.Id)
+	require.NoError(t, err, "GetPerformerById() failed: %v", err)
+	assert.Equal(t, existing, actual, "Failed restore changed the data")
+}
+
+func TestRestoreEndpointRejectsInvalidRows(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+	api := internal.NewAPI(dbw)
+
+	start := time.Date(2025, 9, 1, 18, 0, 0, 0, time.UTC)
+	cases := map[string]*internal.ExportDocument{
+		"performer email":   {Version: 1, Performers: []*internal.ExportedPerformer{{Performer: internal.Performer{Id: 1, Name: "Someone", Email: "not-an-email"}}}},
+		"performer name":    {Version: 1, Performers: []*internal.ExportedPerformer{{Performer: internal.Performer{Id: 1, Name: strings.Repeat("x", 500), Email: "someone@test.com"}}}},
+		"performance times": {Version: 1, Performances: []*internal.ExportedPerformance{{Performance: internal.Performance{Id: 1, ItemName: "Act One", StartTime: start, EndTime: start.Add(-time.Hour)}}}},
+		"location names": {Version: 1, Locations: []*internal.ExportedLocation{
+			{Location: internal.Location{Id: 1, Name: "Main Stage"}},
+			{Location: internal.Location{Id: 2, Name: "main stage"}},
+		}},
+		"genre names": {Version: 1, Genres: []*internal.ExportedGenre{
+			{Genre: internal.Genre{Id: 1, Name: "Jazz"}},
+			{Genre: internal.Genre{Id: 2, Name: "Jazz"}},
+		}},
+		"group names": {Version: 1, Groups: []*internal.ExportedGroup{
+			{Group: internal.Group{Id: 1, Name: "The Band"}},
+			{Group: internal.Group{Id: 2, Name: "The Band"}},
+		}},
+	}
+
+	for name, doc := range cases {
+		body, _ := json.Marshal(doc)
+		r := httptest.NewRequest("POST", "/restore", bytes.NewBuffer(body))
+		w := httptest.NewRecorder()
+
+		// act
+		api.RestoreHandler(w, r)
+
+		// assert
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code, "Invalid %s returned status %v: %s", name, w.Code, w.Body.String())
+	}
+
+	// a deleted row's name is free to use again
+	doc := &internal.ExportDocument{Version: 1, Groups: []*internal.ExportedGroup{
+		{Group: internal.Group{Id: 1, Name: "The Band"}, Deleted: true},
+		{Group: internal.Group{Id: 2, Name: "The Band"}},
+	}}
+	assert.NoError(t, dbw.Restore(doc))
+}
+
+func TestRestoreEndpointRejectsNewerVersion(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+	api := internal.NewAPI(dbw)
+
+	body, _ := json.Marshal(map[string]int{"version": 99})
+	r := httptest.NewRequest("POST", "/restore", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+
+	// act
+	api.RestoreHandler(w, r)
+
+	// assert
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code, "RestoreHandler() returned status %v", w.Code)
+}
+
+func TestRestoreEndpointIsAudited(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+	api := internal.NewAPI(dbw)
+	handler := api.AuthMiddleware(http.HandlerFunc(api.RestoreHandler))
+
+	admin, adminKey, err := dbw.CreateUser(&internal.User{Name: "Admin", Role: internal.RoleAdmin})
+	require.NoError(t, err, "CreateUser() failed: %v", err)
+	_, err = dbw.CreatePerformance(getTestPerformance())
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+	doc, err := dbw.Export()
+	require.NoError(t, err, "Export() failed: %v", err)
+
+	body, _ := json.Marshal(doc)
+	r := httptest.NewRequest("POST", "/restore", bytes.NewBuffer(body))
+	r.Header.Set("X-API-Key", adminKey)
+	w := httptest.NewRecorder()
+
+	// act
+	handler.ServeHTTP(w, r)
+
+	// assert
+	require.Equal(t, http.StatusOK, w.Code, "RestoreHandler() returned status %v: %s", w.Code, w.Body.String())
+	entries, _, err := dbw.ListAuditEntries(url.Values{"action": {"restore"}})
+	require.NoError(t, err, "ListAuditEntries() failed: %v", err)
+	require.Len(t, entries, 1, "The restore should be recorded")
+	assert.Equal(t, "database", entries[0].Entity)
+	assert.Equal(t, fmt.Sprintf("user:%d", admin.Id), entries[0].Actor)
+}
@@ -0,0 +1,208 @@
+package internal
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// what a performer can be checked in as
+const (
+	attendancePresent = "present"
+	attendanceAbsent  = "absent"
+)
+
+// Stamps the time the performance with the given id actually started
+func (dbw *DBWrapper) StartPerformance(id int, at time.Time) (*Performance, error) {
+	return dbw.stampPerformance(id, func(p *Performance, v *validator) {
+		if !p.ActualEndTime.IsZero() && !at.Before(p.ActualEndTime) {
+			v.add("at", validationInvalid, "must be before the performance finished")
+		}
+		p.ActualStartTime = at
+	})
+}
+
+// Stamps the time the performance with the given id actually finished. it has to have started first
+func (dbw *DBWrapper) FinishPerformance(id int, at time.Time) (*Performance, error) {
+	return dbw.stampPerformance(id, func(p *Performance, v *validator) {
+		if p.ActualStartTime.IsZero() {
+			v.add("at", validationInvalid, "cannot be set before the performance has started")
+		} else if !at.After(p.ActualStartTime) {
+			v.add("at", validationInvalid, "must be after the performance started")
+		}
+		p.ActualEndTime = at
+	})
+}
+
+// applies stamp to the performance and saves its actual times. stamp adds to the validator if
+// the new time doesn't make sense
+func (dbw *DBWrapper) stampPerformance(id int, stamp func(p *Performance, v *validator)) (*Performance, error) {
+	var after *Performance
+	err := dbw.InTransaction(func(tx *DBWrapper) error {
+		before, err := tx.GetPerformanceById(id)
+		if err != nil {
+			return err
+		}
+		if before == nil {
+			return sql.ErrNoRows
+		}
+
+		p := *before
+		v := &validator{}
+		stamp(&p, v)
+		if err := v.err(); err != nil {
+			return err
+		}
+		normalisePerformanceTimes(&p)
+
+		dbQuery := `
+			UPDATE performances
+			SET actualStartTime = ?, actualEndTime = ?, version = version + 1
+			WHERE id = ?
+			RETURNING version
+		`
+		err = tx.db.QueryRow(dbQuery, p.ActualStartTime, p.ActualEndTime, id).Scan(&p.Version)
+		if err != nil {
+			return err
+		}
+
+		after = &p
+		return tx.audit(auditEntityPerformance, strconv.Itoa(id), auditActionUpdate, before, after)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return after, nil
+}
+
+// records whether the performer turned up for the performance. returns sql.ErrNoRows if the
+// performer isn't booked for it
+func (dbw *DBWrapper) CheckInPerformer(performerId, performanceId int, attendance string, at time.Time) (*ExportedJunction, error) {
+	if attendance != attendancePresent && attendance != attendanceAbsent {
+		v := &validator{}
+		v.add("attendance", validationInvalid, "must be present or absent")
+		return nil, v.err()
+	}
+
+	var after *ExportedJunction
+	err := dbw.InTransaction(func(tx *DBWrapper) error {
+		before, err := tx.GetJunction(performerId, performanceId)
+		if err != nil {
+			return err
+		}
+		if before == nil {
+			return sql.ErrNoRows
+		}
+
+		j := *before
+		j.Attendance = attendance
+		j.CheckedInAt = at.UTC()
+
+		_, err = tx.db.Exec(`UPDATE junction SET attendance = ?, checkedInAt = ? WHERE performer_id = ? AND performance_id = ?`,
+			j.Attendance, j.CheckedInAt, performerId, performanceId)
+		if err != nil {
+			return err
+		}
+
+		after = &j
+		return tx.audit(auditEntityJunction, junctionAuditId(performerId, performanceId), auditActionUpdate, before, after)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return after, nil
+}
+
+// the body of a start or finish request
+type stampRequest struct {
+	// when it happened. defaults to now
+	At time.Time `json:"at"`
+}
+
+// POST /performances/:id/start - stamps when the performance actually started
+func (api *API) StartPerformance(w http.ResponseWriter, r *http.Request) {
+	api.stampPerformance(w, r, api.wrapperFor(r).StartPerformance)
+}
+
+// POST /performances/:id/finish - stamps when the performance actually finished
+func (api *API) FinishPerformance(w http.ResponseWriter, r *http.Request) {
+	api.stampPerformance(w, r, api.wrapperFor(r).FinishPerformance)
+}
+
+func (api *API) stampPerformance(w http.ResponseWriter, r *http.Request, stamp func(id int, at time.Time) (*Performance, error)) {
+	// the body is optional, since most of the time it's happening now
+	var body stampRequest
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil && err != io.EOF {
+		api.respondError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	id, err := api.extractId(r.URL.Path)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid ID provided")
+		return
+	}
+
+	at := body.At
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	p, err := stamp(id, at)
+	if api.respondIfInvalid(w, err) {
+		return
+	}
+	if err == sql.ErrNoRows {
+		api.respondError(w, http.StatusNotFound, "Performance Not Found")
+		return
+	}
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Error updating performance")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, p)
+}
+
+// POST /junctions/:performerId/:performanceId/checkin - records whether the performer turned up
+func (api *API) CheckInPerformer(w http.ResponseWriter, r *http.Request) {
+	body := struct {
+		Attendance string    `json:"attendance"`
+		At         time.Time `json:"at"`
+	}{}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	performerId, performanceId, err := api.extractJunctionIds(r.URL.Path)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid ID provided")
+		return
+	}
+
+	at := body.At
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	junction, err := api.wrapperFor(r).CheckInPerformer(performerId, performanceId, body.Attendance, at)
+	if api.respondIfInvalid(w, err) {
+		return
+	}
+	if err == sql.ErrNoRows {
+		api.respondError(w, http.StatusNotFound, "Junction Not Found")
+		return
+	}
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Error checking in performer")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, junction)
+}
@@ -0,0 +1,135 @@
+package internal_test
+
+import (
+	"encoding/json"
+	internal "foc_api/internal"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartAndFinishPerformance(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	start := time.Date(2025, 9, 1, 18, 0, 0, 0, time.UTC)
+	p := createTestPerformance(t, dbw, "Act One", "Main Stage", start, 30*time.Minute)
+
+	// act
+	_, finishEarlyErr := dbw.FinishPerformance(p.Id, start)
+	started, err := dbw.StartPerformance(p.Id, start.Add(4*time.Minute))
+	require.NoError(t, err, "StartPerformance() failed: %v", err)
+	_, finishBeforeStartErr := dbw.FinishPerformance(p.Id, start)
+	finished, err := dbw.FinishPerformance(p.Id, start.Add(40*time.Minute))
+	require.NoError(t, err, "FinishPerformance() failed: %v", err)
+
+	// assert
+	assert.IsType(t, &internal.ValidationError{}, finishEarlyErr, "Finishing before starting should be rejected")
+	assert.IsType(t, &internal.ValidationError{}, finishBeforeStartErr, "Finishing before the start time should be rejected")
+	assert.Equal(t, p.Version+1, started.Version)
+
+	stored, err := dbw.GetPerformanceById(p.Id)
+	require.NoError(t, err, "GetPerformanceById() failed: %v", err)
+	assert.Equal(t, finished, stored)
+	assert.True(t, start.Add(4*time.Minute).Equal(stored.ActualStartTime), "Actual start not saved")
+	assert.True(t, start.Add(40*time.Minute).Equal(stored.ActualEndTime), "Actual end not saved")
+	assert.True(t, start.Equal(stored.StartTime), "Scheduled times should be left alone")
+}
+
+func TestStartPerformanceEndpointDefaultsToNow(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+	api := internal.NewAPI(dbw)
+
+	createTestPerformance(t, dbw, "Act One", "Main Stage", time.Now().Add(-time.Minute), 30*time.Minute)
+
+	r := httptest.NewRequest("POST", "/performances/1/start", nil)
+	w := httptest.NewRecorder()
+	before := time.Now()
+
+	// act
+	api.PerformanceHandler(w, r)
+
+	// assert
+	require.Equal(t, http.StatusOK, w.Code, "PerformanceHandler() returned status %v", w.Code)
+	var started internal.Performance
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&started))
+	assert.False(t, started.ActualStartTime.Before(before.Truncate(time.Second)), "Actual start should default to now")
+	assert.True(t, started.ActualEndTime.IsZero())
+}
+
+func TestCheckInPerformer(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	start := time.Date(2025, 9, 1, 18, 0, 0, 0, time.UTC)
+	performer, err := dbw.CreatePerformer(getTestPerformer())
+	require.NoError(t, err, "CreatePerformer() failed: %v", err)
+	p := createTestPerformance(t, dbw, "Act One", "Main Stage", start, 30*time.Minute)
+	require.NoError(t, dbw.CreateJunction(performer.Id, p.Id))
+
+	// act
+	junction, err := dbw.CheckInPerformer(performer.Id, p.Id, "absent", start)
+	require.NoError(t, err, "CheckInPerformer() failed: %v", err)
+	_, invalidErr := dbw.CheckInPerformer(performer.Id, p.Id, "late", start)
+	_, missingErr := dbw.CheckInPerformer(performer.Id, p.Id+1, "present", start)
+
+	// assert
+	assert.Equal(t, "absent", junction.Attendance)
+	assert.True(t, start.Equal(junction.CheckedInAt))
+
+	stored, err := dbw.GetJunction(performer.Id, p.Id)
+	require.NoError(t, err, "GetJunction() failed: %v", err)
+	assert.Equal(t, junction, stored)
+
+	assert.IsType(t, &internal.ValidationError{}, invalidErr)
+	assert.Error(t, missingErr, "Checking in a performer who isn't booked should fail")
+}
+
+func TestCheckInEndpoint(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+	api := internal.NewAPI(dbw)
+
+	performer, err := dbw.CreatePerformer(getTestPerformer())
+	require.NoError(t, err, "CreatePerformer() failed: %v", err)
+	p := createTestPerformance(t, dbw, "Act One", "Main Stage", time.Date(2025, 9, 1, 18, 0, 0, 0, time.UTC), 30*time.Minute)
+	require.NoError(t, dbw.CreateJunction(performer.Id, p.Id))
+
+	cases := []struct {
+		path, body string
+		expected   int
+	}{
+		{"/junctions/1/1/checkin", `{"attendance": "present"}`, http.StatusOK},
+		{"/junctions/1/1/checkin", `{"attendance": "maybe"}`, http.StatusUnprocessableEntity},
+		{"/junctions/1/999/checkin", `{"attendance": "present"}`, http.StatusNotFound},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest("POST", c.path, strings.NewReader(c.body))
+		w := httptest.NewRecorder()
+
+		// act
+		api.JunctionHandler(w, r)
+
+		// assert
+		assert.Equal(t, c.expected, w.Code, "POST %s %s returned the wrong status", c.path, c.body)
+	}
+
+	stored, err := dbw.GetJunction(performer.Id, p.Id)
+	require.NoError(t, err, "GetJunction() failed: %v", err)
+	assert.Equal(t, "present", stored.Attendance)
+}
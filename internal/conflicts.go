@@ -0,0 +1,131 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// a performer booked into two performances that overlap in time
+type Conflict struct {
+	PerformerId int          `json:"performerId"`
+	Performance *Performance `json:"performance"`
+	ClashesWith *Performance `json:"clashesWith"`
+}
+
+// returned by DBWrapper methods that refuse to double-book a performer
+type ConflictError struct {
+	Conflicts []*Conflict
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("schedule conflict: %d clashing booking(s)", len(e.Conflicts))
+}
+
+// sets the minimum gap required between two performances of the same performer
+func (dbw *DBWrapper) SetChangeoverBuffer(buffer time.Duration) {
+	dbw.changeoverBuffer = buffer
+}
+
+// reports whether two performances overlap once the changeover buffer is taken into account.
+// performances without both times set haven't been scheduled yet, so they never clash
+func overlaps(a, b *Performance, buffer time.Duration) bool {
+	if !isScheduled(a) || !isScheduled(b) {
+		return false
+	}
+	return a.StartTime.Before(b.EndTime.Add(buffer)) && b.StartTime.Before(a.EndTime.Add(buffer))
+}
+
+func isScheduled(p *Performance) bool {
+	return !p.StartTime.IsZero() && !p.EndTime.IsZero()
+}
+
+// returns the clashes the performer would have if they were booked into candidate
+func (dbw *DBWrapper) FindPerformerConflicts(performerId int, candidate *Performance) ([]*Conflict, error) {
+	booked, err := dbw.GetPerformancesByPerformerId(performerId)
+	if err != nil {
+		return nil, err
+	}
+
+	conflicts := []*Conflict{}
+	for _, other := range booked {
+		// a performance can't clash with itself
+		if other.Id == candidate.Id {
+			continue
+		}
+		if overlaps(candidate, other, dbw.changeoverBuffer) {
+			conflicts = append(conflicts, &Conflict{PerformerId: performerId, Performance: candidate, ClashesWith: other})
+		}
+	}
+
+	return conflicts, nil
+}
+
+// returns every clash across the whole programme, each pair reported once per performer
+func (dbw *DBWrapper) GetAllConflicts() ([]*Conflict, error) {
+	performers, err := dbw.GetAllPerformers()
+	if err != nil {
+		return nil, err
+	}
+
+	performerIds := []int{}
+	for _, performer := range performers {
+		performerIds = append(performerIds, performer.Id)
+	}
+	return dbw.getConflictsForPerformers(performerIds)
+}
+
+// returns every clash the given performers have, each pair reported once per performer
+func (dbw *DBWrapper) getConflictsForPerformers(performerIds []int) ([]*Conflict, error) {
+	conflicts := []*Conflict{}
+	for _, performerId := range performerIds {
+		booked, err := dbw.GetPerformancesByPerformerId(performerId)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range booked {
+			for j := i + 1; j < len(booked); j++ {
+				if overlaps(booked[i], booked[j], dbw.changeoverBuffer) {
+					conflicts = append(conflicts, &Conflict{PerformerId: performerId, Performance: booked[i], ClashesWith: booked[j]})
+				}
+			}
+		}
+	}
+
+	return conflicts, nil
+}
+
+// Handles requests related to schedule conflicts
+func (api *API) ConflictHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		api.GetAllConflicts(w, r)
+	}
+}
+
+// GET /conflicts - returns every double-booked performer in the programme
+func (api *API) GetAllConflicts(w http.ResponseWriter, r *http.Request) {
+	conflicts, err := api.wrapper.GetAllConflicts()
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Unable to check conflicts")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, map[string][]*Conflict{"conflicts": conflicts})
+}
+
+// responds with a 409 listing the clashes if err is a ConflictError, and reports whether it did
+func (api *API) respondIfConflict(w http.ResponseWriter, err error) bool {
+	var conflictErr *ConflictError
+	if !errors.As(err, &conflictErr) {
+		return false
+	}
+
+	api.respondJSON(w, http.StatusConflict, map[string]interface{}{
+		"error":     "Schedule conflict",
+		"conflicts": conflictErr.Conflicts,
+	})
+	return true
+}
@@ -0,0 +1,172 @@
+package internal_test
+
+import (
+	"bytes"
+	"encoding/json"
+	internal "foc_api/internal"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateJunctionRejectsOverlap(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	performer, err := dbw.CreatePerformer(getTestPerformer())
+	require.NoError(t, err, "CreatePerformer() failed: %v", err)
+
+	start := time.Date(2025, 9, 1, 18, 0, 0, 0, time.UTC)
+	first := createTestPerformance(t, dbw, "First", "First Stage", start, 10*time.Minute)
+	second := createTestPerformance(t, dbw, "Second", "Second Stage", start.Add(5*time.Minute), 10*time.Minute)
+
+	err = dbw.CreateJunction(performer.Id, first.Id)
+	require.NoError(t, err, "CreateJunction() failed: %v", err)
+
+	// act
+	err = dbw.CreateJunction(performer.Id, second.Id)
+
+	// assert
+	var conflictErr *internal.ConflictError
+	require.ErrorAs(t, err, &conflictErr, "Overlapping junction was not rejected")
+	require.Len(t, conflictErr.Conflicts, 1)
+	assert.Equal(t, first.Id, conflictErr.Conflicts[0].ClashesWith.Id)
+}
+
+func TestCreateJunctionRespectsChangeoverBuffer(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	performer, err := dbw.CreatePerformer(getTestPerformer())
+	require.NoError(t, err, "CreatePerformer() failed: %v", err)
+
+	start := time.Date(2025, 9, 1, 18, 0, 0, 0, time.UTC)
+	first := createTestPerformance(t, dbw, "First", "First Stage", start, 10*time.Minute)
+	second := createTestPerformance(t, dbw, "Second", "Second Stage", start.Add(12*time.Minute), 10*time.Minute)
+
+	err = dbw.CreateJunction(performer.Id, first.Id)
+	require.NoError(t, err, "CreateJunction() failed: %v", err)
+
+	// back to back with a 2 minute gap is fine without a buffer...
+	err = dbw.CreateJunction(performer.Id, second.Id)
+	require.NoError(t, err, "CreateJunction() rejected performances that don't overlap: %v", err)
+	err = dbw.DeleteJunction(performer.Id, second.Id)
+	require.NoError(t, err)
+
+	// act
+	// ...but not with a 5 minute one
+	dbw.SetChangeoverBuffer(5 * time.Minute)
+	err = dbw.CreateJunction(performer.Id, second.Id)
+
+	// assert
+	var conflictErr *internal.ConflictError
+	assert.ErrorAs(t, err, &conflictErr, "Junction inside the changeover buffer was not rejected")
+}
+
+func TestUpdatePerformanceRejectsOverlap(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	performer, err := dbw.CreatePerformer(getTestPerformer())
+	require.NoError(t, err, "CreatePerformer() failed: %v", err)
+
+	start := time.Date(2025, 9, 1, 18, 0, 0, 0, time.UTC)
+	first := createTestPerformance(t, dbw, "First", "First Stage", start, 10*time.Minute)
+	second := createTestPerformance(t, dbw, "Second", "Second Stage", start.Add(time.Hour), 10*time.Minute)
+
+	for _, p := range []*internal.Performance{first, second} {
+		err = dbw.CreateJunction(performer.Id, p.Id)
+		require.NoError(t, err, "CreateJunction() failed: %v", err)
+	}
+
+	// act
+	moved := *second
+	moved.StartTime = start.Add(5 * time.Minute)
+	moved.EndTime = moved.StartTime.Add(10 * time.Minute)
+	err = dbw.UpdatePerformanceById(second.Id, &moved)
+
+	// assert
+	var conflictErr *internal.ConflictError
+	require.ErrorAs(t, err, &conflictErr, "Overlapping update was not rejected")
+
+	actual, err := dbw.GetPerformanceById(second.Id)
+	require.NoError(t, err)
+	assert.True(t, second.StartTime.Equal(actual.StartTime), "Performance was moved despite the conflict")
+}
+
+func TestGetAllConflicts(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	performer, err := dbw.CreatePerformer(getTestPerformer())
+	require.NoError(t, err, "CreatePerformer() failed: %v", err)
+
+	start := time.Date(2025, 9, 1, 18, 0, 0, 0, time.UTC)
+	first := createTestPerformance(t, dbw, "First", "First Stage", start, 10*time.Minute)
+	second := createTestPerformance(t, dbw, "Second", "Second Stage", start.Add(20*time.Minute), 10*time.Minute)
+
+	for _, p := range []*internal.Performance{first, second} {
+		err = dbw.CreateJunction(performer.Id, p.Id)
+		require.NoError(t, err, "CreateJunction() failed: %v", err)
+	}
+
+	// a buffer introduced after booking turns the pair into a clash
+	dbw.SetChangeoverBuffer(15 * time.Minute)
+
+	// act
+	conflicts, err := dbw.GetAllConflicts()
+
+	// assert
+	require.NoError(t, err, "GetAllConflicts() failed: %v", err)
+	require.Len(t, conflicts, 1)
+	assert.Equal(t, performer.Id, conflicts[0].PerformerId)
+	assert.Equal(t, first.Id, conflicts[0].Performance.Id)
+	assert.Equal(t, second.Id, conflicts[0].ClashesWith.Id)
+}
+
+func TestCreateJunctionEndpointReturnsConflict(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+	api := internal.NewAPI(dbw)
+
+	performer, err := dbw.CreatePerformer(getTestPerformer())
+	require.NoError(t, err, "CreatePerformer() failed: %v", err)
+
+	start := time.Date(2025, 9, 1, 18, 0, 0, 0, time.UTC)
+	first := createTestPerformance(t, dbw, "First", "First Stage", start, 10*time.Minute)
+	second := createTestPerformance(t, dbw, "Second", "Second Stage", start, 10*time.Minute)
+
+	err = dbw.CreateJunction(performer.Id, first.Id)
+	require.NoError(t, err, "CreateJunction() failed: %v", err)
+
+	body, _ := json.Marshal(map[string]int{"performerId": performer.Id, "performanceId": second.Id})
+	r := httptest.NewRequest("POST", "/junctions", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+
+	// act
+	api.CreateJunction(w, r)
+
+	// assert
+	assert.Equal(t, http.StatusConflict, w.Code, "CreateJunction() handler returned status %v", w.Code)
+
+	response := struct {
+		Conflicts []*internal.Conflict `json:"conflicts"`
+	}{}
+	err = json.NewDecoder(w.Body).Decode(&response)
+	require.NoError(t, err, "Error decoding response from endpoint: %v", err)
+	assert.Len(t, response.Conflicts, 1)
+}
@@ -3,7 +3,6 @@ package internal
 import (
 	"database/sql"
 	"errors"
-	"fmt"
 
 	_ "modernc.org/sqlite"
 )
@@ -26,62 +25,10 @@ func InitDB(filepath string) (*sql.DB, error) {
 		return nil, errors.New("error communicating with the database")
 	}
 
-	err = createTables(db)
+	// brings the schema up to date, refusing to run against a db from a newer binary
+	err = Migrate(db)
 	if err != nil {
 		return nil, err
 	}
 	return db, nil
 }
-
-func createTables(db *sql.DB) error {
-	createPerformancesString := `
-		CREATE TABLE IF NOT EXISTS performances (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			itemName TEXT NOT NULL,
-			genreName TEXT NOT NULL,
-			groupName TEXT NOT NULL,
-			location TEXT NOT NULL,
-			startTime DATETIME,
-			endTime DATETIME,
-			deleted BOOLEAN DEFAULT 0
-		);
-	`
-
-	createPerformersString := `
-		CREATE TABLE IF NOT EXISTS performers (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			name TEXT NOT NULL,
-			email TEXT NOT NULL,
-			deleted BOOLEAN DEFAULT 0
-		);
-	`
-
-	createJunctionString := `
-		CREATE TABLE IF NOT EXISTS junction (
-			performer_id INTEGER NOT NULL,
-			performance_id INTEGER NOT NULL,
-			PRIMARY KEY (performer_id, performance_id),
-			FOREIGN KEY (performer_id) REFERENCES performers(id),
-			FOREIGN KEY (performance_id) REFERENCES performances(id)
-		);
-	`
-
-	// creates performances table
-	_, err := db.Exec(createPerformancesString)
-	if err != nil {
-		return fmt.Errorf("failed to create performances table: %v", err)
-	}
-
-	// creates performers table
-	_, err = db.Exec(createPerformersString)
-	if err != nil {
-		return fmt.Errorf("failed to create performers table: %v", err)
-	}
-
-	// creates junction table that stores pairs of performers and performances
-	_, err = db.Exec(createJunctionString)
-	if err != nil {
-		return fmt.Errorf("failed to create junctions table: %v", err)
-	}
-	return nil
-}
@@ -3,8 +3,11 @@ package internal_test
 import (
 	"database/sql"
 	internal "foc_api/internal"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	_ "modernc.org/sqlite"
 )
@@ -17,7 +20,13 @@ func setUpTestDB(t *testing.T) *sql.DB {
 }
 
 func TestInitDB(t *testing.T) {
-	result, err := internal.InitDB("../database/db.sqlite")
+	// InitDB migrates the file, so it works on a copy to leave the committed one as it is
+	original, err := os.ReadFile("../database/db.sqlite")
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "db.sqlite")
+	require.NoError(t, os.WriteFile(path, original, 0o644))
+
+	result, err := internal.InitDB(path)
 
 	if err != nil {
 		t.Errorf("InitDB() failed: %v", err)
@@ -28,3 +37,160 @@ func TestInitDB(t *testing.T) {
 		t.Errorf("No open connections to database")
 	}
 }
+
+func TestMigrateRecordsSchemaVersion(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+
+	// act
+	version, err := internal.SchemaVersion(db)
+
+	// assert
+	require.NoError(t, err, "SchemaVersion() failed: %v", err)
+	assert.Equal(t, internal.LatestSchemaVersion(), version, "Schema not migrated to the latest version")
+}
+
+func TestMigrateToRollsBackAndReapplies(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+
+	// act
+	err := internal.MigrateTo(db, 0)
+	require.NoError(t, err, "MigrateTo(0) failed: %v", err)
+
+	// assert
+	var count int
+	err = db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'performances'`).Scan(&count)
+	require.NoError(t, err)
+	assert.Equal(t, 0, count, "performances table still exists after rolling back")
+
+	err = internal.Migrate(db)
+	require.NoError(t, err, "Migrate() failed: %v", err)
+
+	_, err = internal.CreateDBWrapper(db).CreatePerformance(getTestPerformance())
+	assert.NoError(t, err, "CreatePerformance() failed after re-migrating: %v", err)
+}
+
+func TestMigrateRefusesNewerSchema(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+
+	_, err := db.Exec(`INSERT INTO schema_migrations (version, name, appliedAt) VALUES (?, 'from the future', CURRENT_TIMESTAMP)`, internal.LatestSchemaVersion()+1)
+	require.NoError(t, err)
+
+	// act
+	err = internal.Migrate(db)
+
+	// assert
+	assert.Error(t, err, "Migrate() accepted a database newer than the binary")
+}
+
+func TestMigrateRepairsLegacyPerformancesTable(t *testing.T) {
+	// arrange
+	db, err := sql.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	// the performances table as the original createTables accidentally made it, with no deleted column
+	_, err = db.Exec(`
+		CREATE TABLE performances (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			itemName TEXT NOT NULL,
+			genreName TEXT NOT NULL,
+			groupName TEXT NOT NULL,
+			location TEXT NOT NULL,
+			startTime DATETIME,
+			endTime DATETIME
+			deleted BOOLEAN DEFAULT 0
+		);
+		INSERT INTO performances (itemName, genreName, groupName, location, startTime, endTime)
+		VALUES ('Legacy', 'Rock', 'Band', 'Hall', '2025-09-01 18:00:00+00:00', '2025-09-01 18:05:00+00:00');
+	`)
+	require.NoError(t, err)
+
+	// act
+	err = internal.Migrate(db)
+	require.NoError(t, err, "Migrate() failed: %v", err)
+
+	// assert
+	performances, err := internal.CreateDBWrapper(db).GetAllPerformances()
+	require.NoError(t, err, "GetAllPerformances() failed: %v", err)
+	require.Len(t, performances, 1, "Legacy row lost while repairing performances table")
+	assert.Equal(t, "Legacy", performances[0].ItemName)
+
+	edition, err := internal.CreateDBWrapper(db).GetCurrentEdition()
+	require.NoError(t, err, "GetCurrentEdition() failed: %v", err)
+	require.NotNil(t, edition, "Existing performances not put into an edition")
+	assert.Equal(t, "2025", edition.Name)
+	assert.Equal(t, edition.Id, performances[0].EditionId)
+}
+
+func TestMigrateMergesGenreSpellings(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+
+	// rows written by the first schema get every later column filled in on the way up
+	err := internal.MigrateTo(db, 1)
+	require.NoError(t, err, "MigrateTo(1) failed: %v", err)
+	_, err = db.Exec(`
+		INSERT INTO performances (itemName, genreName, groupName, location, startTime, endTime)
+		VALUES ('First', 'Hip Hop', '', '', '2025-09-01 18:00:00+00:00', '2025-09-01 18:05:00+00:00'),
+			('Second', 'hip-hop', '', '', '2025-09-01 19:00:00+00:00', '2025-09-01 19:05:00+00:00'),
+			('Third', 'Jazz', '', '', '2025-09-01 20:00:00+00:00', '2025-09-01 20:05:00+00:00'),
+			('Fourth', '', '', '', '2025-09-01 21:00:00+00:00', '2025-09-01 21:05:00+00:00');
+	`)
+	require.NoError(t, err)
+
+	// act
+	err = internal.Migrate(db)
+	require.NoError(t, err, "Migrate() failed: %v", err)
+
+	// assert
+	dbw := internal.CreateDBWrapper(db)
+	genres, err := dbw.GetAllGenres()
+	require.NoError(t, err, "GetAllGenres() failed: %v", err)
+	require.Len(t, genres, 2, "Spellings of the same genre should be merged")
+	assert.Equal(t, "Hip Hop", genres[0].Name, "First spelling used should win")
+	assert.Equal(t, "Jazz", genres[1].Name)
+
+	performances, err := dbw.GetAllPerformances()
+	require.NoError(t, err, "GetAllPerformances() failed: %v", err)
+	require.Len(t, performances, 4)
+	assert.Equal(t, genres[0].Id, performances[1].GenreId)
+	assert.Equal(t, "Hip Hop", performances[1].GenreName)
+	assert.Equal(t, 0, performances[3].GenreId, "Performances without a genre should be left without one")
+}
+
+func TestMigrateEditionsKeepsUnscheduledPerformances(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+
+	err := internal.MigrateTo(db, 1)
+	require.NoError(t, err, "MigrateTo(1) failed: %v", err)
+	_, err = db.Exec(`
+		INSERT INTO performances (itemName, genreName, groupName, location, startTime, endTime)
+		VALUES ('Scheduled', '', '', '', '2025-09-01 18:00:00+00:00', '2025-09-01 18:05:00+00:00'),
+			('Unscheduled', '', '', '', NULL, NULL);
+	`)
+	require.NoError(t, err)
+
+	// act
+	err = internal.MigrateTo(db, 13)
+	require.NoError(t, err, "MigrateTo(13) failed: %v", err)
+
+	// assert
+	var name string
+	err = db.QueryRow(`SELECT name FROM editions WHERE isCurrent = 1`).Scan(&name)
+	require.NoError(t, err)
+	assert.Equal(t, "2025", name, "Edition should be named after the earliest scheduled performance")
+
+	var unfiled int
+	err = db.QueryRow(`SELECT COUNT(*) FROM performances WHERE editionId IS NULL`).Scan(&unfiled)
+	require.NoError(t, err)
+	assert.Equal(t, 0, unfiled, "Unscheduled performances should go into the edition too")
+}
@@ -0,0 +1,315 @@
+package internal
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// returned when delaying a performance that has no times to shift
+var ErrNotScheduled = errors.New("performance has not been scheduled")
+
+// the performances a delay moved, and the performer clashes it caused that weren't there before
+type DelayResult struct {
+	Shifted   []*Performance `json:"shifted"`
+	Conflicts []*Conflict    `json:"conflicts"`
+}
+
+// Delays everything at a location from the given time on. performances starting at or after from
+// move by delay, and one already running at from overruns, so only its end moves. the times each
+// was planned for are kept the first time it's delayed. performer clashes don't stop the delay,
+// since it's happening either way, but any new ones are returned
+func (dbw *DBWrapper) DelayLocation(locationId int, from time.Time, delay time.Duration, force bool) (*DelayResult, error) {
+	var result *DelayResult
+	err := dbw.InTransaction(func(tx *DBWrapper) error {
+		l, err := tx.GetLocationById(locationId)
+		if err != nil {
+			return err
+		}
+		if l == nil {
+			return sql.ErrNoRows
+		}
+
+		affected, err := tx.GetPerformancesByLocationId(locationId)
+		if err != nil {
+			return err
+		}
+
+		result, err = tx.delayPerformances(affected, from.UTC(), delay, force)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Delays the performance with the given id, along with everything after it at its location
+func (dbw *DBWrapper) DelayPerformance(id int, delay time.Duration, force bool) (*DelayResult, error) {
+	var result *DelayResult
+	err := dbw.InTransaction(func(tx *DBWrapper) error {
+		p, err := tx.GetPerformanceById(id)
+		if err != nil {
+			return err
+		}
+		if p == nil {
+			return sql.ErrNoRows
+		}
+		if !isScheduled(p) {
+			return ErrNotScheduled
+		}
+
+		affected := []*Performance{p}
+		if p.LocationId != 0 {
+			affected, err = tx.GetPerformancesByLocationId(p.LocationId)
+			if err != nil {
+				return err
+			}
+		}
+
+		result, err = tx.delayPerformances(affected, p.StartTime, delay, force)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// shifts the performances that haven't finished by from, which are expected to share a location
+func (dbw *DBWrapper) delayPerformances(performances []*Performance, from time.Time, delay time.Duration, force bool) (*DelayResult, error) {
+	if delay == 0 {
+		v := &validator{}
+		v.add("minutes", validationRequired, "cannot be zero")
+		return nil, v.err()
+	}
+
+	affected := []*Performance{}
+	performerIds := []int{}
+	seen := map[int]bool{}
+	for _, p := range performances {
+		if !isScheduled(p) || !p.EndTime.After(from) {
+			continue
+		}
+		affected = append(affected, p)
+
+		performers, err := dbw.GetPerformersByPerformanceId(p.Id)
+		if err != nil {
+			return nil, err
+		}
+		for _, performer := range performers {
+			if !seen[performer.Id] {
+				seen[performer.Id] = true
+				performerIds = append(performerIds, performer.Id)
+			}
+		}
+	}
+
+	// the clashes there were already, so only the new ones are reported
+	existing, err := dbw.getConflictsForPerformers(performerIds)
+	if err != nil {
+		return nil, err
+	}
+	existingKeys := map[string]bool{}
+	for _, c := range existing {
+		existingKeys[conflictKey(c)] = true
+	}
+
+	result := &DelayResult{Shifted: []*Performance{}, Conflicts: []*Conflict{}}
+	for _, before := range affected {
+		after := *before
+		if !before.StartTime.Before(from) {
+			after.StartTime = before.StartTime.Add(delay)
+		}
+		after.EndTime = before.EndTime.Add(delay)
+		if !after.EndTime.After(after.StartTime) {
+			v := &validator{}
+			v.add("minutes", validationInvalid, fmt.Sprintf("would end %s before it starts", before.ItemName))
+			return nil, v.err()
+		}
+		after.Duration = int(after.EndTime.Sub(after.StartTime) / time.Second)
+		err := dbw.validateDelayed(&after)
+		if err != nil {
+			return nil, err
+		}
+
+		if after.PlannedStartTime.IsZero() {
+			after.PlannedStartTime = before.StartTime
+			after.PlannedEndTime = before.EndTime
+		}
+
+		dbQuery := `
+			UPDATE performances
+			SET startTime = ?, endTime = ?, duration = ?, plannedStartTime = ?, plannedEndTime = ?, version = version + 1
+			WHERE id = ?
+			RETURNING version
+		`
+		err = dbw.db.QueryRow(dbQuery, after.StartTime, after.EndTime, after.Duration, after.PlannedStartTime, after.PlannedEndTime, after.Id).
+			Scan(&after.Version)
+		if err != nil {
+			return nil, err
+		}
+
+		err = dbw.audit(auditEntityPerformance, strconv.Itoa(after.Id), auditActionUpdate, before, &after)
+		if err != nil {
+			return nil, err
+		}
+		result.Shifted = append(result.Shifted, &after)
+	}
+
+	// pulling performances earlier can run them into ones that weren't moved
+	if !force {
+		for _, p := range result.Shifted {
+			err := dbw.checkLocationClashes(p)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	conflicts, err := dbw.getConflictsForPerformers(performerIds)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range conflicts {
+		if !existingKeys[conflictKey(c)] {
+			result.Conflicts = append(result.Conflicts, c)
+		}
+	}
+
+	return result, nil
+}
+
+// checks a delayed performance against the festival's and its edition's times, like an update
+// would. anything wrong is reported against the delay's minutes, since that's what caused it
+func (dbw *DBWrapper) validateDelayed(p *Performance) error {
+	err := dbw.validatePerformance(p)
+	if err == nil {
+		err = dbw.resolveEdition(p, 0)
+	}
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		return err
+	}
+	v := &validator{}
+	for _, fieldErr := range validationErr.Errors {
+		v.add("minutes", fieldErr.Code, fmt.Sprintf("would leave %s with a %s that %s", p.ItemName, fieldErr.Field, fieldErr.Message))
+	}
+	return v.err()
+}
+
+// identifies a clash by who it's for and which two performances are involved
+func conflictKey(c *Conflict) string {
+	return fmt.Sprintf("%d:%d:%d", c.PerformerId, c.Performance.Id, c.ClashesWith.Id)
+}
+
+// the body of a delay request
+type delayRequest struct {
+	Minutes int `json:"minutes"`
+	// when the delay starts, for location delays. defaults to now
+	From time.Time `json:"from"`
+}
+
+// POST /locations/:id/delay - delays everything at the location from now (or the given time) on.
+// the location can be given by name instead, as /locations/name:<name>/delay
+func (api *API) DelayLocation(w http.ResponseWriter, r *http.Request) {
+	var body delayRequest
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	location, ok := api.locationFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	from := body.From
+	if from.IsZero() {
+		from = time.Now()
+	}
+
+	result, err := api.wrapperFor(r).DelayLocation(location.Id, from, time.Duration(body.Minutes)*time.Minute, isForced(r))
+	api.respondWithDelay(w, result, err)
+}
+
+// prefixes a location's name in a path, so a location called "2" isn't mistaken for id 2
+const locationNamePrefix = "name:"
+
+// looks up the location in /locations/:id/..., or /locations/name:<name>/... to go by name.
+// responds with an error and returns false if there isn't one
+func (api *API) locationFromPath(w http.ResponseWriter, r *http.Request) (*Location, bool) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 3 {
+		api.respondError(w, http.StatusBadRequest, "Invalid location")
+		return nil, false
+	}
+
+	var location *Location
+	var err error
+	if name, found := strings.CutPrefix(parts[1], locationNamePrefix); found {
+		location, err = api.wrapper.GetLocationByName(name)
+	} else {
+		id, convErr := strconv.Atoi(parts[1])
+		if convErr != nil {
+			api.respondError(w, http.StatusBadRequest, "Invalid ID")
+			return nil, false
+		}
+		location, err = api.wrapper.GetLocationById(id)
+	}
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Unable to find location")
+		return nil, false
+	}
+	if location == nil {
+		api.respondError(w, http.StatusNotFound, "Location Not Found")
+		return nil, false
+	}
+	return location, true
+}
+
+// POST /performances/:id/delay - delays the performance and everything after it at its location
+func (api *API) DelayPerformance(w http.ResponseWriter, r *http.Request) {
+	var body delayRequest
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	id, err := api.extractId(r.URL.Path)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid ID provided")
+		return
+	}
+
+	result, err := api.wrapperFor(r).DelayPerformance(id, time.Duration(body.Minutes)*time.Minute, isForced(r))
+	if errors.Is(err, ErrNotScheduled) {
+		api.respondError(w, http.StatusBadRequest, "Performance has not been scheduled")
+		return
+	}
+	api.respondWithDelay(w, result, err)
+}
+
+func (api *API) respondWithDelay(w http.ResponseWriter, result *DelayResult, err error) {
+	if api.respondIfInvalid(w, err) || api.respondIfLocationClash(w, err) {
+		return
+	}
+	if err == sql.ErrNoRows {
+		api.respondError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Error delaying performances")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, result)
+}
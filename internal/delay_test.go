@@ -0,0 +1,148 @@
+package internal_test
+
+import (
+	"encoding/json"
+	internal "foc_api/internal"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDelayLocationShiftsLaterPerformances(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	start := time.Date(2025, 9, 1, 18, 0, 0, 0, time.UTC)
+	running := createTestPerformance(t, dbw, "Act One", "Main Stage", start, 10*time.Minute)
+	later := createTestPerformance(t, dbw, "Act Two", "Main Stage", start.Add(15*time.Minute), 10*time.Minute)
+	elsewhere := createTestPerformance(t, dbw, "Side Act", "Side Stage", start.Add(15*time.Minute), 10*time.Minute)
+
+	// act
+	result, err := dbw.DelayLocation(running.LocationId, start.Add(5*time.Minute), 7*time.Minute, false)
+	require.NoError(t, err, "DelayLocation() failed: %v", err)
+
+	// assert
+	assert.Len(t, result.Shifted, 2)
+
+	stored, err := dbw.GetPerformanceById(running.Id)
+	require.NoError(t, err, "GetPerformanceById() failed: %v", err)
+	assert.True(t, start.Equal(stored.StartTime), "Running performance should keep its start")
+	assert.True(t, start.Add(17*time.Minute).Equal(stored.EndTime), "Running performance should overrun")
+	assert.True(t, start.Add(10*time.Minute).Equal(stored.PlannedEndTime), "Planned end should be kept")
+
+	stored, err = dbw.GetPerformanceById(later.Id)
+	require.NoError(t, err, "GetPerformanceById() failed: %v", err)
+	assert.True(t, start.Add(22*time.Minute).Equal(stored.StartTime), "Later performance should move")
+	assert.True(t, start.Add(15*time.Minute).Equal(stored.PlannedStartTime), "Planned start should be kept")
+	assert.Equal(t, 600, stored.Duration, "Moving a performance shouldn't change its length")
+
+	stored, err = dbw.GetPerformanceById(elsewhere.Id)
+	require.NoError(t, err, "GetPerformanceById() failed: %v", err)
+	assert.Equal(t, elsewhere, stored, "Other locations should be left alone")
+}
+
+func TestDelayPerformanceEndpointReportsNewConflicts(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+	api := internal.NewAPI(dbw)
+
+	start := time.Date(2025, 9, 1, 18, 0, 0, 0, time.UTC)
+	delayed := createTestPerformance(t, dbw, "Act Two", "Main Stage", start, 10*time.Minute)
+	next := createTestPerformance(t, dbw, "Side Act", "Side Stage", start.Add(12*time.Minute), 10*time.Minute)
+
+	performer, err := dbw.CreatePerformer(getTestPerformer())
+	require.NoError(t, err, "CreatePerformer() failed: %v", err)
+	require.NoError(t, dbw.CreateJunction(performer.Id, delayed.Id))
+	require.NoError(t, dbw.CreateJunction(performer.Id, next.Id))
+
+	r := httptest.NewRequest("POST", "/performances/1/delay", strings.NewReader(`{"minutes": 5}`))
+	w := httptest.NewRecorder()
+
+	// act
+	api.PerformanceHandler(w, r)
+
+	// assert
+	require.Equal(t, http.StatusOK, w.Code, "PerformanceHandler() returned status %v: %s", w.Code, w.Body.String())
+
+	var result internal.DelayResult
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&result), "Error decoding response from endpoint")
+	require.Len(t, result.Shifted, 1)
+	assert.True(t, start.Add(5*time.Minute).Equal(result.Shifted[0].StartTime))
+	require.Len(t, result.Conflicts, 1, "The delay should have double-booked the performer")
+	assert.Equal(t, performer.Id, result.Conflicts[0].PerformerId)
+}
+
+func TestDelayRejectsMovingPastTheFestival(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	start := time.Date(2025, 9, 1, 18, 0, 0, 0, time.UTC)
+	dbw.SetValidationRules(internal.ValidationRules{FestivalEnd: start.Add(time.Hour)})
+	last := createTestPerformance(t, dbw, "Act One", "Main Stage", start, 50*time.Minute)
+
+	// act
+	_, err := dbw.DelayPerformance(last.Id, 15*time.Minute, false)
+
+	// assert
+	var validationErr *internal.ValidationError
+	require.ErrorAs(t, err, &validationErr, "Delay past the end of the festival was not rejected")
+	assert.Equal(t, "minutes", validationErr.Errors[0].Field)
+	assert.Equal(t, "out_of_range", validationErr.Errors[0].Code)
+
+	stored, err := dbw.GetPerformanceById(last.Id)
+	require.NoError(t, err, "GetPerformanceById() failed: %v", err)
+	assert.Equal(t, last, stored, "Rejected delay shouldn't move anything")
+}
+
+func TestDelayLocationEndpointTellsIdsFromNames(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+	api := internal.NewAPI(dbw)
+
+	start := time.Date(2025, 9, 1, 18, 0, 0, 0, time.UTC)
+	named := createTestPerformance(t, dbw, "Act One", "2", start, time.Hour)
+	numbered := createTestPerformance(t, dbw, "Act Two", "Side Stage", start, time.Hour)
+	require.Equal(t, 2, numbered.LocationId, "Side Stage should have id 2")
+
+	cases := []struct {
+		path          string
+		expected      int
+		performanceId int
+	}{
+		{"/locations/name:2/delay", http.StatusOK, named.Id},
+		{"/locations/2/delay", http.StatusOK, numbered.Id},
+		{"/locations/Side%20Stage/delay", http.StatusBadRequest, 0},
+		{"/locations/name:Nowhere/delay", http.StatusNotFound, 0},
+	}
+
+	for _, c := range cases {
+		body := `{"minutes": 5, "from": "` + start.Format(time.RFC3339) + `"}`
+		r := httptest.NewRequest("POST", c.path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+
+		// act
+		api.LocationHandler(w, r)
+
+		// assert
+		require.Equal(t, c.expected, w.Code, "POST %s returned status %v: %s", c.path, w.Code, w.Body.String())
+		if c.performanceId != 0 {
+			var result internal.DelayResult
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&result))
+			require.Len(t, result.Shifted, 1, "POST %s moved the wrong performances", c.path)
+			assert.Equal(t, c.performanceId, result.Shifted[0].Id, "POST %s moved the wrong location", c.path)
+		}
+	}
+}
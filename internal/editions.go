@@ -0,0 +1,547 @@
+package internal
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// a single run of the festival, e.g. one year's. performances belong to an edition, and so do
+// their junctions through them, while performers are shared so returning acts keep one row
+type Edition struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+	// the edition's performances have to fall between these. zero leaves that end open
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime"`
+	// new performances go into the current edition unless they say otherwise. only one edition
+	// can be current at a time
+	Current bool `json:"current"`
+}
+
+var (
+	ErrDuplicateEdition = errors.New("an edition with that name already exists")
+	ErrEditionInUse     = errors.New("edition still has performances")
+)
+
+// the columns scanEdition expects, for queries that alias editions as e
+const editionColumns = `e.id, e.name, e.startTime, e.endTime, e.isCurrent`
+
+// creates an edition and puts it into the db. if it's current, it takes over from whichever
+// edition was current before
+func (dbw *DBWrapper) CreateEdition(e *Edition) (*Edition, error) {
+	normaliseEdition(e)
+	err := validateEdition(e)
+	if err != nil {
+		return nil, err
+	}
+
+	err = dbw.InTransaction(func(tx *DBWrapper) error {
+		existing, err := tx.GetEditionByName(e.Name)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			return ErrDuplicateEdition
+		}
+
+		if e.Current {
+			err = tx.clearCurrentEdition()
+			if err != nil {
+				return err
+			}
+		}
+
+		dbQuery := `
+			INSERT INTO editions (name, startTime, endTime, isCurrent)
+			VALUES (?, ?, ?, ?)
+			RETURNING id
+		`
+		err = tx.db.QueryRow(dbQuery, e.Name, e.StartTime, e.EndTime, e.Current).Scan(&e.Id)
+		if err != nil {
+			return err
+		}
+
+		return tx.audit(auditEntityEdition, strconv.Itoa(e.Id), auditActionCreate, nil, e)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// returns a slice with all the editions in the db, oldest first
+func (dbw *DBWrapper) GetAllEditions() ([]*Edition, error) {
+	dbQuery := `
+		SELECT ` + editionColumns + `
+		FROM editions AS e
+		WHERE e.deleted = 0
+		ORDER BY e.startTime ASC, e.id ASC
+	`
+
+	rows, err := dbw.db.Query(dbQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	editions := []*Edition{}
+	for rows.Next() {
+		e, err := scanEdition(rows)
+		if err != nil {
+			return nil, err
+		}
+		editions = append(editions, e)
+	}
+
+	return editions, nil
+}
+
+// Return the edition with the given id
+func (dbw *DBWrapper) GetEditionById(id int) (*Edition, error) {
+	return dbw.findEdition(`e.id = ?`, id)
+}
+
+// Return the edition with the given name, ignoring case and surrounding whitespace
+func (dbw *DBWrapper) GetEditionByName(name string) (*Edition, error) {
+	return dbw.findEdition(`e.name = ?`, strings.TrimSpace(name))
+}
+
+// Return the edition new performances go into, or nil if none is current
+func (dbw *DBWrapper) GetCurrentEdition() (*Edition, error) {
+	return dbw.findEdition(`e.isCurrent = 1`)
+}
+
+// returns the edition that isn't deleted and meets condition, or nil if there isn't one
+func (dbw *DBWrapper) findEdition(condition string, args ...interface{}) (*Edition, error) {
+	dbQuery := `
+		SELECT ` + editionColumns + `
+		FROM editions AS e
+		WHERE e.deleted = 0 AND ` + condition
+
+	e, err := scanEdition(dbw.db.QueryRow(dbQuery, args...))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Returns all the performances in a particular edition
+func (dbw *DBWrapper) GetPerformancesByEditionId(editionId int) ([]*Performance, error) {
+	dbQuery := `
+		SELECT ` + performanceColumns + `
+		FROM performances AS p
+		WHERE p.editionId = ? AND p.deleted = 0
+		ORDER BY p.startTime ASC, p.id ASC
+	`
+
+	rows, err := dbw.db.Query(dbQuery, editionId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	performances := []*Performance{}
+	for rows.Next() {
+		p, err := scanPerformance(rows)
+		if err != nil {
+			return nil, err
+		}
+		performances = append(performances, p)
+	}
+
+	return performances, nil
+}
+
+// Returns the performers booked into any of the performances in a particular edition
+func (dbw *DBWrapper) GetPerformersByEditionId(editionId int) ([]*Performer, error) {
+	dbQuery := `
+		SELECT DISTINCT ` + performerColumns + `
+		FROM performers AS p
+		INNER JOIN junction AS j ON j.performer_id = p.id
+		INNER JOIN performances AS pf ON pf.id = j.performance_id
+		WHERE pf.editionId = ? AND pf.deleted = 0 AND p.deleted = 0
+		ORDER BY p.id ASC
+	`
+
+	rows, err := dbw.db.Query(dbQuery, editionId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	performers := []*Performer{}
+	for rows.Next() {
+		p, err := scanPerformer(rows)
+		if err != nil {
+			return nil, err
+		}
+		performers = append(performers, p)
+	}
+
+	return performers, nil
+}
+
+// Updates the edition with the given id. making it current takes over from whichever edition was
+// current before. its performances have to still fit inside its times
+func (dbw *DBWrapper) UpdateEditionById(id int, e *Edition) error {
+	normaliseEdition(e)
+	err := validateEdition(e)
+	if err != nil {
+		return err
+	}
+
+	return dbw.InTransaction(func(tx *DBWrapper) error {
+		before, err := tx.GetEditionById(id)
+		if err != nil {
+			return err
+		}
+		if before == nil {
+			return sql.ErrNoRows
+		}
+
+		existing, err := tx.GetEditionByName(e.Name)
+		if err != nil {
+			return err
+		}
+		if existing != nil && existing.Id != id {
+			return ErrDuplicateEdition
+		}
+
+		e.Id = id
+		performances, err := tx.GetPerformancesByEditionId(id)
+		if err != nil {
+			return err
+		}
+		outside := 0
+		for _, p := range performances {
+			if editionBoundsError(e, p) != nil {
+				outside++
+			}
+		}
+		if outside > 0 {
+			v := &validator{}
+			v.add("startTime", validationOutOfRange, strconv.Itoa(outside)+" performance(s) would fall outside the edition")
+			return v.err()
+		}
+
+		if e.Current && !before.Current {
+			err = tx.clearCurrentEdition()
+			if err != nil {
+				return err
+			}
+		}
+
+		dbQuery := `
+			UPDATE editions
+			SET name = ?, startTime = ?, endTime = ?, isCurrent = ?
+			WHERE id = ? AND deleted = 0
+		`
+		_, err = tx.db.Exec(dbQuery, e.Name, e.StartTime, e.EndTime, e.Current, id)
+		if err != nil {
+			return err
+		}
+
+		return tx.audit(auditEntityEdition, strconv.Itoa(id), auditActionUpdate, before, e)
+	})
+}
+
+// Deletes the edition with the given id. editions that still have performances, archived or not,
+// can't be deleted
+func (dbw *DBWrapper) DeleteEditionById(id int) error {
+	return dbw.InTransaction(func(tx *DBWrapper) error {
+		before, err := tx.GetEditionById(id)
+		if err != nil {
+			return err
+		}
+		// deleting something that's already gone doesn't change anything
+		if before == nil {
+			return nil
+		}
+
+		// archived performances count too, or they couldn't be restored into their edition
+		var performances int
+		err = tx.db.QueryRow(`SELECT COUNT(*) FROM performances WHERE editionId = ?`, id).Scan(&performances)
+		if err != nil {
+			return err
+		}
+		if performances > 0 {
+			return ErrEditionInUse
+		}
+
+		_, err = tx.db.Exec(`UPDATE editions SET deleted = 1, isCurrent = 0 WHERE id = ?`, id)
+		if err != nil {
+			return err
+		}
+
+		return tx.audit(auditEntityEdition, strconv.Itoa(id), auditActionDelete, before, nil)
+	})
+}
+
+// stops whichever edition is current from being so
+func (dbw *DBWrapper) clearCurrentEdition() error {
+	current, err := dbw.GetCurrentEdition()
+	if err != nil || current == nil {
+		return err
+	}
+
+	_, err = dbw.db.Exec(`UPDATE editions SET isCurrent = 0 WHERE id = ?`, current.Id)
+	if err != nil {
+		return err
+	}
+
+	after := *current
+	after.Current = false
+	return dbw.audit(auditEntityEdition, strconv.Itoa(current.Id), auditActionUpdate, current, &after)
+}
+
+// returns the id of the current edition, or 0 if none is current
+func (dbw *DBWrapper) currentEditionId() (int, error) {
+	current, err := dbw.GetCurrentEdition()
+	if err != nil || current == nil {
+		return 0, err
+	}
+	return current.Id, nil
+}
+
+// points p at a live edition and checks its times fall inside it. performances that don't say
+// which edition they're in go into fallback, which can be 0 to leave them out of any edition
+func (dbw *DBWrapper) resolveEdition(p *Performance, fallback int) error {
+	if p.EditionId == 0 {
+		p.EditionId = fallback
+	}
+	if p.EditionId == 0 {
+		return nil
+	}
+
+	e, err := dbw.GetEditionById(p.EditionId)
+	if err != nil {
+		return err
+	}
+	if e == nil {
+		v := &validator{}
+		v.add("editionId", validationInvalid, "is not a known edition")
+		return v.err()
+	}
+	return editionBoundsError(e, p)
+}
+
+// returns a ValidationError if p is scheduled outside the edition's times
+func editionBoundsError(e *Edition, p *Performance) error {
+	if !isScheduled(p) {
+		return nil
+	}
+
+	v := &validator{}
+	if !e.StartTime.IsZero() && p.StartTime.Before(e.StartTime) {
+		v.add("startTime", validationOutOfRange, "must not be before "+e.Name+" starts at "+e.StartTime.Format(time.RFC3339))
+	}
+	if !e.EndTime.IsZero() && p.EndTime.After(e.EndTime) {
+		v.add("endTime", validationOutOfRange, "must not be after "+e.Name+" ends at "+e.EndTime.Format(time.RFC3339))
+	}
+	return v.err()
+}
+
+func normaliseEdition(e *Edition) {
+	e.Name = strings.TrimSpace(e.Name)
+	e.StartTime = e.StartTime.UTC()
+	e.EndTime = e.EndTime.UTC()
+}
+
+// scans a row selected with editionColumns into an Edition
+func scanEdition(row rowScanner) (*Edition, error) {
+	e := &Edition{}
+	err := row.Scan(&e.Id, &e.Name, &e.StartTime, &e.EndTime, &e.Current)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Handles all requests related to editions
+func (api *API) EditionHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		path := strings.TrimSuffix(r.URL.Path, "/")
+		if path == "/editions" {
+			api.GetAllEditions(w, r)
+		} else if pathLength(path) == 2 {
+			api.GetEditionById(w, r)
+		} else if pathLength(path) == 3 && strings.HasSuffix(path, "/performers") {
+			api.GetPerformersByEditionId(w, r)
+		} else if pathLength(path) == 3 && strings.HasSuffix(path, "/performances") {
+			api.GetPerformancesByEditionId(w, r)
+		} else {
+			api.respondError(w, http.StatusNotFound, "Not Found")
+		}
+	case http.MethodPost:
+		if r.URL.Path == "/editions" || r.URL.Path == "/editions/" {
+			api.CreateNewEdition(w, r)
+		} else {
+			api.respondError(w, http.StatusNotFound, "Not Found")
+		}
+	case http.MethodPut:
+		if pathLength(r.URL.Path) == 2 {
+			api.UpdateEdition(w, r)
+		} else {
+			api.respondError(w, http.StatusNotFound, "Not Found")
+		}
+	case http.MethodDelete:
+		if pathLength(r.URL.Path) == 2 {
+			api.DeleteEdition(w, r)
+		} else {
+			api.respondError(w, http.StatusNotFound, "Not Found")
+		}
+	}
+}
+
+// GET /editions - returns all editions
+func (api *API) GetAllEditions(w http.ResponseWriter, r *http.Request) {
+	editions, err := api.wrapper.GetAllEditions()
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Unable to find editions")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, map[string][]*Edition{"editions": editions})
+}
+
+// GET /editions/:id - return edition with given ID
+func (api *API) GetEditionById(w http.ResponseWriter, r *http.Request) {
+	id, err := api.extractId(r.URL.Path)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	edition, err := api.wrapper.GetEditionById(id)
+	if err != nil || edition == nil {
+		api.respondError(w, http.StatusNotFound, "Edition Not Found")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, edition)
+}
+
+// GET /editions/:id/performances - returns the performances in the edition with the specified id
+func (api *API) GetPerformancesByEditionId(w http.ResponseWriter, r *http.Request) {
+	id, err := api.extractId(r.URL.Path)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Error extracting id")
+		return
+	}
+
+	performances, err := api.wrapper.GetPerformancesByEditionId(id)
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Unable to find performances")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, map[string][]*Performance{"performances": performances})
+}
+
+// GET /editions/:id/performers - returns the performers booked into the edition with the specified id
+func (api *API) GetPerformersByEditionId(w http.ResponseWriter, r *http.Request) {
+	id, err := api.extractId(r.URL.Path)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Error extracting id")
+		return
+	}
+
+	performers, err := api.wrapper.GetPerformersByEditionId(id)
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Unable to find performers")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, map[string][]*Performer{"performers": performers})
+}
+
+// POST /editions/ - Create a new edition
+func (api *API) CreateNewEdition(w http.ResponseWriter, r *http.Request) {
+	var edition Edition
+
+	err := json.NewDecoder(r.Body).Decode(&edition)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	newEdition, err := api.wrapperFor(r).CreateEdition(&edition)
+	if api.respondIfInvalid(w, err) {
+		return
+	}
+	if errors.Is(err, ErrDuplicateEdition) {
+		api.respondError(w, http.StatusConflict, "Edition already exists")
+		return
+	}
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Failed to create edition")
+		return
+	}
+
+	api.respondJSON(w, http.StatusCreated, newEdition)
+}
+
+// PUT /editions/:id - updates the edition with the specified id
+func (api *API) UpdateEdition(w http.ResponseWriter, r *http.Request) {
+	var edition Edition
+
+	err := json.NewDecoder(r.Body).Decode(&edition)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	id, err := api.extractId(r.URL.Path)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid ID provided")
+		return
+	}
+
+	err = api.wrapperFor(r).UpdateEditionById(id, &edition)
+	if api.respondIfInvalid(w, err) {
+		return
+	}
+	if errors.Is(err, ErrDuplicateEdition) {
+		api.respondError(w, http.StatusConflict, "Edition already exists")
+		return
+	}
+	if err == sql.ErrNoRows {
+		api.respondError(w, http.StatusNotFound, "Edition Not Found")
+		return
+	}
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Error updating edition")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, edition)
+}
+
+// DELETE /editions/:id - deletes the edition with the specified id, as long as it has no performances
+func (api *API) DeleteEdition(w http.ResponseWriter, r *http.Request) {
+	id, err := api.extractId(r.URL.Path)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid ID provided")
+		return
+	}
+
+	err = api.wrapperFor(r).DeleteEditionById(id)
+	if errors.Is(err, ErrEditionInUse) {
+		api.respondError(w, http.StatusConflict, "Edition still has performances")
+		return
+	}
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Error deleting edition")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
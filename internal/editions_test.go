@@ -0,0 +1,183 @@
+package internal_test
+
+import (
+	internal "foc_api/internal"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPerformancesGoIntoCurrentEdition(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	lastYear, err := dbw.CreateEdition(&internal.Edition{Name: "2024", Current: true})
+	require.NoError(t, err, "CreateEdition() failed: %v", err)
+	old, err := dbw.CreatePerformance(&internal.Performance{ItemName: "Old Favourite"})
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+
+	// act
+	thisYear, err := dbw.CreateEdition(&internal.Edition{Name: "2025", Current: true})
+	require.NoError(t, err, "CreateEdition() failed: %v", err)
+	fresh, err := dbw.CreatePerformance(&internal.Performance{ItemName: "New Act"})
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+
+	// updates that don't mention an edition leave the performance where it was
+	old.EditionId = 0
+	err = dbw.UpdatePerformanceById(old.Id, old)
+	require.NoError(t, err, "UpdatePerformanceById() failed: %v", err)
+
+	// assert
+	assert.Equal(t, lastYear.Id, old.EditionId)
+	assert.Equal(t, thisYear.Id, fresh.EditionId)
+
+	current, err := dbw.GetCurrentEdition()
+	require.NoError(t, err, "GetCurrentEdition() failed: %v", err)
+	assert.Equal(t, thisYear, current, "Newest current edition should take over")
+
+	storedLastYear, err := dbw.GetEditionById(lastYear.Id)
+	require.NoError(t, err, "GetEditionById() failed: %v", err)
+	assert.False(t, storedLastYear.Current)
+
+	performances, err := dbw.GetPerformancesByEditionId(lastYear.Id)
+	require.NoError(t, err, "GetPerformancesByEditionId() failed: %v", err)
+	require.Len(t, performances, 1)
+	assert.Equal(t, old.Id, performances[0].Id)
+
+	listed, _, err := dbw.ListPerformances(url.Values{"editionId": {"2"}})
+	require.NoError(t, err, "ListPerformances() failed: %v", err)
+	require.Len(t, listed, 1)
+	assert.Equal(t, fresh.Id, listed[0].Id)
+}
+
+func TestReturningPerformerIsSharedBetweenEditions(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	performer, err := dbw.CreatePerformer(getTestPerformer())
+	require.NoError(t, err, "CreatePerformer() failed: %v", err)
+
+	editions := []*internal.Edition{}
+	for _, year := range []int{2024, 2025} {
+		edition, err := dbw.CreateEdition(&internal.Edition{Name: strconv.Itoa(year)})
+		require.NoError(t, err, "CreateEdition() failed: %v", err)
+		start := time.Date(year, 9, 1, 18, 0, 0, 0, time.UTC)
+		p, err := dbw.CreatePerformance(&internal.Performance{ItemName: "Headline Set", Location: "Main Stage", EditionId: edition.Id, StartTime: start, EndTime: start.Add(time.Hour)})
+		require.NoError(t, err, "CreatePerformance() failed: %v", err)
+		require.NoError(t, dbw.CreateJunction(performer.Id, p.Id))
+		editions = append(editions, edition)
+	}
+
+	// act
+	lastYear, err := dbw.GetPerformersByEditionId(editions[0].Id)
+	require.NoError(t, err, "GetPerformersByEditionId() failed: %v", err)
+	thisYear, err := dbw.GetPerformersByEditionId(editions[1].Id)
+	require.NoError(t, err, "GetPerformersByEditionId() failed: %v", err)
+
+	// assert
+	assert.Equal(t, []*internal.Performer{performer}, lastYear)
+	assert.Equal(t, []*internal.Performer{performer}, thisYear)
+
+	performers, err := dbw.GetAllPerformers()
+	require.NoError(t, err, "GetAllPerformers() failed: %v", err)
+	assert.Len(t, performers, 1, "Returning performer should not be duplicated")
+}
+
+func TestEditionTimesBoundItsPerformances(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	opening := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	edition, err := dbw.CreateEdition(&internal.Edition{Name: "2025", StartTime: opening, EndTime: opening.Add(72 * time.Hour)})
+	require.NoError(t, err, "CreateEdition() failed: %v", err)
+
+	inside := &internal.Performance{ItemName: "Opening Act", EditionId: edition.Id, StartTime: opening.Add(18 * time.Hour), EndTime: opening.Add(19 * time.Hour)}
+	outside := &internal.Performance{ItemName: "Too Early", EditionId: edition.Id, StartTime: opening.Add(-time.Hour), EndTime: opening}
+
+	// act
+	_, insideErr := dbw.CreatePerformance(inside)
+	_, outsideErr := dbw.CreatePerformance(outside)
+	shrunk := *edition
+	shrunk.EndTime = opening.Add(12 * time.Hour)
+	shrinkErr := dbw.UpdateEditionById(edition.Id, &shrunk)
+	_, unknownErr := dbw.CreatePerformance(&internal.Performance{ItemName: "Nowhere", EditionId: 99})
+
+	// assert
+	assert.NoError(t, insideErr)
+	assert.IsType(t, &internal.ValidationError{}, outsideErr, "Performance before the edition should be rejected")
+	assert.IsType(t, &internal.ValidationError{}, shrinkErr, "Edition should not shrink past its performances")
+	assert.IsType(t, &internal.ValidationError{}, unknownErr, "Unknown edition should be rejected")
+}
+
+func TestEditionEndpoints(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+	api := internal.NewAPI(dbw)
+
+	edition, err := dbw.CreateEdition(&internal.Edition{Name: "2025", Current: true})
+	require.NoError(t, err, "CreateEdition() failed: %v", err)
+	_, err = dbw.CreatePerformance(getTestPerformance())
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+	empty, err := dbw.CreateEdition(&internal.Edition{Name: "2026"})
+	require.NoError(t, err, "CreateEdition() failed: %v", err)
+
+	// an edition whose only performance is archived still can't be deleted, so it can be restored
+	archived, err := dbw.CreateEdition(&internal.Edition{Name: "2024"})
+	require.NoError(t, err, "CreateEdition() failed: %v", err)
+	p, err := dbw.CreatePerformance(&internal.Performance{ItemName: "Archived", EditionId: archived.Id})
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+	require.NoError(t, dbw.DeletePerformanceById(p.Id))
+
+	cases := []struct {
+		method, path, body string
+		expected           int
+	}{
+		{"POST", "/editions", `{"name": "2025"}`, http.StatusConflict},
+		{"POST", "/editions", `{"name": " "}`, http.StatusUnprocessableEntity},
+		{"GET", "/editions/1/performances", "", http.StatusOK},
+		{"GET", "/editions/1/performers", "", http.StatusOK},
+		{"GET", "/editions/1/anything", "", http.StatusNotFound},
+		{"GET", "/editions/1/performances/extra", "", http.StatusNotFound},
+		{"POST", "/editions/1/anything", `{"name": "2027"}`, http.StatusNotFound},
+		{"PUT", "/editions/1/anything", `{"name": "2027"}`, http.StatusNotFound},
+		{"DELETE", "/editions/1/anything", "", http.StatusNotFound},
+		{"DELETE", "/editions/1", "", http.StatusConflict},
+		{"DELETE", "/editions/3", "", http.StatusConflict},
+		{"DELETE", "/editions/2", "", http.StatusOK},
+		{"GET", "/editions/2", "", http.StatusNotFound},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest(c.method, c.path, strings.NewReader(c.body))
+		w := httptest.NewRecorder()
+
+		// act
+		api.EditionHandler(w, r)
+
+		// assert
+		assert.Equal(t, c.expected, w.Code, "%s %s returned the wrong status", c.method, c.path)
+	}
+
+	assert.Equal(t, 1, edition.Id)
+	assert.Equal(t, 2, empty.Id)
+
+	editions, err := dbw.GetAllEditions()
+	require.NoError(t, err, "GetAllEditions() failed: %v", err)
+	assert.Len(t, editions, 2, "Routes that don't exist shouldn't create editions")
+	require.NoError(t, dbw.RestorePerformanceById(p.Id), "Archived performance should be restorable into its edition")
+}
@@ -0,0 +1,87 @@
+package internal
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// stands in for a version when a change should go ahead whatever version the row is at. clients
+// can only ask for it with If-Match: *, since etags are always for version 1 or later
+const anyVersion = 0
+
+// etags are just the row version, which changes whenever the row does
+func formatETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// reads the version out of an etag, accepting weak etags too. rows start at version 1, so
+// anything lower can't be an etag the server gave out
+func parseETag(etag string) (int, error) {
+	etag = strings.TrimPrefix(strings.TrimSpace(etag), "W/")
+	if len(etag) < 2 || !strings.HasPrefix(etag, `"`) || !strings.HasSuffix(etag, `"`) {
+		return 0, errors.New("invalid etag")
+	}
+	version, err := strconv.Atoi(etag[1 : len(etag)-1])
+	if err != nil || version < 1 {
+		return 0, errors.New("invalid etag")
+	}
+	return version, nil
+}
+
+// reports whether an If-None-Match header matches the given version
+func etagMatches(header string, version int) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		if strings.TrimSpace(candidate) == "*" {
+			return true
+		}
+		parsed, err := parseETag(candidate)
+		if err == nil && parsed == version {
+			return true
+		}
+	}
+	return false
+}
+
+// reads the version a change is based on from the If-Match header. "*" gives anyVersion, which
+// matches whatever version the row is at. responds with a 428 if the header is missing, or a 412
+// if it can't be read, and returns false
+func (api *API) requireIfMatch(w http.ResponseWriter, r *http.Request) (int, bool) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		api.respondError(w, http.StatusPreconditionRequired, "If-Match header required")
+		return 0, false
+	}
+	if header == "*" {
+		return anyVersion, true
+	}
+
+	version, err := parseETag(header)
+	if err != nil {
+		api.respondError(w, http.StatusPreconditionFailed, "If-Match must be a single ETag")
+		return 0, false
+	}
+	return version, true
+}
+
+// responds with data and its etag, or just a 304 if the client's If-None-Match shows it already has it
+func (api *API) respondWithETag(w http.ResponseWriter, r *http.Request, version int, data interface{}) {
+	w.Header().Set("ETag", formatETag(version))
+
+	if header := r.Header.Get("If-None-Match"); header != "" && etagMatches(header, version) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, data)
+}
+
+// responds with a 412 if err is ErrVersionMismatch, returning whether it did
+func (api *API) respondIfVersionMismatch(w http.ResponseWriter, err error) bool {
+	if !errors.Is(err, ErrVersionMismatch) {
+		return false
+	}
+	api.respondError(w, http.StatusPreconditionFailed, "It has been changed since you last fetched it")
+	return true
+}
@@ -0,0 +1,128 @@
+package internal_test
+
+import (
+	"bytes"
+	"encoding/json"
+	internal "foc_api/internal"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func etagRequest(api *internal.API, method, path, ifMatch string, body interface{}) *httptest.ResponseRecorder {
+	var reader *bytes.Reader
+	if body != nil {
+		encoded, _ := json.Marshal(body)
+		reader = bytes.NewReader(encoded)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	r := httptest.NewRequest(method, path, reader)
+	if ifMatch != "" {
+		r.Header.Set("If-Match", ifMatch)
+	}
+	w := httptest.NewRecorder()
+	api.PerformanceHandler(w, r)
+	return w
+}
+
+func TestGetPerformanceReturnsETag(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+	api := internal.NewAPI(dbw)
+
+	_, err := dbw.CreatePerformance(getTestPerformance())
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+
+	// act
+	first := etagRequest(api, "GET", "/performances/1", "", nil)
+
+	r := httptest.NewRequest("GET", "/performances/1", nil)
+	r.Header.Set("If-None-Match", first.Header().Get("ETag"))
+	cached := httptest.NewRecorder()
+	api.PerformanceHandler(cached, r)
+
+	// assert
+	assert.Equal(t, http.StatusOK, first.Code)
+	assert.Equal(t, `"1"`, first.Header().Get("ETag"), "New performances should be at version 1")
+	assert.Equal(t, http.StatusNotModified, cached.Code, "Matching If-None-Match should give a 304")
+	assert.Empty(t, cached.Body.String(), "304 should have no body")
+}
+
+func TestUpdatePerformanceRequiresMatchingETag(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+	api := internal.NewAPI(dbw)
+
+	performance, err := dbw.CreatePerformance(getTestPerformance())
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+	update := *performance
+	update.ItemName = "Renamed"
+
+	// act
+	missing := etagRequest(api, "PUT", "/performances/1", "", update)
+	first := etagRequest(api, "PUT", "/performances/1", `"1"`, update)
+	// a second organiser still holding version 1
+	stale := etagRequest(api, "PUT", "/performances/1", `"1"`, update)
+	// versions start at 1, so "0" is never a real etag and mustn't act like "*"
+	zero := etagRequest(api, "PUT", "/performances/1", `"0"`, update)
+	negative := etagRequest(api, "PUT", "/performances/1", `"-1"`, update)
+
+	// assert
+	assert.Equal(t, http.StatusPreconditionRequired, missing.Code, "Update without If-Match should be refused")
+	assert.Equal(t, http.StatusOK, first.Code, "Update with the current ETag failed: %s", first.Body.String())
+	assert.Equal(t, `"2"`, first.Header().Get("ETag"), "Update should return the new ETag")
+	assert.Equal(t, http.StatusPreconditionFailed, stale.Code, "Update with a stale ETag should be refused")
+	assert.Equal(t, http.StatusPreconditionFailed, zero.Code, "Update with a made-up ETag should be refused")
+	assert.Equal(t, http.StatusPreconditionFailed, negative.Code, "Update with a made-up ETag should be refused")
+}
+
+func TestDeletePerformanceRequiresMatchingETag(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+	api := internal.NewAPI(dbw)
+
+	_, err := dbw.CreatePerformance(getTestPerformance())
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+
+	// act
+	stale := etagRequest(api, "DELETE", "/performances/1", `"7"`, nil)
+	current := etagRequest(api, "DELETE", "/performances/1", `W/"1"`, nil)
+
+	// assert
+	assert.Equal(t, http.StatusPreconditionFailed, stale.Code, "Delete with a stale ETag should be refused")
+	assert.Equal(t, http.StatusOK, current.Code, "Delete with the current ETag failed: %s", current.Body.String())
+}
+
+func TestUpdatePerformerBumpsVersion(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	performer, err := dbw.CreatePerformer(getTestPerformer())
+	require.NoError(t, err, "CreatePerformer() failed: %v", err)
+
+	stale := *performer
+	update := *performer
+	update.Name = "New Name"
+
+	// act
+	err = dbw.UpdatePerformerById(performer.Id, &update)
+	staleErr := dbw.UpdatePerformerById(performer.Id, &stale)
+
+	// assert
+	require.NoError(t, err, "UpdatePerformerById() failed: %v", err)
+	assert.Equal(t, 2, update.Version, "Update should bump the version")
+	assert.ErrorIs(t, staleErr, internal.ErrVersionMismatch, "Stale update should be refused")
+}
@@ -0,0 +1,178 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// how many events a slow subscriber can fall behind by before it starts missing them
+	eventBufferSize = 32
+	// comments are sent this often so proxies don't close a quiet stream
+	eventKeepAliveInterval = 30 * time.Second
+)
+
+// a change made through a DBWrapper, sent to /events subscribers once it has been committed
+type ChangeEvent struct {
+	Entity   string    `json:"entity"`
+	EntityId string    `json:"entityId"`
+	Action   string    `json:"action"`
+	At       time.Time `json:"at"`
+}
+
+// fans committed changes out to everyone listening
+type EventBroker struct {
+	mu          sync.Mutex
+	subscribers map[chan *ChangeEvent]struct{}
+}
+
+func newEventBroker() *EventBroker {
+	return &EventBroker{subscribers: map[chan *ChangeEvent]struct{}{}}
+}
+
+// returns a channel that receives every change from now on, and a function to stop receiving them
+func (b *EventBroker) Subscribe() (<-chan *ChangeEvent, func()) {
+	ch := make(chan *ChangeEvent, eventBufferSize)
+
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	unsubscribe := func() {
+		b.mu.Lock()
+		delete(b.subscribers, ch)
+		b.mu.Unlock()
+	}
+	return ch, unsubscribe
+}
+
+// sends event to every subscriber. subscribers that have fallen too far behind miss it rather
+// than holding up whoever made the change
+func (b *EventBroker) publish(event *ChangeEvent) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// returns the broker changes made through this wrapper are published to
+func (dbw *DBWrapper) Events() *EventBroker {
+	return dbw.events
+}
+
+// queues a change to be published once the transaction it's part of commits
+func (dbw *DBWrapper) notify(entity, entityId, action string) {
+	event := &ChangeEvent{Entity: entity, EntityId: entityId, Action: action, At: time.Now().UTC()}
+	if dbw.pendingEvents != nil {
+		*dbw.pendingEvents = append(*dbw.pendingEvents, event)
+		return
+	}
+	dbw.events.publish(event)
+}
+
+// Handles requests for the live event stream
+func (api *API) EventsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		api.StreamEvents(w, r)
+	}
+}
+
+// GET /events - a server-sent event stream. a "now" event with what's on at every location is
+// sent straight away, again whenever a performance starts or ends, and after every change. each
+// change is also sent on its own as a "change" event
+func (api *API) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		api.respondError(w, http.StatusInternalServerError, "Streaming unsupported")
+		return
+	}
+
+	// subscribe before reading anything, so no change can slip in between
+	changes, unsubscribe := api.wrapper.Events().Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	keepAlive := time.NewTicker(eventKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		// tell the client what's on now, and wake up again when that next changes
+		next, err := api.sendNowPlaying(w)
+		if err != nil {
+			return
+		}
+		flusher.Flush()
+
+		var slotChange <-chan time.Time
+		var timer *time.Timer
+		if !next.IsZero() {
+			timer = time.NewTimer(time.Until(next))
+			slotChange = timer.C
+		}
+
+	waiting:
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+				flusher.Flush()
+			case <-slotChange:
+				break waiting
+			case change := <-changes:
+				err := writeEvent(w, "change", change)
+				if err != nil {
+					return
+				}
+				break waiting
+			}
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// sends a "now" event, returning when what's on next changes
+func (api *API) sendNowPlaying(w http.ResponseWriter) (time.Time, error) {
+	now := time.Now().UTC()
+	playing, err := api.wrapper.GetNowPlaying(now)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	err = writeEvent(w, "now", map[string]interface{}{"at": now, "locations": playing})
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return api.wrapper.nextSlotChange(now)
+}
+
+// writes a single server-sent event with data encoded as json
+func writeEvent(w http.ResponseWriter, name string, data interface{}) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, encoded)
+	return err
+}
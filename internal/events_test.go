@@ -0,0 +1,99 @@
+package internal_test
+
+import (
+	"bufio"
+	"encoding/json"
+	internal "foc_api/internal"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// reads the next server-sent event from the stream, skipping keep-alive comments
+func readEvent(t *testing.T, reader *bufio.Reader) (string, string) {
+	name, data := "", ""
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err, "Error reading event stream")
+		line = strings.TrimRight(line, "\n")
+
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		case line == "" && name != "":
+			return name, data
+		}
+	}
+}
+
+func TestEventsStreamsCommittedChanges(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+	api := internal.NewAPI(dbw)
+
+	server := httptest.NewServer(http.HandlerFunc(api.EventsHandler))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/events")
+	require.NoError(t, err, "Error connecting to event stream")
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+
+	first, _ := readEvent(t, reader)
+
+	// act
+	performance, err := dbw.CreatePerformance(getTestPerformance())
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+
+	name, data := readEvent(t, reader)
+	refreshed, _ := readEvent(t, reader)
+
+	// assert
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "now", first, "Stream should start with what's on now")
+	assert.Equal(t, "change", name)
+	assert.Equal(t, "now", refreshed, "What's on should be sent again after a change")
+
+	var change internal.ChangeEvent
+	require.NoError(t, json.Unmarshal([]byte(data), &change))
+	assert.Equal(t, "performance", change.Entity)
+	assert.Equal(t, "create", change.Action)
+	assert.Equal(t, "1", change.EntityId, "Change should be for performance %d", performance.Id)
+}
+
+func TestEventsAreOnlyPublishedOnCommit(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	changes, unsubscribe := dbw.Events().Subscribe()
+	defer unsubscribe()
+
+	start := time.Date(2025, 9, 1, 18, 0, 0, 0, time.UTC)
+	_, err := dbw.CreatePerformance(&internal.Performance{ItemName: "Take Five", Location: "Main Stage", Duration: 300})
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+	<-changes
+
+	// act
+	_, err = dbw.GenerateSchedule(&internal.ScheduleRequest{
+		Windows: []*internal.ScheduleWindow{{Location: "Main Stage", Start: start, End: start.Add(time.Hour)}},
+	}, false)
+	require.NoError(t, err, "GenerateSchedule() failed: %v", err)
+
+	// assert
+	select {
+	case change := <-changes:
+		t.Fatalf("Preview should not publish changes, got %+v", change)
+	default:
+	}
+}
@@ -0,0 +1,738 @@
+package internal
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// a genre performances can be filed under. names are matched ignoring case, spaces and
+// punctuation, so "Hip Hop", "hip-hop" and "HipHop" are all the same genre. aliases are other
+// names that mean the same thing, e.g. "DnB" for "Drum and Bass"
+type Genre struct {
+	Id      int      `json:"id"`
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases"`
+}
+
+// how much of the programme a genre takes up
+type GenreStats struct {
+	// 0 for performances without a genre
+	GenreId      int    `json:"genreId"`
+	Genre        string `json:"genre"`
+	Performances int    `json:"performances"`
+	Scheduled    int    `json:"scheduled"`
+	// the total length of the genre's performances, in seconds
+	StageTime int `json:"stageTime"`
+	// the genre's fraction of all the stage time, from 0 to 1
+	Share float64 `json:"share"`
+}
+
+var (
+	ErrUnknownGenre   = errors.New("genre does not exist")
+	ErrDuplicateGenre = errors.New("a genre with that name or alias already exists")
+	ErrGenreInUse     = errors.New("genre still has performances")
+)
+
+// reduces a genre name to the letters and digits that identify it, in lower case
+func genreKey(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// creates a genre and puts it into the db
+func (dbw *DBWrapper) CreateGenre(g *Genre) (*Genre, error) {
+	normaliseGenre(g)
+	err := validateGenre(g)
+	if err != nil {
+		return nil, err
+	}
+
+	err = dbw.InTransaction(func(tx *DBWrapper) error {
+		err := tx.insertGenre(g)
+		if err != nil {
+			return err
+		}
+		return tx.audit(auditEntityGenre, strconv.Itoa(g.Id), auditActionCreate, nil, g)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// puts g into the db without auditing it, for genres that are made as part of another change
+func (dbw *DBWrapper) insertGenre(g *Genre) error {
+	err := dbw.checkGenreNamesFree(g, 0)
+	if err != nil {
+		return err
+	}
+
+	err = dbw.db.QueryRow(`INSERT INTO genres (name) VALUES (?) RETURNING id`, g.Name).Scan(&g.Id)
+	if err != nil {
+		return err
+	}
+	return dbw.saveGenreAliases(g)
+}
+
+// returns a slice with all the genres in the db, in name order
+func (dbw *DBWrapper) GetAllGenres() ([]*Genre, error) {
+	rows, err := dbw.db.Query(`SELECT id, name FROM genres WHERE deleted = 0 ORDER BY name ASC, id ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	genres := []*Genre{}
+	byId := map[int]*Genre{}
+	for rows.Next() {
+		g := &Genre{Aliases: []string{}}
+		err := rows.Scan(&g.Id, &g.Name)
+		if err != nil {
+			return nil, err
+		}
+		genres = append(genres, g)
+		byId[g.Id] = g
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	aliases, err := dbw.db.Query(`SELECT genreId, alias FROM genre_aliases ORDER BY alias ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer aliases.Close()
+	for aliases.Next() {
+		var genreId int
+		var alias string
+		err := aliases.Scan(&genreId, &alias)
+		if err != nil {
+			return nil, err
+		}
+		if g, ok := byId[genreId]; ok {
+			g.Aliases = append(g.Aliases, alias)
+		}
+	}
+
+	return genres, aliases.Err()
+}
+
+// Return the genre with the given id
+func (dbw *DBWrapper) GetGenreById(id int) (*Genre, error) {
+	genres, err := dbw.GetAllGenres()
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range genres {
+		if g.Id == id {
+			return g, nil
+		}
+	}
+	return nil, nil
+}
+
+// Return the genre whose name or one of whose aliases matches name, ignoring case, spaces and punctuation
+func (dbw *DBWrapper) GetGenreByName(name string) (*Genre, error) {
+	key := genreKey(name)
+	if key == "" {
+		return nil, nil
+	}
+
+	genres, err := dbw.GetAllGenres()
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range genres {
+		if genreMatches(g, key) {
+			return g, nil
+		}
+	}
+	return nil, nil
+}
+
+func genreMatches(g *Genre, key string) bool {
+	if genreKey(g.Name) == key {
+		return true
+	}
+	for _, alias := range g.Aliases {
+		if genreKey(alias) == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns all the performances filed under a particular genre
+func (dbw *DBWrapper) GetPerformancesByGenreId(genreId int) ([]*Performance, error) {
+	dbQuery := `
+		SELECT ` + performanceColumns + `
+		FROM performances AS p
+		WHERE p.genreId = ? AND p.deleted = 0
+		ORDER BY p.startTime ASC, p.id ASC
+	`
+
+	rows, err := dbw.db.Query(dbQuery, genreId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	performances := []*Performance{}
+	for rows.Next() {
+		p, err := scanPerformance(rows)
+		if err != nil {
+			return nil, err
+		}
+		performances = append(performances, p)
+	}
+
+	return performances, nil
+}
+
+// Renames the genre with the given id and replaces its aliases. performances filed under it
+// take the new name
+func (dbw *DBWrapper) UpdateGenreById(id int, g *Genre) error {
+	normaliseGenre(g)
+	err := validateGenre(g)
+	if err != nil {
+		return err
+	}
+
+	return dbw.InTransaction(func(tx *DBWrapper) error {
+		before, err := tx.GetGenreById(id)
+		if err != nil {
+			return err
+		}
+		if before == nil {
+			return sql.ErrNoRows
+		}
+
+		err = tx.checkGenreNamesFree(g, id)
+		if err != nil {
+			return err
+		}
+
+		g.Id = id
+		_, err = tx.db.Exec(`UPDATE genres SET name = ? WHERE id = ?`, g.Name, id)
+		if err != nil {
+			return err
+		}
+		err = tx.saveGenreAliases(g)
+		if err != nil {
+			return err
+		}
+		err = tx.refileGenre(id, g)
+		if err != nil {
+			return err
+		}
+
+		return tx.audit(auditEntityGenre, strconv.Itoa(id), auditActionUpdate, before, g)
+	})
+}
+
+// Deletes the genre with the given id. genres that still have performances can't be deleted, but
+// can be merged into another genre instead
+func (dbw *DBWrapper) DeleteGenreById(id int) error {
+	return dbw.InTransaction(func(tx *DBWrapper) error {
+		before, err := tx.GetGenreById(id)
+		if err != nil {
+			return err
+		}
+		// deleting something that's already gone doesn't change anything
+		if before == nil {
+			return nil
+		}
+
+		performances, err := tx.GetPerformancesByGenreId(id)
+		if err != nil {
+			return err
+		}
+		if len(performances) > 0 {
+			return ErrGenreInUse
+		}
+
+		err = tx.removeGenre(id)
+		if err != nil {
+			return err
+		}
+		return tx.audit(auditEntityGenre, strconv.Itoa(id), auditActionDelete, before, nil)
+	})
+}
+
+// Merges the genres with the given ids into the genre with id targetId. their performances are
+// refiled under it, and their names and aliases become its aliases
+func (dbw *DBWrapper) MergeGenres(targetId int, ids []int) (*Genre, error) {
+	var target *Genre
+	err := dbw.InTransaction(func(tx *DBWrapper) error {
+		before, err := tx.GetGenreById(targetId)
+		if err != nil {
+			return err
+		}
+		if before == nil {
+			return sql.ErrNoRows
+		}
+
+		after := *before
+		after.Aliases = append([]string{}, before.Aliases...)
+		for i, id := range ids {
+			source, err := tx.GetGenreById(id)
+			if err != nil {
+				return err
+			}
+			if source == nil || id == targetId {
+				v := &validator{}
+				v.add("genreIds["+strconv.Itoa(i)+"]", validationInvalid, "is not another known genre")
+				return v.err()
+			}
+
+			err = tx.refileGenre(id, &after)
+			if err != nil {
+				return err
+			}
+			after.Aliases = append(after.Aliases, source.Name)
+			after.Aliases = append(after.Aliases, source.Aliases...)
+
+			err = tx.removeGenre(id)
+			if err != nil {
+				return err
+			}
+			err = tx.audit(auditEntityGenre, strconv.Itoa(id), auditActionDelete, source, nil)
+			if err != nil {
+				return err
+			}
+		}
+
+		normaliseGenre(&after)
+		err = tx.saveGenreAliases(&after)
+		if err != nil {
+			return err
+		}
+		err = tx.refileGenre(targetId, &after)
+		if err != nil {
+			return err
+		}
+
+		target = &after
+		return tx.audit(auditEntityGenre, strconv.Itoa(targetId), auditActionUpdate, before, target)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return target, nil
+}
+
+// returns how many performances each genre has and how much stage time they take up, biggest
+// first. an editionId other than 0 only counts that edition
+func (dbw *DBWrapper) GetGenreStats(editionId int) ([]*GenreStats, int, error) {
+	dbQuery := `
+		SELECT COALESCE(p.genreId, 0), COALESCE(g.name, ''), COUNT(*),
+			SUM(CASE WHEN p.endTime > p.startTime THEN 1 ELSE 0 END), SUM(p.duration)
+		FROM performances AS p
+		LEFT JOIN genres AS g ON g.id = p.genreId
+		WHERE p.deleted = 0 AND (? = 0 OR p.editionId = ?)
+		GROUP BY COALESCE(p.genreId, 0)
+	`
+	rows, err := dbw.db.Query(dbQuery, editionId, editionId)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	stats := []*GenreStats{}
+	total := 0
+	for rows.Next() {
+		s := &GenreStats{}
+		err := rows.Scan(&s.GenreId, &s.Genre, &s.Performances, &s.Scheduled, &s.StageTime)
+		if err != nil {
+			return nil, 0, err
+		}
+		total += s.StageTime
+		stats = append(stats, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	for _, s := range stats {
+		if total > 0 {
+			s.Share = float64(s.StageTime) / float64(total)
+		}
+	}
+	sort.SliceStable(stats, func(i, j int) bool {
+		if stats[i].StageTime != stats[j].StageTime {
+			return stats[i].StageTime > stats[j].StageTime
+		}
+		return stats[i].Genre < stats[j].Genre
+	})
+	return stats, total, nil
+}
+
+// returns ErrDuplicateGenre if g's name or aliases would match a genre other than the one with id
+func (dbw *DBWrapper) checkGenreNamesFree(g *Genre, id int) error {
+	genres, err := dbw.GetAllGenres()
+	if err != nil {
+		return err
+	}
+
+	names := append([]string{g.Name}, g.Aliases...)
+	for _, other := range genres {
+		if other.Id == id {
+			continue
+		}
+		for _, name := range names {
+			if genreMatches(other, genreKey(name)) {
+				return ErrDuplicateGenre
+			}
+		}
+	}
+	return nil
+}
+
+// replaces the aliases stored for g with the ones it has now
+func (dbw *DBWrapper) saveGenreAliases(g *Genre) error {
+	_, err := dbw.db.Exec(`DELETE FROM genre_aliases WHERE genreId = ?`, g.Id)
+	if err != nil {
+		return err
+	}
+
+	for _, alias := range g.Aliases {
+		_, err := dbw.db.Exec(`INSERT INTO genre_aliases (genreId, alias) VALUES (?, ?)`, g.Id, alias)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// files the performances of the genre with the given id under g, keeping their denormalised
+// genre name in step with it. only performances that actually change get a new version, and
+// each one is recorded in the audit log
+func (dbw *DBWrapper) refileGenre(id int, g *Genre) error {
+	rows, err := dbw.db.Query(`SELECT id FROM performances WHERE genreId = ? AND (genreId <> ? OR genreName <> ?)`, id, g.Id, g.Name)
+	if err != nil {
+		return err
+	}
+	ids := []int{}
+	for rows.Next() {
+		var performanceId int
+		err := rows.Scan(&performanceId)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, performanceId)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, performanceId := range ids {
+		before, err := dbw.getPerformanceRecord(performanceId)
+		if err != nil {
+			return err
+		}
+
+		_, err = dbw.db.Exec(`UPDATE performances SET genreId = ?, genreName = ?, version = version + 1 WHERE id = ?`, g.Id, g.Name, performanceId)
+		if err != nil {
+			return err
+		}
+		err = dbw.reindexPerformance(performanceId)
+		if err != nil {
+			return err
+		}
+
+		after := before.Performance
+		after.GenreId = g.Id
+		after.GenreName = g.Name
+		after.Version++
+		err = dbw.audit(auditEntityPerformance, strconv.Itoa(performanceId), auditActionUpdate, &before.Performance, &after)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// soft deletes the genre, dropping its aliases so their names are free to use again
+func (dbw *DBWrapper) removeGenre(id int) error {
+	_, err := dbw.db.Exec(`DELETE FROM genre_aliases WHERE genreId = ?`, id)
+	if err != nil {
+		return err
+	}
+	_, err = dbw.db.Exec(`UPDATE genres SET deleted = 1 WHERE id = ?`, id)
+	return err
+}
+
+// points p at a genre row, creating one the first time a genre is used. names are matched
+// ignoring case, spaces and punctuation, or by alias, and p.GenreName is rewritten to the
+// genre's own name. a genre made here shows up in the performance's audit entry rather than
+// one of its own
+func (dbw *DBWrapper) resolveGenre(p *Performance) error {
+	if p.GenreId != 0 {
+		g, err := dbw.GetGenreById(p.GenreId)
+		if err != nil {
+			return err
+		}
+		if g == nil {
+			return ErrUnknownGenre
+		}
+		p.GenreName = g.Name
+		return nil
+	}
+
+	if genreKey(p.GenreName) == "" {
+		p.GenreName = ""
+		return nil
+	}
+
+	g, err := dbw.GetGenreByName(p.GenreName)
+	if err != nil {
+		return err
+	}
+	if g == nil {
+		g = &Genre{Name: strings.TrimSpace(p.GenreName), Aliases: []string{}}
+		err = dbw.insertGenre(g)
+		if err != nil {
+			return err
+		}
+	}
+
+	p.GenreId = g.Id
+	p.GenreName = g.Name
+	return nil
+}
+
+// trims g's names and drops aliases that are blank, repeated, or just another spelling of its name
+func normaliseGenre(g *Genre) {
+	g.Name = strings.TrimSpace(g.Name)
+
+	seen := map[string]bool{genreKey(g.Name): true}
+	aliases := []string{}
+	for _, alias := range g.Aliases {
+		alias = strings.TrimSpace(alias)
+		key := genreKey(alias)
+		if alias == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		aliases = append(aliases, alias)
+	}
+	g.Aliases = aliases
+}
+
+// Handles all requests related to genres
+func (api *API) GenreHandler(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	switch r.Method {
+	case http.MethodGet:
+		if path == "/genres" {
+			api.GetAllGenres(w, r)
+		} else if path == "/genres/stats" {
+			api.GetGenreStats(w, r)
+		} else if pathLength(path) > 2 {
+			api.GetPerformancesByGenreId(w, r)
+		} else {
+			api.GetGenreById(w, r)
+		}
+	case http.MethodPost:
+		if strings.HasSuffix(path, "/merge") {
+			api.MergeGenres(w, r)
+		} else {
+			api.CreateNewGenre(w, r)
+		}
+	case http.MethodPut:
+		api.UpdateGenre(w, r)
+	case http.MethodDelete:
+		api.DeleteGenre(w, r)
+	}
+}
+
+// GET /genres - returns all genres
+func (api *API) GetAllGenres(w http.ResponseWriter, r *http.Request) {
+	genres, err := api.wrapper.GetAllGenres()
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Unable to find genres")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, map[string][]*Genre{"genres": genres})
+}
+
+// GET /genres/:id - return genre with given ID
+func (api *API) GetGenreById(w http.ResponseWriter, r *http.Request) {
+	id, err := api.extractId(r.URL.Path)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	genre, err := api.wrapper.GetGenreById(id)
+	if err != nil || genre == nil {
+		api.respondError(w, http.StatusNotFound, "Genre Not Found")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, genre)
+}
+
+// GET /genres/:id/performances - returns performances filed under the genre with the specified id
+func (api *API) GetPerformancesByGenreId(w http.ResponseWriter, r *http.Request) {
+	id, err := api.extractId(r.URL.Path)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Error extracting id")
+		return
+	}
+
+	performances, err := api.wrapper.GetPerformancesByGenreId(id)
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Unable to find performances")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, map[string][]*Performance{"performances": performances})
+}
+
+// GET /genres/stats - returns the number of performances and stage time for each genre.
+// ?editionId= only counts one edition
+func (api *API) GetGenreStats(w http.ResponseWriter, r *http.Request) {
+	editionId, ok := api.reportEditionId(w, r)
+	if !ok {
+		return
+	}
+
+	stats, total, err := api.wrapper.GetGenreStats(editionId)
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Unable to count genres")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, map[string]interface{}{"genres": stats, "totalStageTime": total})
+}
+
+// POST /genres/ - Create a new genre
+func (api *API) CreateNewGenre(w http.ResponseWriter, r *http.Request) {
+	var genre Genre
+
+	err := json.NewDecoder(r.Body).Decode(&genre)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	newGenre, err := api.wrapperFor(r).CreateGenre(&genre)
+	if api.respondIfInvalid(w, err) {
+		return
+	}
+	if errors.Is(err, ErrDuplicateGenre) {
+		api.respondError(w, http.StatusConflict, "Genre already exists")
+		return
+	}
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Failed to create genre")
+		return
+	}
+
+	api.respondJSON(w, http.StatusCreated, newGenre)
+}
+
+// PUT /genres/:id - renames the genre with the specified id and replaces its aliases
+func (api *API) UpdateGenre(w http.ResponseWriter, r *http.Request) {
+	var genre Genre
+
+	err := json.NewDecoder(r.Body).Decode(&genre)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	id, err := api.extractId(r.URL.Path)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid ID provided")
+		return
+	}
+
+	err = api.wrapperFor(r).UpdateGenreById(id, &genre)
+	if api.respondIfInvalid(w, err) {
+		return
+	}
+	if errors.Is(err, ErrDuplicateGenre) {
+		api.respondError(w, http.StatusConflict, "Genre already exists")
+		return
+	}
+	if err == sql.ErrNoRows {
+		api.respondError(w, http.StatusNotFound, "Genre Not Found")
+		return
+	}
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Error updating genre")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, genre)
+}
+
+// POST /genres/:id/merge - merges the genres in the body's genreIds into the genre with the specified id
+func (api *API) MergeGenres(w http.ResponseWriter, r *http.Request) {
+	body := struct {
+		GenreIds []int `json:"genreIds"`
+	}{}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	id, err := api.extractId(r.URL.Path)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid ID provided")
+		return
+	}
+
+	genre, err := api.wrapperFor(r).MergeGenres(id, body.GenreIds)
+	if api.respondIfInvalid(w, err) {
+		return
+	}
+	if err == sql.ErrNoRows {
+		api.respondError(w, http.StatusNotFound, "Genre Not Found")
+		return
+	}
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Error merging genres")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, genre)
+}
+
+// DELETE /genres/:id - deletes the genre with the specified id, as long as it has no performances
+func (api *API) DeleteGenre(w http.ResponseWriter, r *http.Request) {
+	id, err := api.extractId(r.URL.Path)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid ID provided")
+		return
+	}
+
+	err = api.wrapperFor(r).DeleteGenreById(id)
+	if errors.Is(err, ErrGenreInUse) {
+		api.respondError(w, http.StatusConflict, "Genre still has performances, merge it into another genre instead")
+		return
+	}
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Error deleting genre")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
@@ -0,0 +1,192 @@
+package internal_test
+
+import (
+	"encoding/json"
+	internal "foc_api/internal"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPerformancesShareGenresAcrossSpellings(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	genre, err := dbw.CreateGenre(&internal.Genre{Name: "Drum and Bass", Aliases: []string{"DnB"}})
+	require.NoError(t, err, "CreateGenre() failed: %v", err)
+
+	// act
+	spellings := []string{"Hip Hop", "hip-hop", "HipHop", "dnb", ""}
+	performances := []*internal.Performance{}
+	for _, spelling := range spellings {
+		p, err := dbw.CreatePerformance(&internal.Performance{ItemName: "Act " + spelling, GenreName: spelling})
+		require.NoError(t, err, "CreatePerformance() failed: %v", err)
+		performances = append(performances, p)
+	}
+	_, duplicateErr := dbw.CreateGenre(&internal.Genre{Name: "drum-and-bass"})
+
+	// assert
+	assert.NotZero(t, performances[0].GenreId)
+	for _, p := range performances[1:3] {
+		assert.Equal(t, performances[0].GenreId, p.GenreId, "%q should be filed under the same genre", p.ItemName)
+		assert.Equal(t, "Hip Hop", p.GenreName, "Genre name should be the genre's own spelling")
+	}
+	assert.Equal(t, genre.Id, performances[3].GenreId, "Alias should match its genre")
+	assert.Equal(t, "Drum and Bass", performances[3].GenreName)
+	assert.Equal(t, 0, performances[4].GenreId)
+	assert.ErrorIs(t, duplicateErr, internal.ErrDuplicateGenre)
+
+	genres, err := dbw.GetAllGenres()
+	require.NoError(t, err, "GetAllGenres() failed: %v", err)
+	assert.Len(t, genres, 2)
+}
+
+func TestRenameAndMergeGenres(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	hipHop, err := dbw.CreatePerformance(&internal.Performance{ItemName: "Act One", GenreName: "Hip Hop"})
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+	rap, err := dbw.CreatePerformance(&internal.Performance{ItemName: "Act Two", GenreName: "Rap"})
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+
+	// act
+	err = dbw.UpdateGenreById(hipHop.GenreId, &internal.Genre{Name: "Hip-Hop"})
+	require.NoError(t, err, "UpdateGenreById() failed: %v", err)
+	merged, err := dbw.MergeGenres(hipHop.GenreId, []int{rap.GenreId})
+	require.NoError(t, err, "MergeGenres() failed: %v", err)
+	deleteErr := dbw.DeleteGenreById(hipHop.GenreId)
+
+	// assert
+	assert.Equal(t, []string{"Rap"}, merged.Aliases)
+
+	stored, err := dbw.GetPerformanceById(rap.Id)
+	require.NoError(t, err, "GetPerformanceById() failed: %v", err)
+	assert.Equal(t, hipHop.GenreId, stored.GenreId)
+	assert.Equal(t, "Hip-Hop", stored.GenreName)
+	assert.Equal(t, rap.Version+1, stored.Version, "Refiled performance should get a new version")
+
+	entries, _, err := dbw.ListAuditEntries(url.Values{"entity": {"performance"}, "id": {strconv.Itoa(rap.Id)}})
+	require.NoError(t, err, "ListAuditEntries() failed: %v", err)
+	require.Len(t, entries, 2, "Refiling should be recorded as an update")
+	var refiled internal.Performance
+	require.NoError(t, json.Unmarshal(entries[1].After, &refiled))
+	assert.Equal(t, "update", entries[1].Action)
+	assert.Equal(t, hipHop.GenreId, refiled.GenreId)
+	assert.Equal(t, stored.Version, refiled.Version)
+
+	stored, err = dbw.GetPerformanceById(hipHop.Id)
+	require.NoError(t, err, "GetPerformanceById() failed: %v", err)
+	assert.Equal(t, "Hip-Hop", stored.GenreName, "Rename should reach the genre's performances")
+
+	gone, err := dbw.GetGenreById(rap.GenreId)
+	require.NoError(t, err, "GetGenreById() failed: %v", err)
+	assert.Nil(t, gone, "Merged genre should be deleted")
+
+	p, err := dbw.CreatePerformance(&internal.Performance{ItemName: "Act Three", GenreName: "rap"})
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+	assert.Equal(t, hipHop.GenreId, p.GenreId, "Merged name should still find the genre")
+
+	assert.ErrorIs(t, deleteErr, internal.ErrGenreInUse)
+}
+
+func TestGenreStatsEndpoint(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+	api := internal.NewAPI(dbw)
+
+	start := time.Date(2025, 9, 1, 18, 0, 0, 0, time.UTC)
+	performances := []*internal.Performance{
+		{ItemName: "Act One", GenreName: "Jazz", Location: "Main Stage", StartTime: start, EndTime: start.Add(time.Hour)},
+		{ItemName: "Act Two", GenreName: "jazz", Location: "Main Stage", StartTime: start.Add(time.Hour), EndTime: start.Add(2 * time.Hour)},
+		{ItemName: "Act Three", GenreName: "Folk", Duration: 1800},
+		{ItemName: "Act Four", Duration: 900},
+	}
+	for _, p := range performances {
+		_, err := dbw.CreatePerformance(p)
+		require.NoError(t, err, "CreatePerformance() failed: %v", err)
+	}
+
+	r := httptest.NewRequest("GET", "/genres/stats", nil)
+	w := httptest.NewRecorder()
+
+	// act
+	api.GenreHandler(w, r)
+
+	// assert
+	require.Equal(t, http.StatusOK, w.Code, "GenreHandler() returned status %v", w.Code)
+	var response struct {
+		Genres         []*internal.GenreStats `json:"genres"`
+		TotalStageTime int                    `json:"totalStageTime"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	assert.Equal(t, 9900, response.TotalStageTime)
+	require.Len(t, response.Genres, 3)
+
+	jazz := response.Genres[0]
+	assert.Equal(t, "Jazz", jazz.Genre)
+	assert.Equal(t, 2, jazz.Performances)
+	assert.Equal(t, 2, jazz.Scheduled)
+	assert.Equal(t, 7200, jazz.StageTime)
+	assert.InDelta(t, 7200.0/9900, jazz.Share, 0.0001)
+
+	assert.Equal(t, "Folk", response.Genres[1].Genre)
+	assert.Equal(t, 0, response.Genres[1].Scheduled)
+	assert.Equal(t, 0, response.Genres[2].GenreId, "Performances without a genre should be counted too")
+}
+
+func TestGenreEndpoints(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+	api := internal.NewAPI(dbw)
+
+	_, err := dbw.CreatePerformance(&internal.Performance{ItemName: "Act One", GenreName: "Jazz"})
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+
+	cases := []struct {
+		method, path, body string
+		expected           int
+	}{
+		{"GET", "/genres/1/performances", "", http.StatusOK},
+		{"GET", "/genres/99", "", http.StatusNotFound},
+		{"POST", "/genres", `{"name": "Folk", "aliases": ["Trad"]}`, http.StatusCreated},
+		{"POST", "/genres", `{"name": "JAZZ"}`, http.StatusConflict},
+		{"POST", "/genres", `{"name": "--"}`, http.StatusUnprocessableEntity},
+		{"PUT", "/genres/2", `{"name": "Folk", "aliases": ["jazz"]}`, http.StatusConflict},
+		{"PUT", "/genres/99", `{"name": "Blues"}`, http.StatusNotFound},
+		{"POST", "/genres/1/merge", `{"genreIds": [1]}`, http.StatusUnprocessableEntity},
+		{"DELETE", "/genres/1", "", http.StatusConflict},
+		{"DELETE", "/genres/2", "", http.StatusOK},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest(c.method, c.path, strings.NewReader(c.body))
+		w := httptest.NewRecorder()
+
+		// act
+		api.GenreHandler(w, r)
+
+		// assert
+		assert.Equal(t, c.expected, w.Code, "%s %s %s returned the wrong status", c.method, c.path, c.body)
+	}
+
+	genres, err := dbw.GetAllGenres()
+	require.NoError(t, err, "GetAllGenres() failed: %v", err)
+	require.Len(t, genres, 1)
+	assert.Equal(t, "Jazz", genres[0].Name)
+}
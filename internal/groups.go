@@ -0,0 +1,819 @@
+package internal
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// a band or other set of performers who appear together. assigning a group to a performance
+// books all of its members into it
+type Group struct {
+	Id        int    `json:"id"`
+	Name      string `json:"name"`
+	MemberIds []int  `json:"memberIds"`
+}
+
+var (
+	ErrUnknownGroup   = errors.New("group does not exist")
+	ErrDuplicateGroup = errors.New("a group with that name already exists")
+	ErrGroupInUse     = errors.New("group still has performances")
+)
+
+// creates a group and puts it into the db, booking its members into nothing yet since it
+// doesn't have any performances
+func (dbw *DBWrapper) CreateGroup(g *Group) (*Group, error) {
+	normaliseGroup(g)
+	err := validateGroup(g)
+	if err != nil {
+		return nil, err
+	}
+
+	err = dbw.InTransaction(func(tx *DBWrapper) error {
+		err := tx.checkGroupMembers(g)
+		if err != nil {
+			return err
+		}
+		err = tx.insertGroup(g)
+		if err != nil {
+			return err
+		}
+		return tx.audit(auditEntityGroup, strconv.Itoa(g.Id), auditActionCreate, nil, g)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// puts g into the db without auditing it, for groups that are made as part of another change
+func (dbw *DBWrapper) insertGroup(g *Group) error {
+	existing, err := dbw.GetGroupByName(g.Name)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return ErrDuplicateGroup
+	}
+
+	err = dbw.db.QueryRow(`INSERT INTO groups (name) VALUES (?) RETURNING id`, g.Name).Scan(&g.Id)
+	if err != nil {
+		return err
+	}
+	return dbw.saveGroupMembers(g)
+}
+
+// returns a slice with all the groups in the db, in name order
+func (dbw *DBWrapper) GetAllGroups() ([]*Group, error) {
+	return dbw.findGroups(`deleted = 0`)
+}
+
+// Return the group with the given id
+func (dbw *DBWrapper) GetGroupById(id int) (*Group, error) {
+	groups, err := dbw.findGroups(`deleted = 0 AND id = ?`, id)
+	if err != nil || len(groups) == 0 {
+		return nil, err
+	}
+	return groups[0], nil
+}
+
+// Return the group with the given name, ignoring case
+func (dbw *DBWrapper) GetGroupByName(name string) (*Group, error) {
+	groups, err := dbw.findGroups(`deleted = 0 AND name = ?`, strings.TrimSpace(name))
+	if err != nil || len(groups) == 0 {
+		return nil, err
+	}
+	return groups[0], nil
+}
+
+// returns the groups matching where, along with the members who haven't been deleted
+func (dbw *DBWrapper) findGroups(where string, args ...interface{}) ([]*Group, error) {
+	rows, err := dbw.db.Query(`SELECT id, name FROM groups WHERE `+where+` ORDER BY name ASC, id ASC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []*Group{}
+	for rows.Next() {
+		g := &Group{}
+		err := rows.Scan(&g.Id, &g.Name)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for _, g := range groups {
+		g.MemberIds, err = dbw.getGroupMemberIds(g.Id)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return groups, nil
+}
+
+// returns the ids of the group's members who haven't been deleted, lowest first
+func (dbw *DBWrapper) getGroupMemberIds(groupId int) ([]int, error) {
+	return dbw.queryGroupMemberIds(groupId, false)
+}
+
+// returns the ids of all the group's members, lowest first. deleted performers stay members
+// until they're purged, so they're only left out when includeDeleted is false
+func (dbw *DBWrapper) queryGroupMemberIds(groupId int, includeDeleted bool) ([]int, error) {
+	dbQuery := `
+		SELECT m.performerId
+		FROM group_members AS m
+		INNER JOIN performers AS p ON p.id = m.performerId
+		WHERE m.groupId = ? AND (p.deleted = 0 OR ?)
+		ORDER BY m.performerId ASC
+	`
+	rows, err := dbw.db.Query(dbQuery, groupId, includeDeleted)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// Returns the performers in the group with the given id
+func (dbw *DBWrapper) GetPerformersByGroupId(groupId int) ([]*Performer, error) {
+	dbQuery := `
+		SELECT ` + performerColumns + `
+		FROM performers AS p
+		INNER JOIN group_members AS m ON m.performerId = p.id
+		WHERE m.groupId = ? AND p.deleted = 0
+		ORDER BY p.id ASC
+	`
+
+	rows, err := dbw.db.Query(dbQuery, groupId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	performers := []*Performer{}
+	for rows.Next() {
+		p, err := scanPerformer(rows)
+		if err != nil {
+			return nil, err
+		}
+		performers = append(performers, p)
+	}
+
+	return performers, nil
+}
+
+// Returns all the performances the group with the given id is booked into
+func (dbw *DBWrapper) GetPerformancesByGroupId(groupId int) ([]*Performance, error) {
+	dbQuery := `
+		SELECT ` + performanceColumns + `
+		FROM performances AS p
+		WHERE p.groupId = ? AND p.deleted = 0
+		ORDER BY p.startTime ASC, p.id ASC
+	`
+
+	rows, err := dbw.db.Query(dbQuery, groupId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	performances := []*Performance{}
+	for rows.Next() {
+		p, err := scanPerformance(rows)
+		if err != nil {
+			return nil, err
+		}
+		performances = append(performances, p)
+	}
+
+	return performances, nil
+}
+
+// Renames the group with the given id and replaces its members. new members are booked into
+// the group's performances and members who left are taken out of them
+func (dbw *DBWrapper) UpdateGroupById(id int, g *Group) error {
+	normaliseGroup(g)
+	err := validateGroup(g)
+	if err != nil {
+		return err
+	}
+
+	return dbw.InTransaction(func(tx *DBWrapper) error {
+		before, err := tx.GetGroupById(id)
+		if err != nil {
+			return err
+		}
+		if before == nil {
+			return sql.ErrNoRows
+		}
+
+		existing, err := tx.GetGroupByName(g.Name)
+		if err != nil {
+			return err
+		}
+		if existing != nil && existing.Id != id {
+			return ErrDuplicateGroup
+		}
+		err = tx.checkGroupMembers(g)
+		if err != nil {
+			return err
+		}
+
+		g.Id = id
+		_, err = tx.db.Exec(`UPDATE groups SET name = ? WHERE id = ?`, g.Name, id)
+		if err != nil {
+			return err
+		}
+		err = tx.saveGroupMembers(g)
+		if err != nil {
+			return err
+		}
+		err = tx.renameGroupPerformances(g)
+		if err != nil {
+			return err
+		}
+		err = tx.syncGroupPerformances(id)
+		if err != nil {
+			return err
+		}
+
+		return tx.audit(auditEntityGroup, strconv.Itoa(id), auditActionUpdate, before, g)
+	})
+}
+
+// Adds the performer to the group with the given id and books them into its performances
+func (dbw *DBWrapper) AddGroupMember(id, performerId int) (*Group, error) {
+	var after *Group
+	err := dbw.InTransaction(func(tx *DBWrapper) error {
+		before, err := tx.GetGroupById(id)
+		if err != nil {
+			return err
+		}
+		if before == nil {
+			return sql.ErrNoRows
+		}
+
+		g := *before
+		g.MemberIds = append(append([]int{}, before.MemberIds...), performerId)
+		err = tx.UpdateGroupById(id, &g)
+		if err != nil {
+			return err
+		}
+		after = &g
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return after, nil
+}
+
+// Takes the performer out of the group with the given id, along with the performances they
+// were booked into through it
+func (dbw *DBWrapper) RemoveGroupMember(id, performerId int) (*Group, error) {
+	var after *Group
+	err := dbw.InTransaction(func(tx *DBWrapper) error {
+		before, err := tx.GetGroupById(id)
+		if err != nil {
+			return err
+		}
+		if before == nil {
+			return sql.ErrNoRows
+		}
+
+		g := *before
+		g.MemberIds = []int{}
+		for _, memberId := range before.MemberIds {
+			if memberId != performerId {
+				g.MemberIds = append(g.MemberIds, memberId)
+			}
+		}
+		err = tx.UpdateGroupById(id, &g)
+		if err != nil {
+			return err
+		}
+		after = &g
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return after, nil
+}
+
+// Deletes the group with the given id. groups still booked into performances can't be deleted
+func (dbw *DBWrapper) DeleteGroupById(id int) error {
+	return dbw.InTransaction(func(tx *DBWrapper) error {
+		before, err := tx.GetGroupById(id)
+		if err != nil {
+			return err
+		}
+		// deleting something that's already gone doesn't change anything
+		if before == nil {
+			return nil
+		}
+
+		performances, err := tx.GetPerformancesByGroupId(id)
+		if err != nil {
+			return err
+		}
+		if len(performances) > 0 {
+			return ErrGroupInUse
+		}
+
+		_, err = tx.db.Exec(`UPDATE groups SET deleted = 1 WHERE id = ?`, id)
+		if err != nil {
+			return err
+		}
+		return tx.audit(auditEntityGroup, strconv.Itoa(id), auditActionDelete, before, nil)
+	})
+}
+
+// returns a ValidationError if any of g's members aren't performers
+func (dbw *DBWrapper) checkGroupMembers(g *Group) error {
+	v := &validator{}
+	for i, performerId := range g.MemberIds {
+		performer, err := dbw.GetPerformerById(performerId)
+		if err != nil {
+			return err
+		}
+		if performer == nil {
+			v.add("memberIds["+strconv.Itoa(i)+"]", validationInvalid, "is not a known performer")
+		}
+	}
+	return v.err()
+}
+
+// replaces the members stored for g with the ones it has now. deleted performers aren't in
+// g.MemberIds when it's read back, so they're kept rather than dropped from the group
+func (dbw *DBWrapper) saveGroupMembers(g *Group) error {
+	_, err := dbw.db.Exec(`DELETE FROM group_members WHERE groupId = ? AND performerId NOT IN (SELECT id FROM performers WHERE deleted = 1)`, g.Id)
+	if err != nil {
+		return err
+	}
+
+	for _, performerId := range g.MemberIds {
+		_, err := dbw.db.Exec(`INSERT OR IGNORE INTO group_members (groupId, performerId) VALUES (?, ?)`, g.Id, performerId)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keeps the denormalised group name on the group's performances in step with g. only
+// performances whose group name actually changes get a new version, and each one is recorded
+// in the audit log
+func (dbw *DBWrapper) renameGroupPerformances(g *Group) error {
+	rows, err := dbw.db.Query(`SELECT id FROM performances WHERE groupId = ? AND groupName <> ?`, g.Id, g.Name)
+	if err != nil {
+		return err
+	}
+	ids := []int{}
+	for rows.Next() {
+		var performanceId int
+		err := rows.Scan(&performanceId)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, performanceId)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, performanceId := range ids {
+		before, err := dbw.getPerformanceRecord(performanceId)
+		if err != nil {
+			return err
+		}
+
+		_, err = dbw.db.Exec(`UPDATE performances SET groupName = ?, version = version + 1 WHERE id = ?`, g.Name, performanceId)
+		if err != nil {
+			return err
+		}
+		err = dbw.reindexPerformance(performanceId)
+		if err != nil {
+			return err
+		}
+
+		after := before.Performance
+		after.GroupName = g.Name
+		after.Version++
+		err = dbw.audit(auditEntityPerformance, strconv.Itoa(performanceId), auditActionUpdate, &before.Performance, &after)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// brings the junctions of every performance the group is booked into in step with its members
+func (dbw *DBWrapper) syncGroupPerformances(groupId int) error {
+	performances, err := dbw.GetPerformancesByGroupId(groupId)
+	if err != nil {
+		return err
+	}
+
+	conflicts := []*Conflict{}
+	for _, p := range performances {
+		err := dbw.syncGroupJunctions(p.Id)
+		var conflictErr *ConflictError
+		if errors.As(err, &conflictErr) {
+			conflicts = append(conflicts, conflictErr.Conflicts...)
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return &ConflictError{Conflicts: conflicts}
+	}
+	return nil
+}
+
+// keeps the junctions a performance got from its group in step with the group's members.
+// junctions from a group it's no longer in, or for performers who have left the group, are
+// deleted and members who aren't booked yet are added. deleted members keep their junctions
+// so restoring them books them back in. performers booked on their own are left alone.
+// returns a ConflictError if a member would be double-booked
+func (dbw *DBWrapper) syncGroupJunctions(performanceId int) error {
+	p, err := dbw.GetPerformanceById(performanceId)
+	if err != nil || p == nil {
+		return err
+	}
+
+	members := []int{}
+	isMember := map[int]bool{}
+	if p.GroupId != 0 {
+		members, err = dbw.getGroupMemberIds(p.GroupId)
+		if err != nil {
+			return err
+		}
+		allMembers, err := dbw.queryGroupMemberIds(p.GroupId, true)
+		if err != nil {
+			return err
+		}
+		for _, performerId := range allMembers {
+			isMember[performerId] = true
+		}
+	}
+
+	junctions, err := dbw.getJunctions("performance_id", performanceId)
+	if err != nil {
+		return err
+	}
+	booked := map[int]bool{}
+	for _, j := range junctions {
+		if j.GroupId != 0 && (j.GroupId != p.GroupId || !isMember[j.PerformerId]) {
+			err := dbw.DeleteJunction(j.PerformerId, performanceId)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		booked[j.PerformerId] = true
+	}
+
+	conflicts := []*Conflict{}
+	for _, performerId := range members {
+		if booked[performerId] {
+			continue
+		}
+
+		found, err := dbw.FindPerformerConflicts(performerId, p)
+		if err != nil {
+			return err
+		}
+		if len(found) > 0 {
+			conflicts = append(conflicts, found...)
+			continue
+		}
+
+		_, err = dbw.db.Exec(`INSERT INTO junction (performer_id, performance_id, groupId) VALUES (?, ?, ?)`, performerId, performanceId, p.GroupId)
+		if err != nil {
+			return err
+		}
+		junction := &ExportedJunction{PerformerId: performerId, PerformanceId: performanceId, GroupId: p.GroupId}
+		err = dbw.audit(auditEntityJunction, junctionAuditId(performerId, performanceId), auditActionCreate, nil, junction)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return &ConflictError{Conflicts: conflicts}
+	}
+	return nil
+}
+
+// points p at a group row, creating one the first time a group name is used. names are matched
+// ignoring case, and p.GroupName is rewritten to the group's own name. a group made here shows
+// up in the performance's audit entry rather than one of its own
+func (dbw *DBWrapper) resolveGroup(p *Performance) error {
+	if p.GroupId != 0 {
+		g, err := dbw.GetGroupById(p.GroupId)
+		if err != nil {
+			return err
+		}
+		if g == nil {
+			return ErrUnknownGroup
+		}
+		p.GroupName = g.Name
+		return nil
+	}
+
+	if strings.TrimSpace(p.GroupName) == "" {
+		p.GroupName = ""
+		return nil
+	}
+
+	g, err := dbw.GetGroupByName(p.GroupName)
+	if err != nil {
+		return err
+	}
+	if g == nil {
+		g = &Group{Name: strings.TrimSpace(p.GroupName), MemberIds: []int{}}
+		err = dbw.insertGroup(g)
+		if err != nil {
+			return err
+		}
+	}
+
+	p.GroupId = g.Id
+	p.GroupName = g.Name
+	return nil
+}
+
+// trims g's name and drops repeated members
+func normaliseGroup(g *Group) {
+	g.Name = strings.TrimSpace(g.Name)
+
+	seen := map[int]bool{}
+	members := []int{}
+	for _, performerId := range g.MemberIds {
+		if seen[performerId] {
+			continue
+		}
+		seen[performerId] = true
+		members = append(members, performerId)
+	}
+	sort.Ints(members)
+	g.MemberIds = members
+}
+
+// Handles all requests related to groups
+func (api *API) GroupHandler(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	switch r.Method {
+	case http.MethodGet:
+		if path == "/groups" {
+			api.GetAllGroups(w, r)
+		} else if pathLength(path) == 2 {
+			api.GetGroupById(w, r)
+		} else if pathLength(path) == 3 && strings.HasSuffix(path, "/members") {
+			api.GetPerformersByGroupId(w, r)
+		} else if pathLength(path) == 3 && strings.HasSuffix(path, "/performances") {
+			api.GetPerformancesByGroupId(w, r)
+		} else {
+			api.respondError(w, http.StatusNotFound, "Not Found")
+		}
+	case http.MethodPost:
+		if path == "/groups" {
+			api.CreateNewGroup(w, r)
+		} else if pathLength(path) == 3 && strings.HasSuffix(path, "/members") {
+			api.AddGroupMember(w, r)
+		} else {
+			api.respondError(w, http.StatusNotFound, "Not Found")
+		}
+	case http.MethodPut:
+		if pathLength(path) == 2 {
+			api.UpdateGroup(w, r)
+		} else {
+			api.respondError(w, http.StatusNotFound, "Not Found")
+		}
+	case http.MethodDelete:
+		if pathLength(path) == 2 {
+			api.DeleteGroup(w, r)
+		} else if pathLength(path) == 4 && strings.Split(path, "/")[3] == "members" {
+			api.RemoveGroupMember(w, r)
+		} else {
+			api.respondError(w, http.StatusNotFound, "Not Found")
+		}
+	}
+}
+
+// GET /groups - returns all groups
+func (api *API) GetAllGroups(w http.ResponseWriter, r *http.Request) {
+	groups, err := api.wrapper.GetAllGroups()
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Unable to find groups")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, map[string][]*Group{"groups": groups})
+}
+
+// GET /groups/:id - return group with given ID
+func (api *API) GetGroupById(w http.ResponseWriter, r *http.Request) {
+	id, err := api.extractId(r.URL.Path)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	group, err := api.wrapper.GetGroupById(id)
+	if err != nil || group == nil {
+		api.respondError(w, http.StatusNotFound, "Group Not Found")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, group)
+}
+
+// GET /groups/:id/members - returns the performers in the group with the specified id
+func (api *API) GetPerformersByGroupId(w http.ResponseWriter, r *http.Request) {
+	id, err := api.extractId(r.URL.Path)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Error extracting id")
+		return
+	}
+
+	performers, err := api.wrapper.GetPerformersByGroupId(id)
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Unable to find performers")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, map[string][]*Performer{"performers": performers})
+}
+
+// GET /groups/:id/performances - returns the performances the group with the specified id is booked into
+func (api *API) GetPerformancesByGroupId(w http.ResponseWriter, r *http.Request) {
+	id, err := api.extractId(r.URL.Path)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Error extracting id")
+		return
+	}
+
+	performances, err := api.wrapper.GetPerformancesByGroupId(id)
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Unable to find performances")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, map[string][]*Performance{"performances": performances})
+}
+
+// POST /groups/ - Create a new group
+func (api *API) CreateNewGroup(w http.ResponseWriter, r *http.Request) {
+	var group Group
+
+	err := json.NewDecoder(r.Body).Decode(&group)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	newGroup, err := api.wrapperFor(r).CreateGroup(&group)
+	if api.respondIfInvalid(w, err) {
+		return
+	}
+	if errors.Is(err, ErrDuplicateGroup) {
+		api.respondError(w, http.StatusConflict, "Group already exists")
+		return
+	}
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Failed to create group")
+		return
+	}
+
+	api.respondJSON(w, http.StatusCreated, newGroup)
+}
+
+// PUT /groups/:id - renames the group with the specified id and replaces its members
+func (api *API) UpdateGroup(w http.ResponseWriter, r *http.Request) {
+	var group Group
+
+	err := json.NewDecoder(r.Body).Decode(&group)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	id, err := api.extractId(r.URL.Path)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid ID provided")
+		return
+	}
+
+	err = api.wrapperFor(r).UpdateGroupById(id, &group)
+	if !api.respondIfGroupError(w, err) {
+		api.respondJSON(w, http.StatusOK, group)
+	}
+}
+
+// POST /groups/:id/members - adds the performer in the body to the group with the specified id
+func (api *API) AddGroupMember(w http.ResponseWriter, r *http.Request) {
+	body := struct {
+		PerformerId int `json:"performerId"`
+	}{}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	id, err := api.extractId(r.URL.Path)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid ID provided")
+		return
+	}
+
+	group, err := api.wrapperFor(r).AddGroupMember(id, body.PerformerId)
+	if !api.respondIfGroupError(w, err) {
+		api.respondJSON(w, http.StatusOK, group)
+	}
+}
+
+// DELETE /groups/:id/members/:performerId - takes the performer out of the group with the specified id
+func (api *API) RemoveGroupMember(w http.ResponseWriter, r *http.Request) {
+	id, err := api.extractId(r.URL.Path)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid ID provided")
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	performerId, err := strconv.Atoi(parts[len(parts)-1])
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid ID provided")
+		return
+	}
+
+	group, err := api.wrapperFor(r).RemoveGroupMember(id, performerId)
+	if !api.respondIfGroupError(w, err) {
+		api.respondJSON(w, http.StatusOK, group)
+	}
+}
+
+// responds to the errors changing a group can give, and reports whether it did
+func (api *API) respondIfGroupError(w http.ResponseWriter, err error) bool {
+	if err == nil {
+		return false
+	}
+	if api.respondIfInvalid(w, err) || api.respondIfConflict(w, err) {
+		return true
+	}
+	if errors.Is(err, ErrDuplicateGroup) {
+		api.respondError(w, http.StatusConflict, "Group already exists")
+	} else if err == sql.ErrNoRows {
+		api.respondError(w, http.StatusNotFound, "Group Not Found")
+	} else {
+		api.respondError(w, http.StatusInternalServerError, "Error updating group")
+	}
+	return true
+}
+
+// DELETE /groups/:id - deletes the group with the specified id, as long as it has no performances
+func (api *API) DeleteGroup(w http.ResponseWriter, r *http.Request) {
+	id, err := api.extractId(r.URL.Path)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid ID provided")
+		return
+	}
+
+	err = api.wrapperFor(r).DeleteGroupById(id)
+	if errors.Is(err, ErrGroupInUse) {
+		api.respondError(w, http.StatusConflict, "Group still has performances")
+		return
+	}
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Error deleting group")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
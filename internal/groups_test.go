@@ -0,0 +1,268 @@
+package internal_test
+
+import (
+	"encoding/json"
+	internal "foc_api/internal"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// returns the ids of the performers booked into the performance, and the group each came with
+func bookedGroups(t *testing.T, dbw *internal.DBWrapper, performanceId int) map[int]int {
+	performers, err := dbw.GetPerformersByPerformanceId(performanceId)
+	require.NoError(t, err, "GetPerformersByPerformanceId() failed: %v", err)
+
+	booked := map[int]int{}
+	for _, performer := range performers {
+		j, err := dbw.GetJunction(performer.Id, performanceId)
+		require.NoError(t, err, "GetJunction() failed: %v", err)
+		booked[performer.Id] = j.GroupId
+	}
+	return booked
+}
+
+func TestGroupMembersFollowTheirPerformances(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	performers := []*internal.Performer{}
+	for _, name := range []string{"Ada", "Brian", "Cleo"} {
+		performer, err := dbw.CreatePerformer(&internal.Performer{Name: name, Email: name + "@test.com"})
+		require.NoError(t, err, "CreatePerformer() failed: %v", err)
+		performers = append(performers, performer)
+	}
+	ada, brian, cleo := performers[0].Id, performers[1].Id, performers[2].Id
+
+	band, err := dbw.CreateGroup(&internal.Group{Name: "The Band", MemberIds: []int{ada, brian}})
+	require.NoError(t, err, "CreateGroup() failed: %v", err)
+	duo, err := dbw.CreateGroup(&internal.Group{Name: "The Duo", MemberIds: []int{cleo}})
+	require.NoError(t, err, "CreateGroup() failed: %v", err)
+
+	// act
+	p, err := dbw.CreatePerformance(&internal.Performance{ItemName: "Opening Set", GroupName: "the band"})
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+	created := bookedGroups(t, dbw, p.Id)
+	resolvedGroupId := p.GroupId
+
+	// cleo is booked on their own before joining, so stays booked after leaving
+	require.NoError(t, dbw.CreateJunction(cleo, p.Id))
+	_, err = dbw.AddGroupMember(band.Id, cleo)
+	require.NoError(t, err, "AddGroupMember() failed: %v", err)
+	_, err = dbw.RemoveGroupMember(band.Id, ada)
+	require.NoError(t, err, "RemoveGroupMember() failed: %v", err)
+	_, err = dbw.RemoveGroupMember(band.Id, cleo)
+	require.NoError(t, err, "RemoveGroupMember() failed: %v", err)
+	afterMembership := bookedGroups(t, dbw, p.Id)
+
+	p.GroupId = duo.Id
+	p.GroupName = ""
+	err = dbw.UpdatePerformanceById(p.Id, p)
+	require.NoError(t, err, "UpdatePerformanceById() failed: %v", err)
+	afterMove := bookedGroups(t, dbw, p.Id)
+
+	// assert
+	assert.Equal(t, band.Id, resolvedGroupId, "Group name should resolve to the group")
+	assert.Equal(t, map[int]int{ada: band.Id, brian: band.Id}, created, "Members should be booked with their group")
+	assert.Equal(t, map[int]int{brian: band.Id, cleo: 0}, afterMembership, "Only junctions from the group should follow its members")
+	assert.Equal(t, map[int]int{cleo: 0}, afterMove, "Moving to another group should swap the members")
+	assert.Equal(t, "The Duo", p.GroupName)
+}
+
+func TestAddGroupMemberRejectsDoubleBooking(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	performer, err := dbw.CreatePerformer(getTestPerformer())
+	require.NoError(t, err, "CreatePerformer() failed: %v", err)
+
+	start := time.Date(2025, 9, 1, 18, 0, 0, 0, time.UTC)
+	solo := createTestPerformance(t, dbw, "Solo Set", "Side Stage", start, time.Hour)
+	require.NoError(t, dbw.CreateJunction(performer.Id, solo.Id))
+
+	group, err := dbw.CreateGroup(&internal.Group{Name: "The Band"})
+	require.NoError(t, err, "CreateGroup() failed: %v", err)
+	_, err = dbw.CreatePerformance(&internal.Performance{ItemName: "Band Set", GroupId: group.Id, Location: "Main Stage", StartTime: start, EndTime: start.Add(time.Hour)})
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+
+	// act
+	_, err = dbw.AddGroupMember(group.Id, performer.Id)
+
+	// assert
+	assert.IsType(t, &internal.ConflictError{}, err, "Joining a group mustn't double-book the performer")
+
+	stored, err := dbw.GetGroupById(group.Id)
+	require.NoError(t, err, "GetGroupById() failed: %v", err)
+	assert.Empty(t, stored.MemberIds, "Membership should be rolled back")
+}
+
+func TestArchivedGroupMembersKeepTheirBookings(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	ada, err := dbw.CreatePerformer(&internal.Performer{Name: "Ada", Email: "ada@test.com"})
+	require.NoError(t, err, "CreatePerformer() failed: %v", err)
+	brian, err := dbw.CreatePerformer(&internal.Performer{Name: "Brian", Email: "brian@test.com"})
+	require.NoError(t, err, "CreatePerformer() failed: %v", err)
+	band, err := dbw.CreateGroup(&internal.Group{Name: "The Band", MemberIds: []int{ada.Id, brian.Id}})
+	require.NoError(t, err, "CreateGroup() failed: %v", err)
+
+	booked, err := dbw.CreatePerformance(&internal.Performance{ItemName: "Opening Set", GroupId: band.Id})
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+	require.NoError(t, dbw.DeletePerformerById(ada.Id))
+
+	// act
+	booked.ItemName = "Opening Set (Extended)"
+	require.NoError(t, dbw.UpdatePerformanceById(booked.Id, booked))
+	g, err := dbw.GetGroupById(band.Id)
+	require.NoError(t, err, "GetGroupById() failed: %v", err)
+	g.Name = "The Big Band"
+	require.NoError(t, dbw.UpdateGroupById(band.Id, g))
+	whileArchived, err := dbw.GetJunction(ada.Id, booked.Id)
+	require.NoError(t, err, "GetJunction() failed: %v", err)
+
+	later, err := dbw.CreatePerformance(&internal.Performance{ItemName: "Closing Set", GroupId: band.Id})
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+	require.NoError(t, dbw.RestorePerformerById(ada.Id))
+
+	// assert
+	assert.NotNil(t, whileArchived, "Archiving a member mustn't take them out of the group's performances")
+	assert.Equal(t, map[int]int{ada.Id: band.Id, brian.Id: band.Id}, bookedGroups(t, dbw, booked.Id))
+	assert.Equal(t, map[int]int{ada.Id: band.Id, brian.Id: band.Id}, bookedGroups(t, dbw, later.Id), "Restoring should book them into performances the group took on meanwhile")
+
+	restored, err := dbw.GetGroupById(band.Id)
+	require.NoError(t, err, "GetGroupById() failed: %v", err)
+	assert.Equal(t, []int{ada.Id, brian.Id}, restored.MemberIds)
+}
+
+func TestRenameGroupAuditsItsPerformances(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db).WithActor("user:7")
+
+	band, err := dbw.CreateGroup(&internal.Group{Name: "The Band"})
+	require.NoError(t, err, "CreateGroup() failed: %v", err)
+	p, err := dbw.CreatePerformance(&internal.Performance{ItemName: "Opening Set", GroupId: band.Id})
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+
+	// act
+	err = dbw.UpdateGroupById(band.Id, &internal.Group{Name: "The Big Band"})
+	require.NoError(t, err, "UpdateGroupById() failed: %v", err)
+
+	// assert
+	stored, err := dbw.GetPerformanceById(p.Id)
+	require.NoError(t, err, "GetPerformanceById() failed: %v", err)
+	assert.Equal(t, "The Big Band", stored.GroupName)
+	assert.Equal(t, p.Version+1, stored.Version, "Renamed performance should get a new version")
+
+	entries, _, err := dbw.ListAuditEntries(url.Values{"entity": {"performance"}, "id": {strconv.Itoa(p.Id)}})
+	require.NoError(t, err, "ListAuditEntries() failed: %v", err)
+	require.Len(t, entries, 2, "The rename should be recorded as an update")
+	var before, after internal.Performance
+	require.NoError(t, json.Unmarshal(entries[1].Before, &before))
+	require.NoError(t, json.Unmarshal(entries[1].After, &after))
+	assert.Equal(t, "update", entries[1].Action)
+	assert.Equal(t, "user:7", entries[1].Actor)
+	assert.Equal(t, "The Band", before.GroupName)
+	assert.Equal(t, "The Big Band", after.GroupName)
+	assert.Equal(t, stored.Version, after.Version)
+}
+
+func TestMigrateGroupsMergesExistingStrings(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+
+	err := internal.MigrateTo(db, 1)
+	require.NoError(t, err, "MigrateTo(1) failed: %v", err)
+
+	_, err = db.Exec(`
+		INSERT INTO performances (itemName, genreName, groupName, location, startTime, endTime) VALUES
+			('One', '', 'The Band', '', '2025-09-01 18:00:00+00:00', '2025-09-01 18:05:00+00:00'),
+			('Two', '', 'the band ', '', '2025-09-01 19:00:00+00:00', '2025-09-01 19:05:00+00:00'),
+			('Three', '', '', '', '2025-09-01 20:00:00+00:00', '2025-09-01 20:05:00+00:00')
+	`)
+	require.NoError(t, err)
+
+	// act
+	err = internal.Migrate(db)
+	require.NoError(t, err, "Migrate() failed: %v", err)
+
+	// assert
+	dbw := internal.CreateDBWrapper(db)
+	groups, err := dbw.GetAllGroups()
+	require.NoError(t, err, "GetAllGroups() failed: %v", err)
+	require.Len(t, groups, 1)
+	assert.Equal(t, "The Band", groups[0].Name)
+	assert.Empty(t, groups[0].MemberIds)
+
+	performances, err := dbw.GetPerformancesByGroupId(groups[0].Id)
+	require.NoError(t, err, "GetPerformancesByGroupId() failed: %v", err)
+	require.Len(t, performances, 2)
+	assert.Equal(t, "The Band", performances[1].GroupName)
+}
+
+func TestGroupEndpoints(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+	api := internal.NewAPI(dbw)
+
+	_, err := dbw.CreatePerformer(getTestPerformer())
+	require.NoError(t, err, "CreatePerformer() failed: %v", err)
+	_, err = dbw.CreatePerformance(&internal.Performance{ItemName: "Band Set", GroupName: "The Band"})
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+
+	cases := []struct {
+		method, path, body string
+		expected           int
+	}{
+		{"POST", "/groups/1/members", `{"performerId": 1}`, http.StatusOK},
+		{"POST", "/groups/1/members", `{"performerId": 99}`, http.StatusUnprocessableEntity},
+		{"GET", "/groups/1/members", "", http.StatusOK},
+		{"GET", "/groups/1/performances", "", http.StatusOK},
+		{"GET", "/groups/99", "", http.StatusNotFound},
+		{"GET", "/groups/1/anything", "", http.StatusNotFound},
+		{"POST", "/groups/1/anything", `{"name": "The Trio"}`, http.StatusNotFound},
+		{"PUT", "/groups/1/anything", `{"name": "The Trio"}`, http.StatusNotFound},
+		{"DELETE", "/groups/1/anything/1", "", http.StatusNotFound},
+		{"POST", "/groups", `{"name": "THE BAND"}`, http.StatusConflict},
+		{"POST", "/groups", `{"name": " "}`, http.StatusUnprocessableEntity},
+		{"POST", "/groups", `{"name": "The Duo", "memberIds": [1]}`, http.StatusCreated},
+		{"PUT", "/groups/2", `{"name": "The Band"}`, http.StatusConflict},
+		{"PUT", "/groups/99", `{"name": "The Trio"}`, http.StatusNotFound},
+		{"DELETE", "/groups/1/members/1", "", http.StatusOK},
+		{"DELETE", "/groups/1", "", http.StatusConflict},
+		{"DELETE", "/groups/2", "", http.StatusOK},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest(c.method, c.path, strings.NewReader(c.body))
+		w := httptest.NewRecorder()
+
+		// act
+		api.GroupHandler(w, r)
+
+		// assert
+		assert.Equal(t, c.expected, w.Code, "%s %s %s returned the wrong status", c.method, c.path, c.body)
+	}
+
+	performers, err := dbw.GetPerformersByPerformanceId(1)
+	require.NoError(t, err, "GetPerformersByPerformanceId() failed: %v", err)
+	assert.Empty(t, performers, "Leaving the group should take the performer out of its performances")
+}
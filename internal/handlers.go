@@ -1,7 +1,9 @@
 package internal
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -11,12 +13,19 @@ import (
 
 type API struct {
 	wrapper *DBWrapper
+	// sends performers their login codes. logging in is disabled while it's nil
+	mailer Mailer
 }
 
 func NewAPI(wrapper *DBWrapper) *API {
 	return &API{wrapper: wrapper}
 }
 
+// sets how emails are sent
+func (api *API) SetMailer(mailer Mailer) {
+	api.mailer = mailer
+}
+
 // Private helper function to respond with JSON
 func (api *API) respondJSON(writer http.ResponseWriter, status int, data interface{}) {
 	writer.Header().Set("Content-Type", "application/json")
@@ -42,6 +51,30 @@ func (api *API) extractId(path string) (int, error) {
 	return strconv.Atoi(parts[1])
 }
 
+// pulls the performer and performance ids out of a /junctions/:performerId/:performanceId path
+func (api *API) extractJunctionIds(path string) (int, int, error) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) < 3 {
+		return 0, 0, fmt.Errorf("invalid path")
+	}
+
+	performerId, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, err
+	}
+	performanceId, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return 0, 0, err
+	}
+	return performerId, performanceId, nil
+}
+
+// reports whether the named query parameter is set to true
+func queryFlag(r *http.Request, name string) bool {
+	value, err := strconv.ParseBool(r.URL.Query().Get(name))
+	return err == nil && value
+}
+
 func pathLength(path string) int {
 	parts := strings.Split(strings.Trim(path, "/"), "/")
 	return len(parts)
@@ -55,17 +88,41 @@ func (api *API) PerformanceHandler(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path == "/performances" || r.URL.Path == "/performances/" {
 			// log.Println("Detected request for all performances!")
 			api.GetAllPerformances(w, r)
+		} else if strings.HasSuffix(strings.TrimSuffix(r.URL.Path, "/"), "/rider") {
+			api.GetRider(w, r)
 		} else if pathLength(r.URL.Path) > 2 {
 			api.GetPerformersByPerformanceId(w, r)
 		} else {
 			api.GetPerformanceById(w, r)
 		}
 	case http.MethodPost:
-		api.CreateNewPerformance(w, r)
+		if strings.HasSuffix(strings.TrimSuffix(r.URL.Path, "/"), "/restore") {
+			api.RestorePerformance(w, r)
+		} else if strings.HasSuffix(strings.TrimSuffix(r.URL.Path, "/"), "/delay") {
+			api.DelayPerformance(w, r)
+		} else if strings.HasSuffix(strings.TrimSuffix(r.URL.Path, "/"), "/start") {
+			api.StartPerformance(w, r)
+		} else if strings.HasSuffix(strings.TrimSuffix(r.URL.Path, "/"), "/finish") {
+			api.FinishPerformance(w, r)
+		} else {
+			api.CreateNewPerformance(w, r)
+		}
 	case http.MethodPut:
-		api.UpdatePerformance(w, r)
+		if strings.HasSuffix(strings.TrimSuffix(r.URL.Path, "/"), "/rider") {
+			api.SaveRider(w, r)
+		} else {
+			api.UpdatePerformance(w, r)
+		}
+	case http.MethodPatch:
+		api.PatchPerformance(w, r)
 	case http.MethodDelete:
-		api.DeletePerformance(w, r)
+		if strings.HasSuffix(strings.TrimSuffix(r.URL.Path, "/"), "/rider") {
+			api.DeleteRider(w, r)
+		} else if isPurge(r) {
+			api.PurgePerformance(w, r)
+		} else {
+			api.DeletePerformance(w, r)
+		}
 	}
 }
 
@@ -76,17 +133,29 @@ func (api *API) PerformerHandler(w http.ResponseWriter, r *http.Request) {
 	case http.MethodGet:
 		if r.URL.Path == "/performers" || r.URL.Path == "/performers/" {
 			api.GetAllPerformers(w, r)
+		} else if strings.HasSuffix(r.URL.Path, ".ics") {
+			api.GetPerformerCalendar(w, r)
 		} else if pathLength(r.URL.Path) > 2 { // if pathLength >
 			api.GetPerformancesByPerformerId(w, r)
 		} else {
 			api.GetPerformerById(w, r)
 		}
 	case http.MethodPost:
-		api.CreateNewPerformer(w, r)
+		if strings.HasSuffix(strings.TrimSuffix(r.URL.Path, "/"), "/restore") {
+			api.RestorePerformer(w, r)
+		} else {
+			api.CreateNewPerformer(w, r)
+		}
 	case http.MethodPut:
 		api.UpdatePerformer(w, r)
+	case http.MethodPatch:
+		api.PatchPerformer(w, r)
 	case http.MethodDelete:
-		api.DeletePerformer(w, r)
+		if isPurge(r) {
+			api.PurgePerformer(w, r)
+		} else {
+			api.DeletePerformer(w, r)
+		}
 	}
 }
 
@@ -94,32 +163,46 @@ func (api *API) PerformerHandler(w http.ResponseWriter, r *http.Request) {
 func (api *API) JunctionHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodPost:
-		api.CreateJunction(w, r)
+		if strings.HasSuffix(strings.TrimSuffix(r.URL.Path, "/"), "/checkin") {
+			api.CheckInPerformer(w, r)
+		} else {
+			api.CreateJunction(w, r)
+		}
+	case http.MethodPut:
+		api.UpdateJunction(w, r)
 	case http.MethodDelete:
 		api.DeleteJunction(w, r)
 	}
 }
 
-// GET /performances - returns all performances
+// GET /performances - returns performances, optionally paginated, sorted and filtered
 func (api *API) GetAllPerformances(w http.ResponseWriter, r *http.Request) {
-	performances, err := api.wrapper.GetAllPerformances()
+	performances, pagination, err := api.wrapper.ListPerformances(r.URL.Query())
+	if isQueryError(err) {
+		api.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	if err != nil {
-		api.respondError(w, http.StatusBadRequest, "Invalid Performance ID")
+		api.respondError(w, http.StatusInternalServerError, "Unable to find performances")
 		return
 	}
 
-	api.respondJSON(w, http.StatusOK, map[string][]*Performance{"performances": performances})
+	api.respondJSON(w, http.StatusOK, map[string]interface{}{"performances": performances, "pagination": pagination})
 }
 
-// GET /performers - returns all performers
+// GET /performers - returns performers, optionally paginated, sorted and filtered
 func (api *API) GetAllPerformers(w http.ResponseWriter, r *http.Request) {
-	performers, err := api.wrapper.GetAllPerformers()
+	performers, pagination, err := api.wrapper.ListPerformers(r.URL.Query())
+	if isQueryError(err) {
+		api.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	if err != nil {
-		api.respondError(w, http.StatusBadRequest, "Invalid performer id")
+		api.respondError(w, http.StatusInternalServerError, "Unable to find performers")
 		return
 	}
 
-	api.respondJSON(w, http.StatusOK, map[string][]*Performer{"performers": performers})
+	api.respondJSON(w, http.StatusOK, map[string]interface{}{"performers": performers, "pagination": pagination})
 }
 
 // GET /performances/:id - return performance with given ID
@@ -137,7 +220,7 @@ func (api *API) GetPerformanceById(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	api.respondJSON(w, http.StatusOK, performance)
+	api.respondWithETag(w, r, performance.Version, performance)
 }
 
 // GET /performers/:id - return performer with given ID
@@ -155,7 +238,7 @@ func (api *API) GetPerformerById(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	api.respondJSON(w, http.StatusOK, performer)
+	api.respondWithETag(w, r, performer.Version, performer)
 }
 
 // GET /performances/:id/performers - returns performers associated to the performance with the specified id
@@ -166,13 +249,13 @@ func (api *API) GetPerformersByPerformanceId(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	performers, err := api.wrapper.GetPerformersByPerformanceId(id)
+	performers, err := api.wrapper.GetBookedPerformersByPerformanceId(id)
 	if err != nil {
 		api.respondError(w, http.StatusInternalServerError, "Unable to find performers")
 		return
 	}
 
-	api.respondJSON(w, http.StatusOK, map[string][]*Performer{"performers": performers})
+	api.respondJSON(w, http.StatusOK, map[string][]*BookedPerformer{"performers": performers})
 }
 
 // GET /performances/:id/performers - returns performers associated to the performance with the specified id
@@ -202,15 +285,30 @@ func (api *API) CreateNewPerformance(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// TODO: some more validation
-	if performance.ItemName == "" {
-		api.respondError(w, http.StatusBadRequest, "Cannot be blank")
+	var newPerformance *Performance
+	if isForced(r) {
+		newPerformance, err = api.wrapperFor(r).ForceCreatePerformance(&performance)
+	} else {
+		newPerformance, err = api.wrapperFor(r).CreatePerformance(&performance)
+	}
+	if api.respondIfInvalid(w, err) || api.respondIfConflict(w, err) || api.respondIfLocationClash(w, err) {
+		return
+	}
+	if errors.Is(err, ErrUnknownLocation) {
+		api.respondError(w, http.StatusBadRequest, "Unknown location")
+		return
+	}
+	if errors.Is(err, ErrUnknownGenre) {
+		api.respondError(w, http.StatusBadRequest, "Unknown genre")
+		return
+	}
+	if errors.Is(err, ErrUnknownGroup) {
+		api.respondError(w, http.StatusBadRequest, "Unknown group")
 		return
 	}
-
-	newPerformance, err := api.wrapper.CreatePerformance(&performance)
 	if err != nil {
 		api.respondError(w, http.StatusInternalServerError, "Failed to create performance")
+		return
 	}
 
 	api.respondJSON(w, http.StatusCreated, newPerformance)
@@ -226,15 +324,13 @@ func (api *API) CreateNewPerformer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// TODO: some more validation
-	if performer.Name == "" {
-		api.respondError(w, http.StatusBadRequest, "Cannot Be Blank")
+	newPerformer, err := api.wrapperFor(r).CreatePerformer(&performer)
+	if api.respondIfInvalid(w, err) {
 		return
 	}
-
-	newPerformer, err := api.wrapper.CreatePerformer(&performer)
 	if err != nil {
 		api.respondError(w, http.StatusInternalServerError, "Failed to create performer")
+		return
 	}
 
 	api.respondJSON(w, http.StatusCreated, newPerformer)
@@ -243,8 +339,9 @@ func (api *API) CreateNewPerformer(w http.ResponseWriter, r *http.Request) {
 // POST /junctions/ - creates a new performer:performance junction
 func (api *API) CreateJunction(w http.ResponseWriter, r *http.Request) {
 	junction := struct {
-		PerformerId   int `json:"performerId`
+		PerformerId   int `json:"performerId"`
 		PerformanceId int `json:"performanceId"`
+		JunctionDetails
 	}{}
 
 	err := json.NewDecoder(r.Body).Decode(&junction)
@@ -253,7 +350,10 @@ func (api *API) CreateJunction(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = api.wrapper.CreateJunction(junction.PerformerId, junction.PerformanceId)
+	_, err = api.wrapperFor(r).CreateJunctionWithDetails(junction.PerformerId, junction.PerformanceId, &junction.JunctionDetails)
+	if api.respondIfInvalid(w, err) || api.respondIfConflict(w, err) {
+		return
+	}
 	if err != nil {
 		api.respondError(w, http.StatusInternalServerError, "Failed to create junction")
 		return
@@ -275,23 +375,59 @@ func (api *API) UpdatePerformance(w http.ResponseWriter, r *http.Request) {
 	id, err := api.extractId(r.URL.Path)
 	if err != nil {
 		api.respondError(w, http.StatusBadRequest, "Invalid ID provided")
+		return
 	}
 
-	// TODO: more validation
-	if performance.ItemName == "" {
-		api.respondError(w, http.StatusBadRequest, "Cannot be blank")
+	version, ok := api.requireIfMatch(w, r)
+	if !ok {
 		return
 	}
+	performance.Version = version
 
-	err = api.wrapper.UpdatePerformanceById(id, &performance)
-	if err != nil {
-		api.respondError(w, http.StatusInternalServerError, "Error updating performance")
+	if !api.savePerformance(w, r, id, &performance) {
 		return
 	}
 
 	api.respondJSON(w, http.StatusOK, map[string]string{"status": "success"})
 }
 
+// writes the updated performance to the db and sets its new ETag. responds with an error and
+// returns false if it couldn't be saved
+func (api *API) savePerformance(w http.ResponseWriter, r *http.Request, id int, performance *Performance) bool {
+	var err error
+	if isForced(r) {
+		err = api.wrapperFor(r).ForceUpdatePerformanceById(id, performance)
+	} else {
+		err = api.wrapperFor(r).UpdatePerformanceById(id, performance)
+	}
+	if api.respondIfInvalid(w, err) || api.respondIfConflict(w, err) || api.respondIfLocationClash(w, err) || api.respondIfVersionMismatch(w, err) {
+		return false
+	}
+	if errors.Is(err, ErrUnknownLocation) {
+		api.respondError(w, http.StatusBadRequest, "Unknown location")
+		return false
+	}
+	if errors.Is(err, ErrUnknownGenre) {
+		api.respondError(w, http.StatusBadRequest, "Unknown genre")
+		return false
+	}
+	if errors.Is(err, ErrUnknownGroup) {
+		api.respondError(w, http.StatusBadRequest, "Unknown group")
+		return false
+	}
+	if err == sql.ErrNoRows {
+		api.respondError(w, http.StatusNotFound, "Performance Not Found")
+		return false
+	}
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Error updating performance")
+		return false
+	}
+
+	w.Header().Set("ETag", formatETag(performance.Version))
+	return true
+}
+
 // PUT /performers/:id - updates the performer with the specified id
 func (api *API) UpdatePerformer(w http.ResponseWriter, r *http.Request) {
 	var performer Performer
@@ -305,24 +441,44 @@ func (api *API) UpdatePerformer(w http.ResponseWriter, r *http.Request) {
 	id, err := api.extractId(r.URL.Path)
 	if err != nil {
 		api.respondError(w, http.StatusBadRequest, "Invalid ID provided")
+		return
 	}
 
-	// TODO: more validation
-	if performer.Name == "" {
-		api.respondError(w, http.StatusBadRequest, "Cannot be blank")
+	version, ok := api.requireIfMatch(w, r)
+	if !ok {
 		return
 	}
+	performer.Version = version
 
-	err = api.wrapper.UpdatePerformerById(id, &performer)
-	if err != nil {
-		api.respondError(w, http.StatusInternalServerError, "Error updating performer")
+	if !api.savePerformer(w, r, id, &performer) {
 		return
 	}
 
 	api.respondJSON(w, http.StatusOK, map[string]string{"status": "success"})
 }
 
-// DELETE /performances/:id - deletes the performance with the specified id
+// writes the updated performer to the db and sets their new ETag. responds with an error and
+// returns false if they couldn't be saved
+func (api *API) savePerformer(w http.ResponseWriter, r *http.Request, id int, performer *Performer) bool {
+	err := api.wrapperFor(r).UpdatePerformerById(id, performer)
+	if api.respondIfInvalid(w, err) || api.respondIfVersionMismatch(w, err) {
+		return false
+	}
+	if err == sql.ErrNoRows {
+		api.respondError(w, http.StatusNotFound, "Performer Not Found")
+		return false
+	}
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Error updating performer")
+		return false
+	}
+
+	w.Header().Set("ETag", formatETag(performer.Version))
+	return true
+}
+
+// DELETE /performances/:id - deletes the performance with the specified id. it can be brought
+// back with POST /performances/:id/restore
 func (api *API) DeletePerformance(w http.ResponseWriter, r *http.Request) {
 	id, err := api.extractId(r.URL.Path)
 	if err != nil {
@@ -330,15 +486,29 @@ func (api *API) DeletePerformance(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = api.wrapper.DeletePerformanceById(id)
+	version, ok := api.requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+
+	err = api.wrapperFor(r).DeletePerformanceByIdIfVersion(id, version)
+	if api.respondIfVersionMismatch(w, err) {
+		return
+	}
+	if err == sql.ErrNoRows {
+		api.respondError(w, http.StatusNotFound, "Performance Not Found")
+		return
+	}
 	if err != nil {
 		api.respondError(w, http.StatusInternalServerError, "Error deleting performance")
+		return
 	}
 
 	api.respondJSON(w, http.StatusOK, map[string]string{"status": "success"})
 }
 
-// DELETE /performers/:id - deletes the performer with the specified id
+// DELETE /performers/:id - deletes the performer with the specified id. they can be brought
+// back with POST /performers/:id/restore
 func (api *API) DeletePerformer(w http.ResponseWriter, r *http.Request) {
 	id, err := api.extractId(r.URL.Path)
 	if err != nil {
@@ -346,7 +516,19 @@ func (api *API) DeletePerformer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = api.wrapper.DeletePerformerById(id)
+	version, ok := api.requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+
+	err = api.wrapperFor(r).DeletePerformerByIdIfVersion(id, version)
+	if api.respondIfVersionMismatch(w, err) {
+		return
+	}
+	if err == sql.ErrNoRows {
+		api.respondError(w, http.StatusNotFound, "Performer Not Found")
+		return
+	}
 	if err != nil {
 		api.respondError(w, http.StatusInternalServerError, "Error deleting performer")
 		return
@@ -355,21 +537,47 @@ func (api *API) DeletePerformer(w http.ResponseWriter, r *http.Request) {
 	api.respondJSON(w, http.StatusOK, map[string]string{"status": "success"})
 }
 
-// DELETE /junctions/:performerId/:performanceId
-func (api *API) DeleteJunction(w http.ResponseWriter, r *http.Request) {
-	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-	performerId, err := strconv.Atoi(parts[1])
+// PUT /junctions/:performerId/:performanceId - changes the performer's role, instrument and notes
+func (api *API) UpdateJunction(w http.ResponseWriter, r *http.Request) {
+	var details JunctionDetails
+
+	err := json.NewDecoder(r.Body).Decode(&details)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	performerId, performanceId, err := api.extractJunctionIds(r.URL.Path)
 	if err != nil {
 		api.respondError(w, http.StatusBadRequest, "Invalid ID provided")
 		return
 	}
-	performanceId, err := strconv.Atoi(parts[2])
+
+	junction, err := api.wrapperFor(r).UpdateJunction(performerId, performanceId, &details)
+	if api.respondIfInvalid(w, err) {
+		return
+	}
+	if err == sql.ErrNoRows {
+		api.respondError(w, http.StatusNotFound, "Junction Not Found")
+		return
+	}
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Error updating junction")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, junction)
+}
+
+// DELETE /junctions/:performerId/:performanceId
+func (api *API) DeleteJunction(w http.ResponseWriter, r *http.Request) {
+	performerId, performanceId, err := api.extractJunctionIds(r.URL.Path)
 	if err != nil {
 		api.respondError(w, http.StatusBadRequest, "Invalid ID provided")
 		return
 	}
 
-	err = api.wrapper.DeleteJunction(performerId, performanceId)
+	err = api.wrapperFor(r).DeleteJunction(performerId, performanceId)
 	if err != nil {
 		api.respondError(w, http.StatusInternalServerError, "Error deleting junction")
 		return
@@ -45,3 +45,43 @@ func TestCreatePerformanceEndpoint(t *testing.T) {
 	assert.True(t, testPerformance.StartTime.Equal(createdPerformance.StartTime), "Start times not equal!")
 	assert.True(t, testPerformance.EndTime.Equal(createdPerformance.EndTime), "End times not equal!")
 }
+
+func TestJunctionDetailsEndpoints(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+	api := internal.NewAPI(dbw)
+
+	_, err := dbw.CreatePerformer(getTestPerformer())
+	require.NoError(t, err, "CreatePerformer() failed: %v", err)
+	_, err = dbw.CreatePerformance(getTestPerformance())
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+
+	create := httptest.NewRequest("POST", "/junctions", bytes.NewBufferString(`{"performerId": 1, "performanceId": 1, "role": "vocals"}`))
+	update := httptest.NewRequest("PUT", "/junctions/1/1", bytes.NewBufferString(`{"role": "leader", "instrument": "Drums"}`))
+	missing := httptest.NewRequest("PUT", "/junctions/1/99", bytes.NewBufferString(`{"role": "leader"}`))
+	list := httptest.NewRequest("GET", "/performances/1/performers", nil)
+	createW, updateW, missingW, listW := httptest.NewRecorder(), httptest.NewRecorder(), httptest.NewRecorder(), httptest.NewRecorder()
+
+	// act
+	api.JunctionHandler(createW, create)
+	api.JunctionHandler(updateW, update)
+	api.JunctionHandler(missingW, missing)
+	api.PerformanceHandler(listW, list)
+
+	// assert
+	assert.Equal(t, http.StatusCreated, createW.Code)
+	assert.Equal(t, http.StatusOK, updateW.Code)
+	assert.Equal(t, http.StatusNotFound, missingW.Code)
+	require.Equal(t, http.StatusOK, listW.Code)
+
+	var response struct {
+		Performers []*internal.BookedPerformer `json:"performers"`
+	}
+	require.NoError(t, json.NewDecoder(listW.Body).Decode(&response))
+	require.Len(t, response.Performers, 1)
+	assert.Equal(t, "leader", response.Performers[0].Role)
+	assert.Equal(t, "Drums", response.Performers[0].Instrument)
+	assert.Equal(t, "", response.Performers[0].Notes, "PUT should replace every detail")
+}
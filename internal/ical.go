@@ -0,0 +1,196 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	calendarProductId = "-//FOC API//Festival Schedule//EN"
+	// RFC 5545 UTC date-time form
+	calendarTimeFormat = "20060102T150405Z"
+	// lines longer than this many octets have to be folded
+	calendarLineLimit = 75
+)
+
+// a performance along with the performers appearing in it
+type calendarEvent struct {
+	performance *Performance
+	performers  []*Performer
+}
+
+// renders events as an RFC 5545 calendar
+func renderCalendar(name string, events []*calendarEvent, now time.Time) string {
+	var b strings.Builder
+
+	writeCalendarLine(&b, "BEGIN:VCALENDAR")
+	writeCalendarLine(&b, "VERSION:2.0")
+	writeCalendarLine(&b, "PRODID:"+calendarProductId)
+	writeCalendarLine(&b, "CALSCALE:GREGORIAN")
+	writeCalendarLine(&b, "METHOD:PUBLISH")
+	writeCalendarLine(&b, "X-WR-CALNAME:"+escapeCalendarText(name))
+
+	for _, event := range events {
+		p := event.performance
+
+		writeCalendarLine(&b, "BEGIN:VEVENT")
+		// the uid only depends on the performance id, so calendar apps replace the old copy when times change
+		writeCalendarLine(&b, fmt.Sprintf("UID:performance-%d@foc-api", p.Id))
+		writeCalendarLine(&b, "DTSTAMP:"+now.UTC().Format(calendarTimeFormat))
+		// calendar apps only take an update over their copy if the sequence has gone up
+		writeCalendarLine(&b, fmt.Sprintf("SEQUENCE:%d", max(p.Version-1, 0)))
+		writeCalendarLine(&b, "DTSTART:"+p.StartTime.UTC().Format(calendarTimeFormat))
+		writeCalendarLine(&b, "DTEND:"+p.EndTime.UTC().Format(calendarTimeFormat))
+		writeCalendarLine(&b, "SUMMARY:"+escapeCalendarText(calendarSummary(p)))
+		if p.Location != "" {
+			writeCalendarLine(&b, "LOCATION:"+escapeCalendarText(p.Location))
+		}
+		if p.GenreName != "" {
+			writeCalendarLine(&b, "CATEGORIES:"+escapeCalendarText(p.GenreName))
+		}
+		for _, performer := range event.performers {
+			writeCalendarLine(&b, fmt.Sprintf("ATTENDEE;CN=%s;ROLE=REQ-PARTICIPANT:mailto:%s", quoteCalendarParam(performer.Name), performer.Email))
+		}
+		writeCalendarLine(&b, "END:VEVENT")
+	}
+
+	writeCalendarLine(&b, "END:VCALENDAR")
+	return b.String()
+}
+
+// "Item Name - Group Name", or just the item name when there's no group
+func calendarSummary(p *Performance) string {
+	if p.GroupName == "" {
+		return p.ItemName
+	}
+	return p.ItemName + " - " + p.GroupName
+}
+
+// writes a content line, folding it onto continuation lines so no line exceeds calendarLineLimit octets
+func writeCalendarLine(b *strings.Builder, line string) {
+	limit := calendarLineLimit
+	for len(line) > limit {
+		// never split a multi-byte character across two lines
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		// continuation lines start with a space, which counts towards the limit
+		limit = calendarLineLimit - 1
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+}
+
+// escapes the characters that have meaning inside a TEXT value
+func escapeCalendarText(text string) string {
+	replacer := strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	)
+	return stripControlCharacters(replacer.Replace(text))
+}
+
+// quotes a parameter value if it contains characters that would otherwise end it. parameter
+// values can't hold quotes or control characters at all, so they're dropped
+func quoteCalendarParam(value string) string {
+	value = stripControlCharacters(strings.ReplaceAll(value, `"`, ""))
+	if strings.ContainsAny(value, ":;,") {
+		return `"` + value + `"`
+	}
+	return value
+}
+
+// drops control characters, which could otherwise end a content line early and start another.
+// tabs are allowed in content lines, so they're kept
+func stripControlCharacters(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r != '\t' && unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, value)
+}
+
+// pairs every scheduled performance with its performers
+func (dbw *DBWrapper) getCalendarEvents(performances []*Performance) ([]*calendarEvent, error) {
+	events := []*calendarEvent{}
+	for _, p := range performances {
+		// there's nothing to put in a calendar until a performance has times
+		if !isScheduled(p) {
+			continue
+		}
+
+		performers, err := dbw.GetPerformersByPerformanceId(p.Id)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, &calendarEvent{performance: p, performers: performers})
+	}
+	return events, nil
+}
+
+// Private helper function to respond with a calendar
+func (api *API) respondCalendar(w http.ResponseWriter, name string, performances []*Performance) {
+	events, err := api.wrapper.getCalendarEvents(performances)
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Unable to build calendar")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, renderCalendar(name, events, time.Now()))
+}
+
+// Handles requests for the festival calendar
+func (api *API) CalendarHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		api.GetPerformancesCalendar(w, r)
+	}
+}
+
+// GET /performances.ics - returns the whole festival schedule as a calendar
+func (api *API) GetPerformancesCalendar(w http.ResponseWriter, r *http.Request) {
+	performances, err := api.wrapper.GetAllPerformances()
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Unable to find performances")
+		return
+	}
+
+	api.respondCalendar(w, "Festival of Creativity", performances)
+}
+
+// GET /performers/:id/performances.ics - returns the performances of the performer with the specified id as a calendar
+func (api *API) GetPerformerCalendar(w http.ResponseWriter, r *http.Request) {
+	id, err := api.extractId(r.URL.Path)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Error extracting id")
+		return
+	}
+
+	performer, err := api.wrapper.GetPerformerById(id)
+	if err != nil || performer == nil {
+		api.respondError(w, http.StatusNotFound, "Performer Not Found")
+		return
+	}
+
+	performances, err := api.wrapper.GetPerformancesByPerformerId(id)
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Unable to find performances")
+		return
+	}
+
+	api.respondCalendar(w, "Festival of Creativity - "+performer.Name, performances)
+}
@@ -0,0 +1,144 @@
+package internal_test
+
+import (
+	"fmt"
+	internal "foc_api/internal"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPerformancesCalendarEndpoint(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+	api := internal.NewAPI(dbw)
+
+	performer, err := dbw.CreatePerformer(getTestPerformer())
+	require.NoError(t, err, "CreatePerformer() failed: %v", err)
+
+	start := time.Date(2025, 9, 1, 18, 0, 0, 0, time.UTC)
+	performance := createTestPerformance(t, dbw, "Bohemian Rhapsody", "Bohemian Rhapsody Stage", start, 6*time.Minute)
+	err = dbw.CreateJunction(performer.Id, performance.Id)
+	require.NoError(t, err, "CreateJunction() failed: %v", err)
+
+	// unscheduled performances have nothing to put in a calendar
+	_, err = dbw.CreatePerformance(getTestPerformances(1)[0])
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+
+	r := httptest.NewRequest("GET", "/performances.ics", nil)
+	w := httptest.NewRecorder()
+
+	// act
+	api.CalendarHandler(w, r)
+
+	// assert
+	require.Equal(t, http.StatusOK, w.Code, "CalendarHandler() returned status %v", w.Code)
+	assert.Equal(t, "text/calendar; charset=utf-8", w.Header().Get("Content-Type"))
+
+	body := w.Body.String()
+	assert.Equal(t, 1, strings.Count(body, "BEGIN:VEVENT"), "Expected exactly one event")
+	assert.Contains(t, body, fmt.Sprintf("UID:performance-%d@foc-api\r\n", performance.Id))
+	assert.Contains(t, body, "DTSTART:20250901T180000Z\r\n")
+	assert.Contains(t, body, "DTEND:20250901T180600Z\r\n")
+	assert.Contains(t, body, "LOCATION:Bohemian Rhapsody Stage\r\n")
+	assert.Contains(t, body, "mailto:"+performer.Email)
+}
+
+func TestPerformerCalendarEndpoint(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+	api := internal.NewAPI(dbw)
+
+	performers := getTestPerformers(2)
+	for i, p := range performers {
+		created, err := dbw.CreatePerformer(p)
+		require.NoError(t, err, "CreatePerformer() failed: %v", err)
+		performers[i] = created
+	}
+
+	start := time.Date(2025, 9, 1, 18, 0, 0, 0, time.UTC)
+	mine := createTestPerformance(t, dbw, "Mine", "Mine Stage", start, 5*time.Minute)
+	theirs := createTestPerformance(t, dbw, "Theirs", "Theirs Stage", start, 5*time.Minute)
+
+	err := dbw.CreateJunction(performers[0].Id, mine.Id)
+	require.NoError(t, err, "CreateJunction() failed: %v", err)
+	err = dbw.CreateJunction(performers[1].Id, theirs.Id)
+	require.NoError(t, err, "CreateJunction() failed: %v", err)
+
+	r := httptest.NewRequest("GET", fmt.Sprintf("/performers/%d/performances.ics", performers[0].Id), nil)
+	w := httptest.NewRecorder()
+
+	// act
+	api.PerformerHandler(w, r)
+
+	// assert
+	require.Equal(t, http.StatusOK, w.Code, "PerformerHandler() returned status %v", w.Code)
+
+	body := w.Body.String()
+	assert.Contains(t, body, fmt.Sprintf("UID:performance-%d@foc-api", mine.Id))
+	assert.NotContains(t, body, fmt.Sprintf("UID:performance-%d@foc-api", theirs.Id))
+}
+
+func TestCalendarFoldsLongLines(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+	api := internal.NewAPI(dbw)
+
+	start := time.Date(2025, 9, 1, 18, 0, 0, 0, time.UTC)
+	createTestPerformance(t, dbw, strings.Repeat("Très long titre, ", 10), "Main Stage", start, 5*time.Minute)
+
+	r := httptest.NewRequest("GET", "/performances.ics", nil)
+	w := httptest.NewRecorder()
+
+	// act
+	api.CalendarHandler(w, r)
+
+	// assert
+	for _, line := range strings.Split(w.Body.String(), "\r\n") {
+		assert.LessOrEqual(t, len(line), 75, "Line longer than 75 octets: %q", line)
+	}
+	assert.Contains(t, w.Body.String(), `Très long titre\, `)
+}
+
+func TestCalendarDropsControlCharactersFromNames(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+	api := internal.NewAPI(dbw)
+
+	performer, err := dbw.CreatePerformer(getTestPerformer())
+	require.NoError(t, err, "CreatePerformer() failed: %v", err)
+	start := time.Date(2025, 9, 1, 18, 0, 0, 0, time.UTC)
+	performance := createTestPerformance(t, dbw, "Act\rOne", "Act\rOne Stage", start, 6*time.Minute)
+	require.NoError(t, dbw.CreateJunction(performer.Id, performance.Id))
+
+	// names saved before they were validated can still hold line breaks
+	_, err = db.Exec(`UPDATE performers SET name = ? WHERE id = ?`, "X\r\nBEGIN:VEVENT\r\nSUMMARY:Injected", performer.Id)
+	require.NoError(t, err)
+
+	r := httptest.NewRequest("GET", "/performances.ics", nil)
+	w := httptest.NewRecorder()
+
+	// act
+	api.CalendarHandler(w, r)
+
+	// assert
+	require.Equal(t, http.StatusOK, w.Code, "CalendarHandler() returned status %v", w.Code)
+	body := w.Body.String()
+	assert.Equal(t, 1, strings.Count(body, "\r\nBEGIN:VEVENT\r\n"), "A name shouldn't be able to start another event")
+	assert.NotContains(t, body, "\r\nSUMMARY:Injected")
+	assert.Contains(t, body, `CN="XBEGIN:VEVENTSUMMARY:Injected"`)
+	assert.Contains(t, body, "SUMMARY:ActOne")
+}
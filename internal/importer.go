@@ -0,0 +1,447 @@
+package internal
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the CSV files making up an import. any of them may be nil
+type ImportFiles struct {
+	Performers   io.Reader
+	Performances io.Reader
+	Junctions    io.Reader
+}
+
+// a problem with a single row of an import
+type ImportRowError struct {
+	Entity string `json:"entity"`
+	// the spreadsheet row number, so the header is row 1 and the first record is row 2
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+// what an import did, or would have done in a dry run
+type ImportReport struct {
+	DryRun    bool              `json:"dryRun"`
+	Committed bool              `json:"committed"`
+	Created   map[string]int    `json:"created"`
+	Updated   map[string]int    `json:"updated"`
+	Errors    []*ImportRowError `json:"errors"`
+}
+
+// the formats accepted for startTime and endTime columns
+var importTimeFormats = []string{
+	time.RFC3339,
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+}
+
+// keeps track of the rows created so far so later files can refer to them
+type importState struct {
+	report *ImportReport
+	// performances created by this import, by item name
+	performances map[string]*Performance
+}
+
+// imports performers, then performances, then junctions, all in one transaction. nothing is
+// committed if any row fails or dryRun is set. the returned error is only for failures that
+// aren't the fault of a particular row
+func (dbw *DBWrapper) Import(files ImportFiles, dryRun bool) (*ImportReport, error) {
+	report := &ImportReport{
+		DryRun:  dryRun,
+		Created: map[string]int{"performers": 0, "performances": 0, "junctions": 0},
+		Updated: map[string]int{"performers": 0},
+		Errors:  []*ImportRowError{},
+	}
+	state := &importState{report: report, performances: map[string]*Performance{}}
+
+	// returned from the transaction to roll it back when some rows were invalid
+	errRowsFailed := errors.New("import rows failed")
+
+	commit := !dryRun
+	err := dbw.inTransaction(func(tx *DBWrapper) error {
+		steps := []struct {
+			entity string
+			file   io.Reader
+			row    func(*DBWrapper, *importState, map[string]string) error
+		}{
+			{"performers", files.Performers, importPerformerRow},
+			{"performances", files.Performances, importPerformanceRow},
+			{"junctions", files.Junctions, importJunctionRow},
+		}
+
+		for _, step := range steps {
+			if step.file == nil {
+				continue
+			}
+			err := tx.importCSV(state, step.entity, step.file, step.row)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(report.Errors) > 0 {
+			return errRowsFailed
+		}
+		return nil
+	}, commit)
+
+	if err != nil && err != errRowsFailed {
+		return nil, err
+	}
+
+	report.Committed = err == nil && commit
+	return report, nil
+}
+
+// reads a CSV with a header row and hands each record to importRow as a column:value map
+func (dbw *DBWrapper) importCSV(state *importState, entity string, file io.Reader, importRow func(*DBWrapper, *importState, map[string]string) error) error {
+	reader := csv.NewReader(file)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		state.addError(entity, 1, err)
+		return nil
+	}
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(header[i]))
+	}
+
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			state.addError(entity, row, err)
+			// a malformed csv can't be trusted past the broken row
+			return nil
+		}
+
+		values := map[string]string{}
+		for i, column := range header {
+			if i < len(record) {
+				values[column] = strings.TrimSpace(record[i])
+			}
+		}
+
+		err = importRow(dbw, state, values)
+		if err != nil {
+			var dbErr *importDBError
+			if errors.As(err, &dbErr) {
+				return dbErr.err
+			}
+			state.addError(entity, row, err)
+		}
+	}
+}
+
+func (state *importState) addError(entity string, row int, err error) {
+	state.report.Errors = append(state.report.Errors, &ImportRowError{Entity: entity, Row: row, Error: err.Error()})
+}
+
+// wraps errors that mean the database itself failed, rather than the row being bad
+type importDBError struct {
+	err error
+}
+
+func (e *importDBError) Error() string {
+	return e.err.Error()
+}
+
+// columns: name, email. performers are matched on email so re-importing a sheet updates rather than duplicates
+func importPerformerRow(dbw *DBWrapper, state *importState, values map[string]string) error {
+	performer := &Performer{Name: values["name"], Email: values["email"]}
+	err := validatePerformer(performer)
+	if err != nil {
+		return err
+	}
+
+	existing, err := dbw.GetPerformerByEmail(performer.Email)
+	if err != nil {
+		return &importDBError{err}
+	}
+
+	if existing != nil {
+		if existing.Name == performer.Name {
+			return nil
+		}
+		err = dbw.UpdatePerformerById(existing.Id, performer)
+		if err != nil {
+			return err
+		}
+		state.report.Updated["performers"]++
+		return nil
+	}
+
+	_, err = dbw.CreatePerformer(performer)
+	if err != nil {
+		return err
+	}
+	state.report.Created["performers"]++
+	return nil
+}
+
+// columns: itemName, genreName, groupName, location, startTime, endTime. performances go into the
+// current edition
+func importPerformanceRow(dbw *DBWrapper, state *importState, values map[string]string) error {
+	performance := &Performance{
+		ItemName:  values["itemname"],
+		GenreName: values["genrename"],
+		GroupName: values["groupname"],
+		Location:  values["location"],
+	}
+	if _, ok := state.performances[strings.ToLower(performance.ItemName)]; ok {
+		return fmt.Errorf("itemName %q appears more than once", performance.ItemName)
+	}
+
+	var err error
+	performance.StartTime, err = parseImportTime("startTime", values["starttime"])
+	if err != nil {
+		return err
+	}
+	performance.EndTime, err = parseImportTime("endTime", values["endtime"])
+	if err != nil {
+		return err
+	}
+	normalisePerformanceTimes(performance)
+	err = dbw.validatePerformance(performance)
+	if err != nil {
+		return err
+	}
+
+	performance, err = dbw.CreatePerformance(performance)
+	if err != nil {
+		return err
+	}
+	state.performances[strings.ToLower(performance.ItemName)] = performance
+	state.report.Created["performances"]++
+	return nil
+}
+
+// columns: email or performerId, and itemName or performanceId
+func importJunctionRow(dbw *DBWrapper, state *importState, values map[string]string) error {
+	performerId, err := dbw.importPerformerId(values)
+	if err != nil {
+		return err
+	}
+	performanceId, err := dbw.importPerformanceId(state, values)
+	if err != nil {
+		return err
+	}
+
+	err = dbw.CreateJunction(performerId, performanceId)
+	if err != nil {
+		return err
+	}
+	state.report.Created["junctions"]++
+	return nil
+}
+
+func (dbw *DBWrapper) importPerformerId(values map[string]string) (int, error) {
+	if values["performerid"] != "" {
+		id, err := strconv.Atoi(values["performerid"])
+		if err != nil {
+			return 0, errors.New("performerId is not a number")
+		}
+		performer, err := dbw.GetPerformerById(id)
+		if err != nil {
+			return 0, &importDBError{err}
+		}
+		if performer == nil {
+			return 0, fmt.Errorf("no performer with id %d", id)
+		}
+		return id, nil
+	}
+
+	performer, err := dbw.GetPerformerByEmail(values["email"])
+	if err != nil {
+		return 0, &importDBError{err}
+	}
+	if performer == nil {
+		return 0, fmt.Errorf("no performer with email %q", values["email"])
+	}
+	return performer.Id, nil
+}
+
+func (dbw *DBWrapper) importPerformanceId(state *importState, values map[string]string) (int, error) {
+	if values["performanceid"] != "" {
+		id, err := strconv.Atoi(values["performanceid"])
+		if err != nil {
+			return 0, errors.New("performanceId is not a number")
+		}
+		performance, err := dbw.GetPerformanceById(id)
+		if err != nil {
+			return 0, &importDBError{err}
+		}
+		if performance == nil {
+			return 0, fmt.Errorf("no performance with id %d", id)
+		}
+		return id, nil
+	}
+
+	// performances from the same import take priority over ones already in the db
+	itemName := values["itemname"]
+	if performance, ok := state.performances[strings.ToLower(itemName)]; ok {
+		return performance.Id, nil
+	}
+
+	performances, err := dbw.GetPerformancesByItemName(itemName)
+	if err != nil {
+		return 0, &importDBError{err}
+	}
+	// acts often repeat an item from an earlier edition, so only the current edition's count
+	current, err := dbw.currentEditionId()
+	if err != nil {
+		return 0, &importDBError{err}
+	}
+	if current != 0 {
+		inEdition := []*Performance{}
+		for _, p := range performances {
+			if p.EditionId == current {
+				inEdition = append(inEdition, p)
+			}
+		}
+		performances = inEdition
+	}
+	switch len(performances) {
+	case 0:
+		return 0, fmt.Errorf("no performance with itemName %q", itemName)
+	case 1:
+		return performances[0].Id, nil
+	default:
+		return 0, fmt.Errorf("itemName %q matches %d performances, use performanceId instead", itemName, len(performances))
+	}
+}
+
+// blank times are allowed, they just leave the performance unscheduled
+func parseImportTime(column, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	for _, format := range importTimeFormats {
+		t, err := time.Parse(format, value)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%s %q is not a valid time, use a format like 2025-09-01T18:00:00Z", column, value)
+}
+
+// Return the performer with the given email, ignoring case
+func (dbw *DBWrapper) GetPerformerByEmail(email string) (*Performer, error) {
+	dbQuery := `
+		SELECT ` + performerColumns + `
+		FROM performers AS p
+		WHERE p.email = ? COLLATE NOCASE AND p.deleted = 0
+		ORDER BY p.id ASC
+		LIMIT 1
+	`
+
+	p, err := scanPerformer(dbw.db.QueryRow(dbQuery, strings.TrimSpace(email)))
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Returns the performances with the given item name, ignoring case
+func (dbw *DBWrapper) GetPerformancesByItemName(itemName string) ([]*Performance, error) {
+	dbQuery := `
+		SELECT ` + performanceColumns + `
+		FROM performances AS p
+		WHERE p.itemName = ? COLLATE NOCASE AND p.deleted = 0
+		ORDER BY p.id ASC
+	`
+
+	rows, err := dbw.db.Query(dbQuery, strings.TrimSpace(itemName))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	performances := []*Performance{}
+	for rows.Next() {
+		p, err := scanPerformance(rows)
+		if err != nil {
+			return nil, err
+		}
+		performances = append(performances, p)
+	}
+
+	return performances, nil
+}
+
+// Handles requests related to bulk imports
+func (api *API) ImportHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		api.Import(w, r)
+	}
+}
+
+// POST /import - imports the performers, performances and junctions csv files of a multipart form.
+// ?dryRun=true validates everything without saving it
+func (api *API) Import(w http.ResponseWriter, r *http.Request) {
+	// anything bigger than this is spooled to disk by the multipart reader
+	const maxMemory = 10 << 20
+	err := r.ParseMultipartForm(maxMemory)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Expected a multipart form")
+		return
+	}
+
+	files := ImportFiles{}
+	targets := map[string]*io.Reader{
+		"performers":   &files.Performers,
+		"performances": &files.Performances,
+		"junctions":    &files.Junctions,
+	}
+	for field, target := range targets {
+		file, _, err := r.FormFile(field)
+		if err == http.ErrMissingFile {
+			// also accept the csv pasted into a plain form field
+			if value := r.FormValue(field); value != "" {
+				*target = strings.NewReader(value)
+			}
+			continue
+		}
+		if err != nil {
+			api.respondError(w, http.StatusBadRequest, "Unable to read "+field)
+			return
+		}
+		defer file.Close()
+		*target = file
+	}
+
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dryRun"))
+
+	report, err := api.wrapperFor(r).Import(files, dryRun)
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Import failed")
+		return
+	}
+
+	switch {
+	case len(report.Errors) > 0:
+		api.respondJSON(w, http.StatusUnprocessableEntity, report)
+	case report.Committed:
+		api.respondJSON(w, http.StatusCreated, report)
+	default:
+		api.respondJSON(w, http.StatusOK, report)
+	}
+}
@@ -0,0 +1,160 @@
+package internal_test
+
+import (
+	"bytes"
+	"encoding/json"
+	internal "foc_api/internal"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPerformersCSV = `name,email
+Alice Smith,alice@test.com
+Bob Jones,bob@test.com
+`
+
+const testPerformancesCSV = `itemName,genreName,groupName,location,startTime,endTime
+Opening Number,Musical,Whole School,Main Hall,2025-09-01T18:00:00Z,2025-09-01T18:10:00Z
+Drum Solo,Rock,Bob Jones,Main Hall,2025-09-01T18:15:00Z,2025-09-01T18:20:00Z
+`
+
+const testJunctionsCSV = `email,itemName
+alice@test.com,Opening Number
+bob@test.com,Opening Number
+bob@test.com,Drum Solo
+`
+
+func TestImport(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	// an existing performer should be matched by email rather than duplicated
+	_, err := dbw.CreatePerformer(&internal.Performer{Name: "Alice", Email: "ALICE@test.com"})
+	require.NoError(t, err, "CreatePerformer() failed: %v", err)
+
+	files := internal.ImportFiles{
+		Performers:   strings.NewReader(testPerformersCSV),
+		Performances: strings.NewReader(testPerformancesCSV),
+		Junctions:    strings.NewReader(testJunctionsCSV),
+	}
+
+	// act
+	report, err := dbw.Import(files, false)
+
+	// assert
+	require.NoError(t, err, "Import() failed: %v", err)
+	assert.Empty(t, report.Errors)
+	assert.True(t, report.Committed, "Import was not committed")
+	assert.Equal(t, 1, report.Created["performers"])
+	assert.Equal(t, 1, report.Updated["performers"])
+	assert.Equal(t, 2, report.Created["performances"])
+	assert.Equal(t, 3, report.Created["junctions"])
+
+	performers, err := dbw.GetAllPerformers()
+	require.NoError(t, err, "GetAllPerformers() failed: %v", err)
+	assert.Len(t, performers, 2)
+	assert.Equal(t, "Alice Smith", performers[0].Name)
+
+	performances, err := dbw.GetPerformancesByPerformerId(performers[1].Id)
+	require.NoError(t, err, "GetPerformancesByPerformerId() failed: %v", err)
+	assert.Len(t, performances, 2)
+}
+
+func TestImportRollsBackOnRowErrors(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	files := internal.ImportFiles{
+		Performers: strings.NewReader(testPerformersCSV + "No Email,\n"),
+		Performances: strings.NewReader(`itemName,startTime,endTime
+Fine,2025-09-01T18:00:00Z,2025-09-01T18:10:00Z
+Backwards,2025-09-01T18:10:00Z,2025-09-01T18:00:00Z
+Bad Time,tomorrow,
+`),
+	}
+
+	// act
+	report, err := dbw.Import(files, false)
+
+	// assert
+	require.NoError(t, err, "Import() failed: %v", err)
+	assert.False(t, report.Committed, "Import with bad rows was committed")
+	require.Len(t, report.Errors, 3)
+	assert.Equal(t, "performers", report.Errors[0].Entity)
+	assert.Equal(t, 4, report.Errors[0].Row)
+	assert.Equal(t, "performances", report.Errors[1].Entity)
+	assert.Equal(t, 3, report.Errors[1].Row)
+	assert.Equal(t, 4, report.Errors[2].Row)
+
+	performers, err := dbw.GetAllPerformers()
+	require.NoError(t, err, "GetAllPerformers() failed: %v", err)
+	assert.Empty(t, performers, "Performers were saved despite the failed import")
+}
+
+func TestImportDryRun(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	files := internal.ImportFiles{
+		Performers:   strings.NewReader(testPerformersCSV),
+		Performances: strings.NewReader(testPerformancesCSV),
+		Junctions:    strings.NewReader(testJunctionsCSV),
+	}
+
+	// act
+	report, err := dbw.Import(files, true)
+
+	// assert
+	require.NoError(t, err, "Import() failed: %v", err)
+	assert.Empty(t, report.Errors)
+	assert.False(t, report.Committed, "Dry run was committed")
+	assert.Equal(t, 3, report.Created["junctions"])
+
+	performances, err := dbw.GetAllPerformances()
+	require.NoError(t, err, "GetAllPerformances() failed: %v", err)
+	assert.Empty(t, performances, "Dry run saved performances")
+}
+
+func TestImportEndpoint(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+	api := internal.NewAPI(dbw)
+
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+	for field, contents := range map[string]string{"performers": testPerformersCSV, "performances": testPerformancesCSV, "junctions": testJunctionsCSV} {
+		part, err := form.CreateFormFile(field, field+".csv")
+		require.NoError(t, err)
+		part.Write([]byte(contents))
+	}
+	form.Close()
+
+	r := httptest.NewRequest("POST", "/import", body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	w := httptest.NewRecorder()
+
+	// act
+	api.ImportHandler(w, r)
+
+	// assert
+	require.Equal(t, http.StatusCreated, w.Code, "ImportHandler() returned status %v: %s", w.Code, w.Body.String())
+
+	var report internal.ImportReport
+	err := json.NewDecoder(w.Body).Decode(&report)
+	require.NoError(t, err, "Error decoding response from endpoint: %v", err)
+	assert.Equal(t, 2, report.Created["performers"])
+}
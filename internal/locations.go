@@ -0,0 +1,547 @@
+package internal
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type Location struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+var (
+	ErrUnknownLocation   = errors.New("location does not exist")
+	ErrDuplicateLocation = errors.New("a location with that name already exists")
+	ErrLocationInUse     = errors.New("location still has performances")
+)
+
+// returned when a performance would overlap another performance at the same location
+type LocationClashError struct {
+	Location string
+	Clashes  []*Performance
+}
+
+func (e *LocationClashError) Error() string {
+	return fmt.Sprintf("location clash: %s is already booked by %d performance(s)", e.Location, len(e.Clashes))
+}
+
+// creates a location and puts it into the db
+func (dbw *DBWrapper) CreateLocation(l *Location) (*Location, error) {
+	err := dbw.InTransaction(func(tx *DBWrapper) error {
+		err := tx.insertLocation(l)
+		if err != nil {
+			return err
+		}
+		return tx.audit(auditEntityLocation, strconv.Itoa(l.Id), auditActionCreate, nil, l)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// puts l into the db without auditing it, for locations that are made as part of another change
+func (dbw *DBWrapper) insertLocation(l *Location) error {
+	l.Name = strings.TrimSpace(l.Name)
+
+	existing, err := dbw.GetLocationByName(l.Name)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return ErrDuplicateLocation
+	}
+
+	dbQuery := `
+		INSERT INTO locations (name)
+		VALUES (?)
+		RETURNING id
+	`
+
+	return dbw.db.QueryRow(dbQuery, l.Name).
+		Scan(&l.Id)
+}
+
+// returns a slice with all the locations in the db
+func (dbw *DBWrapper) GetAllLocations() ([]*Location, error) {
+	dbQuery := `
+		SELECT id, name
+		FROM locations
+		WHERE deleted = 0
+		ORDER BY id ASC
+	`
+
+	rows, err := dbw.db.Query(dbQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	locations := []*Location{}
+	for rows.Next() {
+		l := &Location{}
+		err := rows.Scan(&l.Id, &l.Name)
+		if err != nil {
+			return nil, err
+		}
+		locations = append(locations, l)
+	}
+
+	return locations, nil
+}
+
+// Return the location with the given id
+func (dbw *DBWrapper) GetLocationById(id int) (*Location, error) {
+	dbQuery := `
+		SELECT id, name
+		FROM locations
+		WHERE id = ? AND deleted = 0
+	`
+
+	l := &Location{}
+	err := dbw.db.QueryRow(dbQuery, id).
+		Scan(&l.Id, &l.Name)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Return the location with the given name, ignoring case and surrounding whitespace
+func (dbw *DBWrapper) GetLocationByName(name string) (*Location, error) {
+	dbQuery := `
+		SELECT id, name
+		FROM locations
+		WHERE name = ? AND deleted = 0
+	`
+
+	l := &Location{}
+	err := dbw.db.QueryRow(dbQuery, strings.TrimSpace(name)).
+		Scan(&l.Id, &l.Name)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Returns all the performances booked into a particular location
+func (dbw *DBWrapper) GetPerformancesByLocationId(locationId int) ([]*Performance, error) {
+	dbQuery := `
+		SELECT ` + performanceColumns + `
+		FROM performances AS p
+		WHERE p.locationId = ? AND p.deleted = 0
+		ORDER BY p.startTime ASC, p.id ASC
+	`
+
+	rows, err := dbw.db.Query(dbQuery, locationId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	performances := []*Performance{}
+	for rows.Next() {
+		p, err := scanPerformance(rows)
+		if err != nil {
+			return nil, err
+		}
+		performances = append(performances, p)
+	}
+
+	return performances, nil
+}
+
+// Renames the location with the given id, along with every performance booked into it
+func (dbw *DBWrapper) UpdateLocationById(id int, l *Location) error {
+	l.Name = strings.TrimSpace(l.Name)
+
+	return dbw.InTransaction(func(tx *DBWrapper) error {
+		before, err := tx.GetLocationById(id)
+		if err != nil {
+			return err
+		}
+		if before == nil {
+			return sql.ErrNoRows
+		}
+
+		existing, err := tx.GetLocationByName(l.Name)
+		if err != nil {
+			return err
+		}
+		if existing != nil && existing.Id != id {
+			return ErrDuplicateLocation
+		}
+
+		dbQuery := `
+			UPDATE locations
+			SET name = ?
+			WHERE id = ? AND deleted = 0
+		`
+
+		result, err := tx.db.Exec(dbQuery, l.Name, id)
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		// error if no matching rows were found and updated
+		if rowsAffected == 0 {
+			return sql.ErrNoRows
+		}
+
+		err = tx.renameLocationPerformances(id, l.Name)
+		if err != nil {
+			return err
+		}
+
+		l.Id = id
+		return tx.audit(auditEntityLocation, strconv.Itoa(id), auditActionUpdate, before, l)
+	})
+}
+
+// keeps the denormalised location name on performances in step. only performances whose
+// location actually changes get a new version, and each one is audited as an update
+func (dbw *DBWrapper) renameLocationPerformances(id int, name string) error {
+	rows, err := dbw.db.Query(`SELECT id FROM performances WHERE locationId = ? AND location <> ?`, id, name)
+	if err != nil {
+		return err
+	}
+	ids := []int{}
+	for rows.Next() {
+		var performanceId int
+		err := rows.Scan(&performanceId)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, performanceId)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, performanceId := range ids {
+		before, err := dbw.getPerformanceRecord(performanceId)
+		if err != nil {
+			return err
+		}
+
+		_, err = dbw.db.Exec(`UPDATE performances SET location = ?, version = version + 1 WHERE id = ?`, name, performanceId)
+		if err != nil {
+			return err
+		}
+
+		after := before.Performance
+		after.Location = name
+		after.Version++
+		err = dbw.audit(auditEntityPerformance, strconv.Itoa(performanceId), auditActionUpdate, &before.Performance, &after)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Deletes the location with the given id. returns sql.ErrNoRows if there's no such location, and
+// locations that still have performances can't be deleted
+func (dbw *DBWrapper) DeleteLocationById(id int) error {
+	return dbw.InTransaction(func(tx *DBWrapper) error {
+		before, err := tx.GetLocationById(id)
+		if err != nil {
+			return err
+		}
+		if before == nil {
+			return sql.ErrNoRows
+		}
+
+		performances, err := tx.GetPerformancesByLocationId(id)
+		if err != nil {
+			return err
+		}
+		if len(performances) > 0 {
+			return ErrLocationInUse
+		}
+
+		dbQuery := `
+			UPDATE locations
+			SET deleted = 1
+			WHERE id = ? AND deleted = 0
+		`
+		result, err := tx.db.Exec(dbQuery, id)
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return sql.ErrNoRows
+		}
+		return tx.audit(auditEntityLocation, strconv.Itoa(id), auditActionDelete, before, nil)
+	})
+}
+
+// points p at a location row, creating one the first time a location name is used.
+// names are matched case-insensitively and p.Location is rewritten to the canonical spelling.
+// a location made here shows up in the performance's audit entry rather than one of its own
+func (dbw *DBWrapper) resolveLocation(p *Performance) error {
+	if p.LocationId != 0 {
+		l, err := dbw.GetLocationById(p.LocationId)
+		if err != nil {
+			return err
+		}
+		if l == nil {
+			return ErrUnknownLocation
+		}
+		p.Location = l.Name
+		return nil
+	}
+
+	if strings.TrimSpace(p.Location) == "" {
+		p.Location = ""
+		return nil
+	}
+
+	l, err := dbw.GetLocationByName(p.Location)
+	if err != nil {
+		return err
+	}
+	if l == nil {
+		l = &Location{Name: p.Location}
+		err = dbw.insertLocation(l)
+		if err != nil {
+			return err
+		}
+	}
+
+	p.LocationId = l.Id
+	p.Location = l.Name
+	return nil
+}
+
+// returns a LocationClashError if p overlaps any other performance at its location
+func (dbw *DBWrapper) checkLocationClashes(p *Performance) error {
+	if p.LocationId == 0 {
+		return nil
+	}
+
+	booked, err := dbw.GetPerformancesByLocationId(p.LocationId)
+	if err != nil {
+		return err
+	}
+
+	clashes := []*Performance{}
+	for _, other := range booked {
+		if other.Id != p.Id && overlaps(p, other, 0) {
+			clashes = append(clashes, other)
+		}
+	}
+
+	if len(clashes) > 0 {
+		return &LocationClashError{Location: p.Location, Clashes: clashes}
+	}
+	return nil
+}
+
+// Handles all requests related to locations
+func (api *API) LocationHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		if r.URL.Path == "/locations" || r.URL.Path == "/locations/" {
+			api.GetAllLocations(w, r)
+		} else if strings.HasSuffix(strings.TrimSuffix(r.URL.Path, "/"), "/equipment") {
+			api.GetLocationEquipment(w, r)
+		} else if pathLength(r.URL.Path) > 2 {
+			api.GetPerformancesByLocationId(w, r)
+		} else {
+			api.GetLocationById(w, r)
+		}
+	case http.MethodPost:
+		if r.URL.Path == "/locations" || r.URL.Path == "/locations/" {
+			api.CreateNewLocation(w, r)
+		} else if strings.HasSuffix(strings.TrimSuffix(r.URL.Path, "/"), "/delay") {
+			api.DelayLocation(w, r)
+		} else {
+			api.respondError(w, http.StatusNotFound, "Not Found")
+		}
+	case http.MethodPut:
+		api.UpdateLocation(w, r)
+	case http.MethodDelete:
+		api.DeleteLocation(w, r)
+	}
+}
+
+// GET /locations - returns all locations
+func (api *API) GetAllLocations(w http.ResponseWriter, r *http.Request) {
+	locations, err := api.wrapperFor(r).GetAllLocations()
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Unable to find locations")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, map[string][]*Location{"locations": locations})
+}
+
+// GET /locations/:id - return location with given ID
+func (api *API) GetLocationById(w http.ResponseWriter, r *http.Request) {
+	id, err := api.extractId(r.URL.Path)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	location, err := api.wrapperFor(r).GetLocationById(id)
+	if err != nil || location == nil {
+		api.respondError(w, http.StatusNotFound, "Location Not Found")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, location)
+}
+
+// GET /locations/:id/performances - returns performances booked into the location with the specified id
+func (api *API) GetPerformancesByLocationId(w http.ResponseWriter, r *http.Request) {
+	id, err := api.extractId(r.URL.Path)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Error extracting id")
+		return
+	}
+
+	performances, err := api.wrapperFor(r).GetPerformancesByLocationId(id)
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Unable to find performances")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, map[string][]*Performance{"performances": performances})
+}
+
+// POST /locations/ - Create a new location
+func (api *API) CreateNewLocation(w http.ResponseWriter, r *http.Request) {
+	var location Location
+
+	err := json.NewDecoder(r.Body).Decode(&location)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	if strings.TrimSpace(location.Name) == "" {
+		api.respondError(w, http.StatusBadRequest, "Cannot be blank")
+		return
+	}
+
+	newLocation, err := api.wrapperFor(r).CreateLocation(&location)
+	if errors.Is(err, ErrDuplicateLocation) {
+		api.respondError(w, http.StatusConflict, "Location already exists")
+		return
+	}
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Failed to create location")
+		return
+	}
+
+	api.respondJSON(w, http.StatusCreated, newLocation)
+}
+
+// PUT /locations/:id - renames the location with the specified id
+func (api *API) UpdateLocation(w http.ResponseWriter, r *http.Request) {
+	var location Location
+
+	err := json.NewDecoder(r.Body).Decode(&location)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	id, err := api.extractId(r.URL.Path)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid ID provided")
+		return
+	}
+
+	if strings.TrimSpace(location.Name) == "" {
+		api.respondError(w, http.StatusBadRequest, "Cannot be blank")
+		return
+	}
+
+	err = api.wrapperFor(r).UpdateLocationById(id, &location)
+	if errors.Is(err, ErrDuplicateLocation) {
+		api.respondError(w, http.StatusConflict, "Location already exists")
+		return
+	}
+	if err == sql.ErrNoRows {
+		api.respondError(w, http.StatusNotFound, "Location Not Found")
+		return
+	}
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Error updating location")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// DELETE /locations/:id - deletes the location with the specified id, as long as it has no performances
+func (api *API) DeleteLocation(w http.ResponseWriter, r *http.Request) {
+	id, err := api.extractId(r.URL.Path)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid ID provided")
+		return
+	}
+
+	err = api.wrapperFor(r).DeleteLocationById(id)
+	if errors.Is(err, ErrLocationInUse) {
+		api.respondError(w, http.StatusConflict, "Location still has performances")
+		return
+	}
+	if err == sql.ErrNoRows {
+		api.respondError(w, http.StatusNotFound, "Location Not Found")
+		return
+	}
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Error deleting location")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// responds with a 409 listing the clashing performances if err is a LocationClashError, and reports whether it did
+func (api *API) respondIfLocationClash(w http.ResponseWriter, err error) bool {
+	var clashErr *LocationClashError
+	if !errors.As(err, &clashErr) {
+		return false
+	}
+
+	api.respondJSON(w, http.StatusConflict, map[string]interface{}{
+		"error":    "Location already booked, retry with ?force=true to book it anyway",
+		"location": clashErr.Location,
+		"clashes":  clashErr.Clashes,
+	})
+	return true
+}
+
+// reports whether the request asked to override location clashes with ?force=true
+func isForced(r *http.Request) bool {
+	return queryFlag(r, "force")
+}
@@ -0,0 +1,270 @@
+package internal_test
+
+import (
+	"bytes"
+	"encoding/json"
+	internal "foc_api/internal"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreatePerformanceResolvesLocation(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	first := getTestPerformances(2)[0]
+	first.Location = "Main Hall"
+	second := getTestPerformances(2)[1]
+	second.Location = "  main hall "
+
+	// act
+	first, err := dbw.CreatePerformance(first)
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+	second, err = dbw.CreatePerformance(second)
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+
+	// assert
+	assert.NotEqual(t, 0, first.LocationId, "Location was not created")
+	assert.Equal(t, first.LocationId, second.LocationId, "Differently cased locations were not merged")
+	assert.Equal(t, "Main Hall", second.Location, "Location name was not canonicalised")
+
+	locations, err := dbw.GetAllLocations()
+	require.NoError(t, err, "GetAllLocations() failed: %v", err)
+	assert.Len(t, locations, 1)
+}
+
+func TestCreatePerformanceRejectsLocationClash(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	start := time.Date(2025, 9, 1, 18, 0, 0, 0, time.UTC)
+	booked := getTestPerformance()
+	booked.StartTime = start
+	booked.EndTime = start.Add(10 * time.Minute)
+	booked, err := dbw.CreatePerformance(booked)
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+
+	clashing := getTestPerformance()
+	clashing.StartTime = start.Add(5 * time.Minute)
+	clashing.EndTime = start.Add(15 * time.Minute)
+
+	// act
+	_, err = dbw.CreatePerformance(clashing)
+
+	// assert
+	var clashErr *internal.LocationClashError
+	require.ErrorAs(t, err, &clashErr, "Clashing performance was not rejected")
+	require.Len(t, clashErr.Clashes, 1)
+	assert.Equal(t, booked.Id, clashErr.Clashes[0].Id)
+
+	_, err = dbw.ForceCreatePerformance(clashing)
+	assert.NoError(t, err, "ForceCreatePerformance() failed: %v", err)
+}
+
+func TestUpdateLocationRenamesPerformances(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db).WithActor("user:7")
+
+	performance, err := dbw.CreatePerformance(getTestPerformance())
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+
+	// act
+	err = dbw.UpdateLocationById(performance.LocationId, &internal.Location{Name: "Drama Studio"})
+	require.NoError(t, err, "UpdateLocationById() failed: %v", err)
+
+	// assert
+	actual, err := dbw.GetPerformanceById(performance.Id)
+	require.NoError(t, err, "GetPerformanceById() failed: %v", err)
+	assert.Equal(t, "Drama Studio", actual.Location)
+	assert.Equal(t, performance.LocationId, actual.LocationId)
+	assert.Equal(t, performance.Version+1, actual.Version)
+
+	entries, _, err := dbw.ListAuditEntries(url.Values{"entity": {"performance"}, "action": {"update"}})
+	require.NoError(t, err, "ListAuditEntries() failed: %v", err)
+	require.Len(t, entries, 1, "Renaming the location should be recorded against its performances")
+	assert.Equal(t, "user:7", entries[0].Actor)
+	var after internal.Performance
+	require.NoError(t, json.Unmarshal(entries[0].After, &after))
+	assert.Equal(t, "Drama Studio", after.Location)
+}
+
+func TestLocationChangesAreAudited(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db).WithActor("user:7")
+
+	// act
+	l, err := dbw.CreateLocation(&internal.Location{Name: "Main Hall"})
+	require.NoError(t, err, "CreateLocation() failed: %v", err)
+	require.NoError(t, dbw.UpdateLocationById(l.Id, &internal.Location{Name: "Great Hall"}))
+	require.NoError(t, dbw.DeleteLocationById(l.Id))
+	_, err = dbw.CreatePerformance(&internal.Performance{ItemName: "Act One", Location: "Side Stage"})
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+
+	entries, _, err := dbw.ListAuditEntries(url.Values{"entity": {"location"}})
+
+	// assert
+	require.NoError(t, err, "ListAuditEntries() failed: %v", err)
+	actions := []string{}
+	for _, entry := range entries {
+		actions = append(actions, entry.Action)
+		assert.Equal(t, strconv.Itoa(l.Id), entry.EntityId, "Only the location made on its own should be audited")
+		assert.Equal(t, "user:7", entry.Actor)
+	}
+	assert.Equal(t, []string{"create", "update", "delete"}, actions)
+
+	var before, after internal.Location
+	require.NoError(t, json.Unmarshal(entries[1].Before, &before))
+	require.NoError(t, json.Unmarshal(entries[1].After, &after))
+	assert.Equal(t, "Main Hall", before.Name)
+	assert.Equal(t, "Great Hall", after.Name)
+}
+
+func TestLocationEndpointOnlyCreatesAtTheRoot(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+	api := internal.NewAPI(dbw)
+
+	cases := []struct {
+		path     string
+		expected int
+	}{
+		{"/locations/1/anything", http.StatusNotFound},
+		{"/locations/1", http.StatusNotFound},
+		{"/locations", http.StatusCreated},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest("POST", c.path, strings.NewReader(`{"name": "Main Hall"}`))
+		w := httptest.NewRecorder()
+
+		// act
+		api.LocationHandler(w, r)
+
+		// assert
+		assert.Equal(t, c.expected, w.Code, "POST %s returned the wrong status", c.path)
+	}
+
+	locations, err := dbw.GetAllLocations()
+	require.NoError(t, err, "GetAllLocations() failed: %v", err)
+	assert.Len(t, locations, 1)
+}
+
+func TestDeleteLocationEndpoint(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+	api := internal.NewAPI(dbw)
+
+	performance, err := dbw.CreatePerformance(getTestPerformance())
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+	locationPath := "/locations/" + strconv.Itoa(performance.LocationId)
+
+	cases := []struct {
+		method, path string
+		expected     int
+	}{
+		{"DELETE", locationPath, http.StatusConflict},
+		{"DELETE", "/performances/" + strconv.Itoa(performance.Id), http.StatusOK},
+		{"DELETE", locationPath, http.StatusOK},
+		{"DELETE", locationPath, http.StatusNotFound},
+		{"DELETE", "/locations/99", http.StatusNotFound},
+		{"POST", "/performances/" + strconv.Itoa(performance.Id) + "/restore", http.StatusOK},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest(c.method, c.path, nil)
+		r.Header.Set("If-Match", "*")
+		w := httptest.NewRecorder()
+
+		// act
+		if strings.HasPrefix(c.path, "/locations") {
+			api.LocationHandler(w, r)
+		} else {
+			api.PerformanceHandler(w, r)
+		}
+
+		// assert
+		assert.Equal(t, c.expected, w.Code, "%s %s returned the wrong status", c.method, c.path)
+	}
+
+	// the archived performance's location was deleted, so restoring it books it in by name again
+	restored, err := dbw.GetPerformanceById(performance.Id)
+	require.NoError(t, err, "GetPerformanceById() failed: %v", err)
+	require.NotNil(t, restored)
+	assert.Equal(t, performance.Location, restored.Location)
+	assert.NotEqual(t, performance.LocationId, restored.LocationId)
+}
+
+func TestMigrateLocationsMergesExistingStrings(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+
+	err := internal.MigrateTo(db, 1)
+	require.NoError(t, err, "MigrateTo(1) failed: %v", err)
+
+	_, err = db.Exec(`
+		INSERT INTO performances (itemName, genreName, groupName, location, startTime, endTime) VALUES
+			('One', '', '', 'Main Hall', '2025-09-01 18:00:00+00:00', '2025-09-01 18:05:00+00:00'),
+			('Two', '', '', 'main hall ', '2025-09-01 19:00:00+00:00', '2025-09-01 19:05:00+00:00'),
+			('Three', '', '', 'Gym', '2025-09-01 18:00:00+00:00', '2025-09-01 18:05:00+00:00')
+	`)
+	require.NoError(t, err)
+
+	// act
+	err = internal.Migrate(db)
+	require.NoError(t, err, "Migrate() failed: %v", err)
+
+	// assert
+	dbw := internal.CreateDBWrapper(db)
+	locations, err := dbw.GetAllLocations()
+	require.NoError(t, err, "GetAllLocations() failed: %v", err)
+	require.Len(t, locations, 2)
+	assert.Equal(t, "Main Hall", locations[0].Name)
+	assert.Equal(t, "Gym", locations[1].Name)
+
+	performances, err := dbw.GetPerformancesByLocationId(locations[0].Id)
+	require.NoError(t, err, "GetPerformancesByLocationId() failed: %v", err)
+	require.Len(t, performances, 2)
+	assert.Equal(t, "Main Hall", performances[1].Location)
+}
+
+func TestCreateLocationEndpointRejectsDuplicate(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+	api := internal.NewAPI(dbw)
+
+	_, err := dbw.CreateLocation(&internal.Location{Name: "Main Hall"})
+	require.NoError(t, err, "CreateLocation() failed: %v", err)
+
+	body, _ := json.Marshal(&internal.Location{Name: "MAIN HALL"})
+	r := httptest.NewRequest("POST", "/locations", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+
+	// act
+	api.CreateNewLocation(w, r)
+
+	// assert
+	assert.Equal(t, http.StatusConflict, w.Code, "CreateNewLocation() handler returned status %v", w.Code)
+}
@@ -0,0 +1,79 @@
+package internal
+
+import (
+	"fmt"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// an email to a single recipient
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// sends emails. swap implementations to change how (or whether) mail actually goes out
+type Mailer interface {
+	Send(msg *Message) error
+}
+
+// writes every message to a file in Dir instead of sending it, so mail can be read locally in dev
+type OutboxMailer struct {
+	Dir  string
+	From string
+}
+
+// anything that isn't safe in a file name is replaced when naming outbox files
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9@._-]`)
+
+func (m *OutboxMailer) Send(msg *Message) error {
+	err := os.MkdirAll(m.Dir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	name := fmt.Sprintf("%s-%s.eml", now.Format("20060102T150405.000000000"), unsafeFileChars.ReplaceAllString(msg.To, "_"))
+	return os.WriteFile(filepath.Join(m.Dir, name), formatMessage(m.From, msg, now), 0o644)
+}
+
+// sends messages through an smtp server, authenticating if a username is set
+type SMTPMailer struct {
+	// host:port of the server
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+func (m *SMTPMailer) Send(msg *Message) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, _ := strings.Cut(m.Addr, ":")
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+	return smtp.SendMail(m.Addr, auth, m.From, []string{msg.To}, formatMessage(m.From, msg, time.Now()))
+}
+
+// renders a plain text email with its headers
+func formatMessage(from string, msg *Message, date time.Time) []byte {
+	// a newline in a header would let the value add headers of its own
+	header := func(value string) string {
+		return strings.NewReplacer("\r", "", "\n", "").Replace(value)
+	}
+
+	var b strings.Builder
+	b.WriteString("From: " + header(from) + "\r\n")
+	b.WriteString("To: " + header(msg.To) + "\r\n")
+	b.WriteString("Subject: " + header(msg.Subject) + "\r\n")
+	b.WriteString("Date: " + date.Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
@@ -0,0 +1,1147 @@
+package internal
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// a single versioned change to the schema. up moves the schema forward, down undoes it
+type migration struct {
+	version int
+	name    string
+	up      func(tx *sql.Tx) error
+	down    func(tx *sql.Tx) error
+}
+
+// every migration the binary knows about, in the order they must be applied.
+// never edit or reorder a migration that has shipped - add a new one instead
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "create performances, performers and junction tables",
+		up:      migrateInitialSchemaUp,
+		down:    migrateInitialSchemaDown,
+	},
+	{
+		version: 2,
+		name:    "promote performance locations to a locations table",
+		up:      migrateLocationsUp,
+		down:    migrateLocationsDown,
+	},
+	{
+		version: 3,
+		name:    "store performance times in utc",
+		up:      migrateUTCTimesUp,
+		down:    migrateUTCTimesDown,
+	},
+	{
+		version: 4,
+		name:    "add full-text search index",
+		up:      migrateSearchIndexUp,
+		down:    migrateSearchIndexDown,
+	},
+	{
+		version: 5,
+		name:    "add users for authentication",
+		up:      migrateUsersUp,
+		down:    migrateUsersDown,
+	},
+	{
+		version: 6,
+		name:    "add performer login codes and sessions",
+		up:      migratePerformerLoginUp,
+		down:    migratePerformerLoginDown,
+	},
+	{
+		version: 7,
+		name:    "add audit log",
+		up:      migrateAuditLogUp,
+		down:    migrateAuditLogDown,
+	},
+	{
+		version: 8,
+		name:    "allow restore and purge in the audit log",
+		up:      migrateAuditArchiveActionsUp,
+		down:    migrateAuditArchiveActionsDown,
+	},
+	{
+		version: 9,
+		name:    "add row versions to performances and performers",
+		up:      migrateRowVersionsUp,
+		down:    migrateRowVersionsDown,
+	},
+	{
+		version: 10,
+		name:    "store performance durations",
+		up:      migrateDurationsUp,
+		down:    migrateDurationsDown,
+	},
+	{
+		version: 11,
+		name:    "keep the planned times of delayed performances",
+		up:      migratePlannedTimesUp,
+		down:    migratePlannedTimesDown,
+	},
+	{
+		version: 12,
+		name:    "add actual performance times and attendance",
+		up:      migrateCheckInUp,
+		down:    migrateCheckInDown,
+	},
+	{
+		version: 13,
+		name:    "scope performances to festival editions",
+		up:      migrateEditionsUp,
+		down:    migrateEditionsDown,
+	},
+	{
+		version: 14,
+		name:    "promote performance genres to a genres table",
+		up:      migrateGenresUp,
+		down:    migrateGenresDown,
+	},
+	{
+		version: 15,
+		name:    "promote performance groups to a groups table with members",
+		up:      migrateGroupsUp,
+		down:    migrateGroupsDown,
+	},
+	{
+		version: 16,
+		name:    "add roles, instruments and notes to junctions",
+		up:      migrateJunctionRolesUp,
+		down:    migrateJunctionRolesDown,
+	},
+	{
+		version: 17,
+		name:    "add tech riders to performances",
+		up:      migrateRidersUp,
+		down:    migrateRidersDown,
+	},
+}
+
+// returns the version of the newest migration the binary knows about
+func LatestSchemaVersion() int {
+	if len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].version
+}
+
+// returns the version of the newest migration applied to the db (0 if none)
+func SchemaVersion(db *sql.DB) (int, error) {
+	err := createMigrationsTable(db)
+	if err != nil {
+		return 0, err
+	}
+
+	version := 0
+	err = db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %v", err)
+	}
+	return version, nil
+}
+
+// applies every pending migration, each in its own transaction
+func Migrate(db *sql.DB) error {
+	return MigrateTo(db, LatestSchemaVersion())
+}
+
+// migrates the db up or down until the schema is at the target version
+func MigrateTo(db *sql.DB, target int) error {
+	current, err := SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	latest := LatestSchemaVersion()
+	// refuse to touch a db that was migrated by a newer binary, we don't know what changed
+	if current > latest {
+		return fmt.Errorf("database schema version %d is newer than the latest version %d supported by this binary", current, latest)
+	}
+	if target < 0 || target > latest {
+		return fmt.Errorf("unknown schema version %d", target)
+	}
+
+	// moving forward: apply migrations in ascending order
+	for _, m := range migrations {
+		if m.version <= current || m.version > target {
+			continue
+		}
+		err := runMigration(db, m, true)
+		if err != nil {
+			return err
+		}
+	}
+
+	// moving backward: undo migrations in descending order
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.version > current || m.version <= target {
+			continue
+		}
+		err := runMigration(db, m, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+
+
+*	Utility Stuff
+
+
+ */
+
+func createMigrationsTable(db *sql.DB) error {
+	createMigrationsString := `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			appliedAt DATETIME NOT NULL
+		);
+	`
+
+	_, err := db.Exec(createMigrationsString)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %v", err)
+	}
+	return nil
+}
+
+// runs a single migration step and records it, all inside one transaction
+func runMigration(db *sql.DB, m migration, up bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	// rollback is a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	if up {
+		err = m.up(tx)
+		if err == nil {
+			_, err = tx.Exec(`INSERT INTO schema_migrations (version, name, appliedAt) VALUES (?, ?, ?)`, m.version, m.name, time.Now().UTC())
+		}
+	} else {
+		err = m.down(tx)
+		if err == nil {
+			_, err = tx.Exec(`DELETE FROM schema_migrations WHERE version = ?`, m.version)
+		}
+	}
+
+	if err != nil {
+		direction := "up"
+		if !up {
+			direction = "down"
+		}
+		return fmt.Errorf("migration %04d (%s) %s failed: %v", m.version, m.name, direction, err)
+	}
+
+	return tx.Commit()
+}
+
+// reports whether the given table has a column with the given name
+func columnExists(tx *sql.Tx, table, column string) (bool, error) {
+	rows, err := tx.Query(fmt.Sprintf(`PRAGMA table_info(%s)`, table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	found := false
+	for rows.Next() {
+		var (
+			cid          int
+			name, ctype  string
+			notNull, pk  int
+			defaultValue sql.NullString
+		)
+		err := rows.Scan(&cid, &name, &ctype, &notNull, &defaultValue, &pk)
+		if err != nil {
+			return false, err
+		}
+		if name == column {
+			found = true
+		}
+	}
+	return found, rows.Err()
+}
+
+// recreates the performances table from createString, keeping every row. follows the
+// create/copy/drop/rename order from the sqlite docs so junction's foreign keys stay pointed at performances
+func rebuildPerformancesTable(tx *sql.Tx, createString string) error {
+	_, err := tx.Exec(strings.Replace(createString, "performances", "performances_new", 1))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO performances_new (id, itemName, genreName, groupName, location, startTime, endTime)
+		SELECT id, itemName, genreName, groupName, location, startTime, endTime
+		FROM performances
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DROP TABLE performances`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`ALTER TABLE performances_new RENAME TO performances`)
+	return err
+}
+
+/*
+
+
+*	Migrations
+
+
+ */
+
+// 0001: the original schema. uses IF NOT EXISTS so that databases created before
+// migrations existed are adopted as-is rather than recreated
+func migrateInitialSchemaUp(tx *sql.Tx) error {
+	createPerformancesString := `
+		CREATE TABLE IF NOT EXISTS performances (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			itemName TEXT NOT NULL,
+			genreName TEXT NOT NULL,
+			groupName TEXT NOT NULL,
+			location TEXT NOT NULL,
+			startTime DATETIME,
+			endTime DATETIME,
+			deleted BOOLEAN DEFAULT 0
+		);
+	`
+
+	createPerformersString := `
+		CREATE TABLE IF NOT EXISTS performers (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			email TEXT NOT NULL,
+			deleted BOOLEAN DEFAULT 0
+		);
+	`
+
+	createJunctionString := `
+		CREATE TABLE IF NOT EXISTS junction (
+			performer_id INTEGER NOT NULL,
+			performance_id INTEGER NOT NULL,
+			PRIMARY KEY (performer_id, performance_id),
+			FOREIGN KEY (performer_id) REFERENCES performers(id),
+			FOREIGN KEY (performance_id) REFERENCES performances(id)
+		);
+	`
+
+	// creates performances table
+	_, err := tx.Exec(createPerformancesString)
+	if err != nil {
+		return fmt.Errorf("failed to create performances table: %v", err)
+	}
+
+	// creates performers table
+	_, err = tx.Exec(createPerformersString)
+	if err != nil {
+		return fmt.Errorf("failed to create performers table: %v", err)
+	}
+
+	// creates junction table that stores pairs of performers and performances
+	_, err = tx.Exec(createJunctionString)
+	if err != nil {
+		return fmt.Errorf("failed to create junctions table: %v", err)
+	}
+
+	// some older databases were created by a version of createTables that was missing a comma
+	// before the deleted column, which swallowed it into endTime's type. rebuild those tables
+	hasDeleted, err := columnExists(tx, "performances", "deleted")
+	if err != nil {
+		return err
+	}
+	if !hasDeleted {
+		err = rebuildPerformancesTable(tx, createPerformancesString)
+		if err != nil {
+			return fmt.Errorf("failed to repair performances table: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func migrateInitialSchemaDown(tx *sql.Tx) error {
+	for _, table := range []string{"junction", "performers", "performances"} {
+		_, err := tx.Exec(fmt.Sprintf(`DROP TABLE IF EXISTS %s`, table))
+		if err != nil {
+			return fmt.Errorf("failed to drop %s table: %v", table, err)
+		}
+	}
+	return nil
+}
+
+// 0002: locations become rows of their own. every distinct location string already in use
+// becomes a location (case-insensitively, so "Main Hall" and "main hall" merge) and
+// performances are pointed at it
+func migrateLocationsUp(tx *sql.Tx) error {
+	statements := []string{
+		`CREATE TABLE locations (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL COLLATE NOCASE,
+			deleted BOOLEAN DEFAULT 0
+		)`,
+		// names only need to be unique among locations that haven't been deleted
+		`CREATE UNIQUE INDEX locations_name ON locations(name) WHERE deleted = 0`,
+		`ALTER TABLE performances ADD COLUMN locationId INTEGER REFERENCES locations(id)`,
+		// the first spelling used for a location wins
+		`INSERT INTO locations (name)
+			SELECT TRIM(location)
+			FROM performances
+			WHERE TRIM(location) <> ''
+			GROUP BY TRIM(location) COLLATE NOCASE
+			ORDER BY MIN(id)`,
+		`UPDATE performances
+			SET locationId = (SELECT l.id FROM locations AS l WHERE l.name = TRIM(performances.location))
+			WHERE TRIM(location) <> ''`,
+		`UPDATE performances
+			SET location = (SELECT l.name FROM locations AS l WHERE l.id = performances.locationId)
+			WHERE locationId IS NOT NULL`,
+	}
+
+	for _, statement := range statements {
+		_, err := tx.Exec(statement)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func migrateLocationsDown(tx *sql.Tx) error {
+	statements := []string{
+		`ALTER TABLE performances DROP COLUMN locationId`,
+		`DROP TABLE locations`,
+	}
+
+	for _, statement := range statements {
+		_, err := tx.Exec(statement)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 0003: times used to be stored in whatever zone the client sent them in, which breaks
+// comparing them inside sqlite. rewrite them all in utc
+func migrateUTCTimesUp(tx *sql.Tx) error {
+	rows, err := tx.Query(`SELECT id, startTime, endTime FROM performances`)
+	if err != nil {
+		return err
+	}
+
+	type performanceTimes struct {
+		id                 int
+		startTime, endTime sql.NullTime
+	}
+	// read everything before writing, since the rows can't be updated while they're being read
+	all := []performanceTimes{}
+	for rows.Next() {
+		t := performanceTimes{}
+		err := rows.Scan(&t.id, &t.startTime, &t.endTime)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		all = append(all, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, t := range all {
+		var startTime, endTime interface{}
+		if t.startTime.Valid {
+			startTime = t.startTime.Time.UTC()
+		}
+		if t.endTime.Valid {
+			endTime = t.endTime.Time.UTC()
+		}
+
+		_, err := tx.Exec(`UPDATE performances SET startTime = ?, endTime = ? WHERE id = ?`, startTime, endTime, t.id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// utc times are still valid times, so there's nothing to undo
+func migrateUTCTimesDown(tx *sql.Tx) error {
+	return nil
+}
+
+// 0004: an fts5 index over the searchable text of performances and performers. entity and
+// entityId say which row a match came from
+func migrateSearchIndexUp(tx *sql.Tx) error {
+	createSearchIndexString := `
+		CREATE VIRTUAL TABLE search_index USING fts5(
+			entity UNINDEXED,
+			entityId UNINDEXED,
+			name,
+			genre,
+			groupName,
+			tokenize = 'unicode61 remove_diacritics 2'
+		);
+	`
+
+	_, err := tx.Exec(createSearchIndexString)
+	if err != nil {
+		return fmt.Errorf("failed to create search_index table: %v", err)
+	}
+
+	return rebuildSearchIndex(tx)
+}
+
+func migrateSearchIndexDown(tx *sql.Tx) error {
+	_, err := tx.Exec(`DROP TABLE search_index`)
+	return err
+}
+
+// 0005: users who can authenticate with an api key. only the sha256 of the key is stored
+func migrateUsersUp(tx *sql.Tx) error {
+	createUsersString := `
+		CREATE TABLE users (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			role TEXT NOT NULL CHECK (role IN ('admin', 'organiser', 'read-only')),
+			apiKeyHash TEXT NOT NULL UNIQUE,
+			deleted BOOLEAN DEFAULT 0
+		);
+	`
+
+	_, err := tx.Exec(createUsersString)
+	if err != nil {
+		return fmt.Errorf("failed to create users table: %v", err)
+	}
+	return nil
+}
+
+func migrateUsersDown(tx *sql.Tx) error {
+	_, err := tx.Exec(`DROP TABLE users`)
+	return err
+}
+
+// 0006: one-time login codes emailed to performers, and the sessions they're exchanged for.
+// like api keys, only the sha256 of a code or session token is stored
+func migratePerformerLoginUp(tx *sql.Tx) error {
+	statements := []string{
+		`CREATE TABLE performer_login_codes (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			performerId INTEGER NOT NULL REFERENCES performers(id),
+			codeHash TEXT NOT NULL,
+			expiresAt DATETIME NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			used BOOLEAN DEFAULT 0
+		)`,
+		`CREATE TABLE performer_sessions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			performerId INTEGER NOT NULL REFERENCES performers(id),
+			tokenHash TEXT NOT NULL UNIQUE,
+			expiresAt DATETIME NOT NULL,
+			revoked BOOLEAN DEFAULT 0
+		)`,
+	}
+
+	for _, statement := range statements {
+		_, err := tx.Exec(statement)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func migratePerformerLoginDown(tx *sql.Tx) error {
+	for _, table := range []string{"performer_sessions", "performer_login_codes"} {
+		_, err := tx.Exec(fmt.Sprintf(`DROP TABLE %s`, table))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 0007: a record of every change made to performances, performers and junctions. triggers
+// stop rows from being changed or removed once they've been written
+func migrateAuditLogUp(tx *sql.Tx) error {
+	err := createAuditLogTable(tx, "audit_log", []string{"create", "update", "delete"})
+	if err != nil {
+		return err
+	}
+	return createAuditLogIndexes(tx)
+}
+
+// creates the audit log as name, only accepting the given actions
+func createAuditLogTable(tx *sql.Tx, name string, actions []string) error {
+	createAuditLogString := fmt.Sprintf(`
+		CREATE TABLE %s (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			entity TEXT NOT NULL,
+			entityId TEXT NOT NULL,
+			action TEXT NOT NULL CHECK (action IN ('%s')),
+			actor TEXT NOT NULL,
+			before TEXT,
+			after TEXT,
+			createdAt DATETIME NOT NULL
+		);
+	`, name, strings.Join(actions, "', '"))
+
+	_, err := tx.Exec(createAuditLogString)
+	if err != nil {
+		return fmt.Errorf("failed to create %s table: %v", name, err)
+	}
+	return nil
+}
+
+// the index and append-only triggers, which have to be recreated whenever the table is rebuilt
+func createAuditLogIndexes(tx *sql.Tx) error {
+	statements := []string{
+		`CREATE INDEX audit_log_entity ON audit_log(entity, entityId)`,
+		`CREATE TRIGGER audit_log_no_update BEFORE UPDATE ON audit_log
+			BEGIN SELECT RAISE(ABORT, 'audit_log is append-only'); END`,
+		`CREATE TRIGGER audit_log_no_delete BEFORE DELETE ON audit_log
+			BEGIN SELECT RAISE(ABORT, 'audit_log is append-only'); END`,
+	}
+
+	for _, statement := range statements {
+		_, err := tx.Exec(statement)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func migrateAuditLogDown(tx *sql.Tx) error {
+	_, err := tx.Exec(`DROP TABLE audit_log`)
+	return err
+}
+
+// 0008: restoring and purging archived records are recorded as actions of their own. sqlite
+// can't change a CHECK constraint in place, so the audit log is rebuilt with everything kept
+func migrateAuditArchiveActionsUp(tx *sql.Tx) error {
+	return rebuildAuditLogTable(tx, []string{"create", "update", "delete", "restore", "purge"})
+}
+
+// entries for the new actions would break the old constraint, so they can't be kept
+func migrateAuditArchiveActionsDown(tx *sql.Tx) error {
+	return rebuildAuditLogTable(tx, []string{"create", "update", "delete"})
+}
+
+func rebuildAuditLogTable(tx *sql.Tx, actions []string) error {
+	err := createAuditLogTable(tx, "audit_log_new", actions)
+	if err != nil {
+		return err
+	}
+
+	statements := []string{
+		// the triggers only guard audit_log itself, and go with it when it's dropped
+		fmt.Sprintf(`INSERT INTO audit_log_new SELECT * FROM audit_log WHERE action IN ('%s')`, strings.Join(actions, "', '")),
+		`DROP TABLE audit_log`,
+		`ALTER TABLE audit_log_new RENAME TO audit_log`,
+	}
+
+	for _, statement := range statements {
+		_, err := tx.Exec(statement)
+		if err != nil {
+			return err
+		}
+	}
+	return createAuditLogIndexes(tx)
+}
+
+// 0009: a version on every performance and performer, bumped whenever the row changes, so
+// clients can tell whether someone else changed it since they last read it
+func migrateRowVersionsUp(tx *sql.Tx) error {
+	statements := []string{
+		`ALTER TABLE performances ADD COLUMN version INTEGER NOT NULL DEFAULT 1`,
+		`ALTER TABLE performers ADD COLUMN version INTEGER NOT NULL DEFAULT 1`,
+	}
+
+	for _, statement := range statements {
+		_, err := tx.Exec(statement)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func migrateRowVersionsDown(tx *sql.Tx) error {
+	statements := []string{
+		`ALTER TABLE performances DROP COLUMN version`,
+		`ALTER TABLE performers DROP COLUMN version`,
+	}
+
+	for _, statement := range statements {
+		_, err := tx.Exec(statement)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 0010: the length of each performance in seconds, worked out for the ones already scheduled
+func migrateDurationsUp(tx *sql.Tx) error {
+	_, err := tx.Exec(`ALTER TABLE performances ADD COLUMN duration INTEGER NOT NULL DEFAULT 0`)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`SELECT id, startTime, endTime FROM performances`)
+	if err != nil {
+		return err
+	}
+
+	durations := map[int]int{}
+	for rows.Next() {
+		var id int
+		var startTime, endTime sql.NullTime
+		err := rows.Scan(&id, &startTime, &endTime)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		if startTime.Valid && endTime.Valid && !startTime.Time.IsZero() && endTime.Time.After(startTime.Time) {
+			durations[id] = int(endTime.Time.Sub(startTime.Time) / time.Second)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, duration := range durations {
+		_, err := tx.Exec(`UPDATE performances SET duration = ? WHERE id = ?`, duration, id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func migrateDurationsDown(tx *sql.Tx) error {
+	_, err := tx.Exec(`ALTER TABLE performances DROP COLUMN duration`)
+	return err
+}
+
+// 0011: the times a performance was planned for before it was first delayed. nothing has been
+// delayed yet, so they start as the zero time like unscheduled start and end times
+func migratePlannedTimesUp(tx *sql.Tx) error {
+	statements := []string{
+		`ALTER TABLE performances ADD COLUMN plannedStartTime DATETIME`,
+		`ALTER TABLE performances ADD COLUMN plannedEndTime DATETIME`,
+	}
+
+	for _, statement := range statements {
+		_, err := tx.Exec(statement)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := tx.Exec(`UPDATE performances SET plannedStartTime = ?, plannedEndTime = ?`, time.Time{}, time.Time{})
+	return err
+}
+
+func migratePlannedTimesDown(tx *sql.Tx) error {
+	statements := []string{
+		`ALTER TABLE performances DROP COLUMN plannedStartTime`,
+		`ALTER TABLE performances DROP COLUMN plannedEndTime`,
+	}
+
+	for _, statement := range statements {
+		_, err := tx.Exec(statement)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 0012: when each performance really started and finished, and whether each performer turned up
+func migrateCheckInUp(tx *sql.Tx) error {
+	statements := []string{
+		`ALTER TABLE performances ADD COLUMN actualStartTime DATETIME`,
+		`ALTER TABLE performances ADD COLUMN actualEndTime DATETIME`,
+		`ALTER TABLE junction ADD COLUMN attendance TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE junction ADD COLUMN checkedInAt DATETIME`,
+	}
+
+	for _, statement := range statements {
+		_, err := tx.Exec(statement)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := tx.Exec(`UPDATE performances SET actualStartTime = ?, actualEndTime = ?`, time.Time{}, time.Time{})
+	return err
+}
+
+func migrateCheckInDown(tx *sql.Tx) error {
+	statements := []string{
+		`ALTER TABLE performances DROP COLUMN actualStartTime`,
+		`ALTER TABLE performances DROP COLUMN actualEndTime`,
+		`ALTER TABLE junction DROP COLUMN attendance`,
+		`ALTER TABLE junction DROP COLUMN checkedInAt`,
+	}
+
+	for _, statement := range statements {
+		_, err := tx.Exec(statement)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 0013: performances belong to a festival edition. anything already in the db is put into a
+// single edition, named after the year its earliest performance is in, which becomes current
+func migrateEditionsUp(tx *sql.Tx) error {
+	statements := []string{
+		`CREATE TABLE editions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL COLLATE NOCASE,
+			startTime DATETIME NOT NULL,
+			endTime DATETIME NOT NULL,
+			isCurrent BOOLEAN NOT NULL DEFAULT 0,
+			deleted BOOLEAN NOT NULL DEFAULT 0
+		)`,
+		`CREATE UNIQUE INDEX editions_name ON editions(name) WHERE deleted = 0`,
+		// new performances go into the current edition, so there can only be one
+		`CREATE UNIQUE INDEX editions_current ON editions(isCurrent) WHERE isCurrent = 1 AND deleted = 0`,
+		`ALTER TABLE performances ADD COLUMN editionId INTEGER REFERENCES editions(id)`,
+	}
+
+	for _, statement := range statements {
+		_, err := tx.Exec(statement)
+		if err != nil {
+			return err
+		}
+	}
+
+	rows, err := tx.Query(`SELECT startTime FROM performances`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	found := false
+	earliest := time.Time{}
+	for rows.Next() {
+		// unscheduled performances have no start time, but still need an edition
+		var start sql.NullTime
+		err := rows.Scan(&start)
+		if err != nil {
+			return err
+		}
+		found = true
+		if !start.Valid {
+			continue
+		}
+		if !start.Time.IsZero() && (earliest.IsZero() || start.Time.Before(earliest)) {
+			earliest = start.Time
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if !found {
+		return nil
+	}
+
+	name := "Current"
+	if !earliest.IsZero() {
+		name = fmt.Sprint(earliest.UTC().Year())
+	}
+
+	var id int
+	err = tx.QueryRow(`INSERT INTO editions (name, startTime, endTime, isCurrent) VALUES (?, ?, ?, 1) RETURNING id`, name, time.Time{}, time.Time{}).Scan(&id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE performances SET editionId = ?`, id)
+	return err
+}
+
+func migrateEditionsDown(tx *sql.Tx) error {
+	statements := []string{
+		`ALTER TABLE performances DROP COLUMN editionId`,
+		`DROP TABLE editions`,
+	}
+
+	for _, statement := range statements {
+		_, err := tx.Exec(statement)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 0014: genres were free text, so "Hip Hop", "hip-hop" and "HipHop" counted as different genres.
+// names that only differ in case, spacing or punctuation become one genre, spelt the way it was
+// first used
+func migrateGenresUp(tx *sql.Tx) error {
+	statements := []string{
+		`CREATE TABLE genres (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL COLLATE NOCASE,
+			deleted BOOLEAN NOT NULL DEFAULT 0
+		)`,
+		`CREATE UNIQUE INDEX genres_name ON genres(name) WHERE deleted = 0`,
+		`CREATE TABLE genre_aliases (
+			genreId INTEGER NOT NULL REFERENCES genres(id),
+			alias TEXT NOT NULL COLLATE NOCASE,
+			PRIMARY KEY (genreId, alias)
+		)`,
+		`ALTER TABLE performances ADD COLUMN genreId INTEGER REFERENCES genres(id)`,
+	}
+
+	for _, statement := range statements {
+		_, err := tx.Exec(statement)
+		if err != nil {
+			return err
+		}
+	}
+
+	rows, err := tx.Query(`SELECT id, genreName FROM performances ORDER BY id ASC`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	keys := []string{}
+	names := map[string]string{}
+	performances := map[string][]int{}
+	for rows.Next() {
+		var id int
+		var name string
+		err := rows.Scan(&id, &name)
+		if err != nil {
+			return err
+		}
+		key := genreKey(name)
+		if key == "" {
+			continue
+		}
+		if _, ok := names[key]; !ok {
+			keys = append(keys, key)
+			names[key] = strings.TrimSpace(name)
+		}
+		performances[key] = append(performances[key], id)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for _, key := range keys {
+		var genreId int
+		err := tx.QueryRow(`INSERT INTO genres (name) VALUES (?) RETURNING id`, names[key]).Scan(&genreId)
+		if err != nil {
+			return err
+		}
+		for _, id := range performances[key] {
+			_, err := tx.Exec(`UPDATE performances SET genreId = ?, genreName = ? WHERE id = ?`, genreId, names[key], id)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return rebuildSearchIndex(tx)
+}
+
+func migrateGenresDown(tx *sql.Tx) error {
+	statements := []string{
+		`ALTER TABLE performances DROP COLUMN genreId`,
+		`DROP TABLE genre_aliases`,
+		`DROP TABLE genres`,
+	}
+
+	for _, statement := range statements {
+		_, err := tx.Exec(statement)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 0015: groups become rows with a list of member performers. the group names already in use
+// become groups without any members, so nobody is booked into anything they weren't before.
+// junctions remember the group they came from, so leaving a group only takes the performer out
+// of the performances they were booked into with it
+func migrateGroupsUp(tx *sql.Tx) error {
+	statements := []string{
+		`CREATE TABLE groups (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL COLLATE NOCASE,
+			deleted BOOLEAN NOT NULL DEFAULT 0
+		)`,
+		`CREATE UNIQUE INDEX groups_name ON groups(name) WHERE deleted = 0`,
+		`CREATE TABLE group_members (
+			groupId INTEGER NOT NULL REFERENCES groups(id),
+			performerId INTEGER NOT NULL REFERENCES performers(id),
+			PRIMARY KEY (groupId, performerId)
+		)`,
+		`ALTER TABLE performances ADD COLUMN groupId INTEGER REFERENCES groups(id)`,
+		`ALTER TABLE junction ADD COLUMN groupId INTEGER REFERENCES groups(id)`,
+		// the first spelling used for a group wins
+		`INSERT INTO groups (name)
+			SELECT TRIM(groupName)
+			FROM performances
+			WHERE TRIM(groupName) <> ''
+			GROUP BY TRIM(groupName) COLLATE NOCASE
+			ORDER BY MIN(id)`,
+		`UPDATE performances
+			SET groupId = (SELECT g.id FROM groups AS g WHERE g.name = TRIM(performances.groupName))
+			WHERE TRIM(groupName) <> ''`,
+		`UPDATE performances
+			SET groupName = (SELECT g.name FROM groups AS g WHERE g.id = performances.groupId)
+			WHERE groupId IS NOT NULL`,
+	}
+
+	for _, statement := range statements {
+		_, err := tx.Exec(statement)
+		if err != nil {
+			return err
+		}
+	}
+	return rebuildSearchIndex(tx)
+}
+
+func migrateGroupsDown(tx *sql.Tx) error {
+	statements := []string{
+		`ALTER TABLE junction DROP COLUMN groupId`,
+		`ALTER TABLE performances DROP COLUMN groupId`,
+		`DROP TABLE group_members`,
+		`DROP TABLE groups`,
+	}
+
+	for _, statement := range statements {
+		_, err := tx.Exec(statement)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 0016: what each performer does in a performance, e.g. vocals, drums or leading the act
+func migrateJunctionRolesUp(tx *sql.Tx) error {
+	statements := []string{
+		`ALTER TABLE junction ADD COLUMN role TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE junction ADD COLUMN instrument TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE junction ADD COLUMN notes TEXT NOT NULL DEFAULT ''`,
+	}
+
+	for _, statement := range statements {
+		_, err := tx.Exec(statement)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func migrateJunctionRolesDown(tx *sql.Tx) error {
+	statements := []string{
+		`ALTER TABLE junction DROP COLUMN notes`,
+		`ALTER TABLE junction DROP COLUMN instrument`,
+		`ALTER TABLE junction DROP COLUMN role`,
+	}
+
+	for _, statement := range statements {
+		_, err := tx.Exec(statement)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 0017: what each performance needs from the stage crew, kept out of performances as it's only
+// wanted by the crew
+func migrateRidersUp(tx *sql.Tx) error {
+	statements := []string{
+		`CREATE TABLE riders (
+			performanceId INTEGER PRIMARY KEY REFERENCES performances(id),
+			notes TEXT NOT NULL DEFAULT '',
+			updatedAt DATETIME NOT NULL
+		)`,
+		`CREATE TABLE rider_inputs (
+			performanceId INTEGER NOT NULL REFERENCES riders(performanceId),
+			channel INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			kind TEXT NOT NULL,
+			notes TEXT NOT NULL DEFAULT '',
+			PRIMARY KEY (performanceId, channel)
+		)`,
+		`CREATE TABLE rider_equipment (
+			performanceId INTEGER NOT NULL REFERENCES riders(performanceId),
+			position INTEGER NOT NULL,
+			item TEXT NOT NULL,
+			category TEXT NOT NULL,
+			quantity INTEGER NOT NULL DEFAULT 1,
+			providedBy TEXT NOT NULL DEFAULT 'festival',
+			notes TEXT NOT NULL DEFAULT '',
+			PRIMARY KEY (performanceId, position)
+		)`,
+		`CREATE TABLE rider_files (
+			performanceId INTEGER NOT NULL REFERENCES riders(performanceId),
+			position INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			url TEXT NOT NULL,
+			PRIMARY KEY (performanceId, position)
+		)`,
+	}
+
+	for _, statement := range statements {
+		_, err := tx.Exec(statement)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func migrateRidersDown(tx *sql.Tx) error {
+	statements := []string{
+		`DROP TABLE rider_files`,
+		`DROP TABLE rider_equipment`,
+		`DROP TABLE rider_inputs`,
+		`DROP TABLE riders`,
+	}
+
+	for _, statement := range statements {
+		_, err := tx.Exec(statement)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -3,46 +3,216 @@ package internal
 import (
 	"database/sql"
 	"errors"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 )
 
 type Performance struct {
-	Id        int       `json:"id"`
-	ItemName  string    `json:"itemName"`
-	GenreName string    `json:"genreName"`
-	GroupName string    `json:"groupName"`
-	Location  string    `json:"location"`
-	StartTime time.Time `json:"startTime"`
-	EndTime   time.Time `json:"endTime"`
-	Duration  int       `json:"duration"`
+	Id         int       `json:"id"`
+	ItemName   string    `json:"itemName"`
+	GenreName  string    `json:"genreName"`
+	GenreId    int       `json:"genreId"`
+	GroupName  string    `json:"groupName"`
+	GroupId    int       `json:"groupId"`
+	Location   string    `json:"location"`
+	LocationId int       `json:"locationId"`
+	StartTime  time.Time `json:"startTime"`
+	EndTime    time.Time `json:"endTime"`
+	// length in seconds. worked out from the times once both are set, but can be given on its
+	// own for performances that haven't been scheduled yet
+	Duration int `json:"duration"`
+	// when the performance was meant to happen before it was first delayed. zero if it never has been
+	PlannedStartTime time.Time `json:"plannedStartTime"`
+	PlannedEndTime   time.Time `json:"plannedEndTime"`
+	// when the performance really started and finished, stamped on the day. zero until it has
+	ActualStartTime time.Time `json:"actualStartTime"`
+	ActualEndTime   time.Time `json:"actualEndTime"`
+	// the festival edition the performance is part of. 0 if it isn't in one
+	EditionId int `json:"editionId"`
+	// bumped every time the performance changes
+	Version int `json:"version"`
 }
 
+// the columns scanPerformance expects, for queries that alias performances as p
+const performanceColumns = `p.id, p.itemName, p.genreName, COALESCE(p.genreId, 0), p.groupName, COALESCE(p.groupId, 0), p.location, COALESCE(p.locationId, 0), COALESCE(p.editionId, 0), p.startTime, p.endTime, p.duration, p.plannedStartTime, p.plannedEndTime, p.actualStartTime, p.actualEndTime, p.version`
+
 type Performer struct {
 	Id    int    `json:"id"`
 	Name  string `json:"name"`
 	Email string `json:"email"`
+	// bumped every time the performer changes
+	Version int `json:"version"`
+}
+
+// the columns scanPerformer expects, for queries that alias performers as p
+const performerColumns = `p.id, p.name, p.email, p.version`
+
+// a performer booked into a performance, along with what they do in it
+type BookedPerformer struct {
+	Performer
+	JunctionDetails
+	// the group they were booked in with. 0 if they were booked on their own
+	GroupId int `json:"groupId"`
 }
 
+// the columns scanJunction expects
+const junctionColumns = `performer_id, performance_id, attendance, checkedInAt, COALESCE(groupId, 0), role, instrument, notes`
+
+// returned when a change was based on an older version of a row than the one in the db
+var ErrVersionMismatch = errors.New("version does not match")
+
 // just a little wrapper so we can make actions methodic rather than functional
 type DBWrapper struct {
-	db *sql.DB
+	// either the *sql.DB itself or, inside InTransaction, the *sql.Tx
+	db dbConn
+	// the underlying database, used to begin transactions
+	conn *sql.DB
+	// minimum gap between two performances of the same performer
+	changeoverBuffer time.Duration
+	// who changes are recorded against in the audit log
+	actor string
+	// festival-specific limits performances are validated against
+	validationRules ValidationRules
+	// where committed changes are published for /events
+	events *EventBroker
+	// changes made inside the current transaction, published once it commits
+	pendingEvents *[]*ChangeEvent
+}
+
+// the query methods shared by *sql.DB and *sql.Tx
+type dbConn interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
 }
 
 func CreateDBWrapper(db *sql.DB) *DBWrapper {
-	return &DBWrapper{db}
+	return &DBWrapper{db: db, conn: db, events: newEventBroker()}
+}
+
+// runs fn against a wrapper bound to a single transaction, committing if fn succeeds and rolling back if it errors
+func (dbw *DBWrapper) InTransaction(fn func(tx *DBWrapper) error) error {
+	return dbw.inTransaction(fn, true)
+}
+
+// runs fn in a transaction that is only committed if commit is set, so passing false previews changes without making them
+func (dbw *DBWrapper) inTransaction(fn func(tx *DBWrapper) error, commit bool) error {
+	// already inside a transaction, so just join it
+	if _, ok := dbw.db.(*sql.Tx); ok {
+		return fn(dbw)
+	}
+
+	tx, err := dbw.conn.Begin()
+	if err != nil {
+		return err
+	}
+	// rollback is a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	txWrapper := *dbw
+	txWrapper.db = tx
+	pending := []*ChangeEvent{}
+	txWrapper.pendingEvents = &pending
+
+	err = fn(&txWrapper)
+	if err != nil {
+		return err
+	}
+
+	if !commit {
+		return nil
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	// only tell anyone about the changes once they've actually happened
+	for _, event := range pending {
+		dbw.events.publish(event)
+	}
+	return nil
 }
 
 // creates a performance and puts it into the db
 func (dbw *DBWrapper) CreatePerformance(p *Performance) (*Performance, error) {
-	dbQuery := `
-		INSERT INTO performances (itemName, genreName, groupName, location, startTime, endTime)
-		VALUES (?, ?, ?, ?, ?, ?)
-		RETURNING id
-	`
-	// the arguments after dbQuery get formatted into the ?s in the VALUES. this is an anti-injection measure
-	err := dbw.db.QueryRow(dbQuery, p.ItemName, p.GenreName, p.GroupName, p.Location, p.StartTime, p.EndTime).
-		Scan(&p.Id)
+	return dbw.createPerformance(p, false)
+}
+
+// creates a performance even if it clashes with another performance at the same location
+func (dbw *DBWrapper) ForceCreatePerformance(p *Performance) (*Performance, error) {
+	return dbw.createPerformance(p, true)
+}
+
+func (dbw *DBWrapper) createPerformance(p *Performance, force bool) (*Performance, error) {
+	normalisePerformanceTimes(p)
+
+	err := dbw.validatePerformance(p)
+	if err != nil {
+		return nil, err
+	}
+
+	err = dbw.InTransaction(func(tx *DBWrapper) error {
+		err := tx.resolveLocation(p)
+		if err != nil {
+			return err
+		}
+		err = tx.resolveGenre(p)
+		if err != nil {
+			return err
+		}
+		err = tx.resolveGroup(p)
+		if err != nil {
+			return err
+		}
+
+		current, err := tx.currentEditionId()
+		if err != nil {
+			return err
+		}
+		err = tx.resolveEdition(p, current)
+		if err != nil {
+			return err
+		}
+
+		if !force {
+			err = tx.checkLocationClashes(p)
+			if err != nil {
+				return err
+			}
+		}
+
+		dbQuery := `
+			INSERT INTO performances (itemName, genreName, genreId, groupName, groupId, location, locationId, editionId, startTime, endTime, duration, plannedStartTime, plannedEndTime, actualStartTime, actualEndTime)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			RETURNING id, version
+		`
+		// new performances haven't been delayed or performed yet
+		p.PlannedStartTime, p.PlannedEndTime = time.Time{}, time.Time{}
+		p.ActualStartTime, p.ActualEndTime = time.Time{}, time.Time{}
+		// the arguments after dbQuery get formatted into the ?s in the VALUES. this is an anti-injection measure
+		err = tx.db.QueryRow(dbQuery, p.ItemName, p.GenreName, nullableId(p.GenreId), p.GroupName, nullableId(p.GroupId), p.Location, nullableId(p.LocationId), nullableId(p.EditionId), p.StartTime, p.EndTime, p.Duration, p.PlannedStartTime, p.PlannedEndTime, p.ActualStartTime, p.ActualEndTime).
+			Scan(&p.Id, &p.Version)
+
+		if err != nil {
+			return err
+		}
 
+		err = tx.reindexPerformance(p.Id)
+		if err != nil {
+			return err
+		}
+
+		err = tx.audit(auditEntityPerformance, strconv.Itoa(p.Id), auditActionCreate, nil, p)
+		if err != nil {
+			return err
+		}
+
+		// a group's members are booked into its performances
+		return tx.syncGroupJunctions(p.Id)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -52,15 +222,32 @@ func (dbw *DBWrapper) CreatePerformance(p *Performance) (*Performance, error) {
 
 // creates a performer and puts it into the db
 func (dbw *DBWrapper) CreatePerformer(p *Performer) (*Performer, error) {
-	dbQuery := `
-		INSERT INTO performers (name, email)
-		VALUES (?, ?)
-		RETURNING id
-	`
+	err := validatePerformer(p)
+	if err != nil {
+		return nil, err
+	}
 
-	err := dbw.db.QueryRow(dbQuery, p.Name, p.Email).
-		Scan(&p.Id)
+	err = dbw.InTransaction(func(tx *DBWrapper) error {
+		dbQuery := `
+			INSERT INTO performers (name, email)
+			VALUES (?, ?)
+			RETURNING id, version
+		`
 
+		err := tx.db.QueryRow(dbQuery, p.Name, p.Email).
+			Scan(&p.Id, &p.Version)
+
+		if err != nil {
+			return err
+		}
+
+		err = tx.reindexPerformer(p.Id)
+		if err != nil {
+			return err
+		}
+
+		return tx.audit(auditEntityPerformer, strconv.Itoa(p.Id), auditActionCreate, nil, p)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -71,10 +258,10 @@ func (dbw *DBWrapper) CreatePerformer(p *Performer) (*Performer, error) {
 // returns a slice with all the performances in the db
 func (dbw *DBWrapper) GetAllPerformances() ([]*Performance, error) {
 	dbQuery := `
-		SELECT *
-		FROM performances
-		WHERE deleted = 0
-		ORDER BY id ASC
+		SELECT ` + performanceColumns + `
+		FROM performances AS p
+		WHERE p.deleted = 0
+		ORDER BY p.id ASC
 	`
 
 	rows, err := dbw.db.Query(dbQuery)
@@ -86,7 +273,7 @@ func (dbw *DBWrapper) GetAllPerformances() ([]*Performance, error) {
 	// seed performances
 	var performances []*Performance
 	for rows.Next() {
-		p, err := getNextPerformance(rows)
+		p, err := scanPerformance(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -99,20 +286,21 @@ func (dbw *DBWrapper) GetAllPerformances() ([]*Performance, error) {
 // returns a slice with all the performers in the db
 func (dbw *DBWrapper) GetAllPerformers() ([]*Performer, error) {
 	dbQuery := `
-		SELECT *
-		FROM performers
-		WHERE deleted = 0
-		ORDER BY id ASC
+		SELECT ` + performerColumns + `
+		FROM performers AS p
+		WHERE p.deleted = 0
+		ORDER BY p.id ASC
 	`
 
 	rows, err := dbw.db.Query(dbQuery)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	var performers []*Performer
 	for rows.Next() {
-		p, err := getNextPerformer(rows)
+		p, err := scanPerformer(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -122,10 +310,128 @@ func (dbw *DBWrapper) GetAllPerformers() ([]*Performer, error) {
 	return performers, nil
 }
 
+// the fields performances can be sorted by, and the columns they map to
+var performanceSortColumns = map[string]string{
+	"id":         "p.id",
+	"itemName":   "p.itemName",
+	"genreName":  "p.genreName",
+	"genreId":    "p.genreId",
+	"groupName":  "p.groupName",
+	"groupId":    "p.groupId",
+	"location":   "p.location",
+	"locationId": "p.locationId",
+	"editionId":  "p.editionId",
+	"startTime":  "p.startTime",
+	"endTime":    "p.endTime",
+	"duration":   "p.duration",
+}
+
+// the parameters performances can be filtered on, and the columns they map to
+var performanceFilterColumns = map[string]string{
+	"editionId": "p.editionId",
+	"itemName":  "p.itemName",
+	"genreName": "p.genreName",
+	"genreId":   "p.genreId",
+	"groupName": "p.groupName",
+	"groupId":   "p.groupId",
+	"location":  "p.location",
+}
+
+// returns one page of the performances matching the limit, cursor, sort and filter parameters
+func (dbw *DBWrapper) ListPerformances(params url.Values) ([]*Performance, *Pagination, error) {
+	q, err := parseListQuery(params, performanceSortColumns, "p.id")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = q.filterDeleted(params, "p.deleted")
+	if err != nil {
+		return nil, nil, err
+	}
+	q.filterEqual(params, performanceFilterColumns)
+	err = q.filterTimeRange(params, "p.startTime", "startTimeFrom", "startTimeTo")
+	if err != nil {
+		return nil, nil, err
+	}
+	err = q.filterIntRange(params, "p.duration", "durationMin", "durationMax")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	total := 0
+	err = dbw.db.QueryRow(`SELECT COUNT(*) FROM performances AS p`+q.whereSQL(), q.args...).Scan(&total)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pageClause, args := q.pageSQL()
+	rows, err := dbw.db.Query(`SELECT `+performanceColumns+` FROM performances AS p`+q.whereSQL()+pageClause, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	performances := []*Performance{}
+	for rows.Next() {
+		p, err := scanPerformance(rows)
+		if err != nil {
+			return nil, nil, err
+		}
+		performances = append(performances, p)
+	}
+
+	return performances, q.pagination(total), nil
+}
+
+// the fields performers can be sorted and filtered by, and the columns they map to
+var performerSortColumns = map[string]string{
+	"id":    "id",
+	"name":  "name",
+	"email": "email",
+}
+
+// returns one page of the performers matching the limit, cursor, sort and filter parameters
+func (dbw *DBWrapper) ListPerformers(params url.Values) ([]*Performer, *Pagination, error) {
+	q, err := parseListQuery(params, performerSortColumns, "id")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = q.filterDeleted(params, "deleted")
+	if err != nil {
+		return nil, nil, err
+	}
+	q.filterEqual(params, map[string]string{"name": "name", "email": "email"})
+
+	total := 0
+	err = dbw.db.QueryRow(`SELECT COUNT(*) FROM performers`+q.whereSQL(), q.args...).Scan(&total)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pageClause, args := q.pageSQL()
+	rows, err := dbw.db.Query(`SELECT `+performerColumns+` FROM performers AS p`+q.whereSQL()+pageClause, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	performers := []*Performer{}
+	for rows.Next() {
+		p, err := scanPerformer(rows)
+		if err != nil {
+			return nil, nil, err
+		}
+		performers = append(performers, p)
+	}
+
+	return performers, q.pagination(total), nil
+}
+
 // Returns all the performances associated with a particular performer
 func (dbw *DBWrapper) GetPerformancesByPerformerId(performerId int) ([]*Performance, error) {
 	dbQuery := `
-		SELECT id, itemName, genreName, groupName, location, startTime, endTime
+		SELECT ` + performanceColumns + `
 		FROM performances AS p
 		JOIN junction AS j ON p.id = j.performance_id
 		WHERE j.performer_id = ? AND p.deleted = 0
@@ -136,12 +442,11 @@ func (dbw *DBWrapper) GetPerformancesByPerformerId(performerId int) ([]*Performa
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	performances := []*Performance{}
 	for rows.Next() {
-		// scans the id of each performance
-		p := &Performance{}
-		err := rows.Scan(&p.Id, &p.ItemName, &p.GenreName, &p.GroupName, &p.Location, &p.StartTime, &p.EndTime)
+		p, err := scanPerformance(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -154,7 +459,7 @@ func (dbw *DBWrapper) GetPerformancesByPerformerId(performerId int) ([]*Performa
 // Returns all the performers associated with a particular performance
 func (dbw *DBWrapper) GetPerformersByPerformanceId(performanceId int) ([]*Performer, error) {
 	dbQuery := `
-		SELECT id, name, email
+		SELECT ` + performerColumns + `
 		FROM performers AS p
 		JOIN junction AS j ON p.id = j.performer_id
 		WHERE j.performance_id = ? AND p.deleted = 0
@@ -165,11 +470,11 @@ func (dbw *DBWrapper) GetPerformersByPerformanceId(performanceId int) ([]*Perfor
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	performers := []*Performer{}
 	for rows.Next() {
-		p := &Performer{}
-		err := rows.Scan(&p.Id, &p.Name, &p.Email)
+		p, err := scanPerformer(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -180,18 +485,45 @@ func (dbw *DBWrapper) GetPerformersByPerformanceId(performanceId int) ([]*Perfor
 	return performers, nil
 }
 
+// Returns the performers booked into the performance with the given id, with their roles
+func (dbw *DBWrapper) GetBookedPerformersByPerformanceId(performanceId int) ([]*BookedPerformer, error) {
+	dbQuery := `
+		SELECT ` + performerColumns + `, j.role, j.instrument, j.notes, COALESCE(j.groupId, 0)
+		FROM performers AS p
+		JOIN junction AS j ON p.id = j.performer_id
+		WHERE j.performance_id = ? AND p.deleted = 0
+		ORDER BY p.id ASC
+	`
+
+	rows, err := dbw.db.Query(dbQuery, performanceId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	performers := []*BookedPerformer{}
+	for rows.Next() {
+		b := &BookedPerformer{}
+		err := rows.Scan(&b.Id, &b.Name, &b.Email, &b.Version, &b.Role, &b.Instrument, &b.Notes, &b.GroupId)
+		if err != nil {
+			return nil, err
+		}
+
+		performers = append(performers, b)
+	}
+
+	return performers, nil
+}
+
 // Return the performance with the given id
 func (dbw *DBWrapper) GetPerformanceById(id int) (*Performance, error) {
 	dbQuery := `
-		SELECT *
-		FROM performances
-		WHERE id = ? AND deleted = 0
+		SELECT ` + performanceColumns + `
+		FROM performances AS p
+		WHERE p.id = ? AND p.deleted = 0
 	`
 
-	deleted := 0
-	p := &Performance{}
-	err := dbw.db.QueryRow(dbQuery, id).
-		Scan(&p.Id, &p.ItemName, &p.GenreName, &p.GroupName, &p.Location, &p.StartTime, &p.EndTime, &deleted)
+	p, err := scanPerformance(dbw.db.QueryRow(dbQuery, id))
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -204,15 +536,12 @@ func (dbw *DBWrapper) GetPerformanceById(id int) (*Performance, error) {
 // Return the performer with the given id
 func (dbw *DBWrapper) GetPerformerById(id int) (*Performer, error) {
 	dbQuery := `
-		SELECT *
-		FROM performers
-		WHERE id = ? AND deleted = 0
+		SELECT ` + performerColumns + `
+		FROM performers AS p
+		WHERE p.id = ? AND p.deleted = 0
 	`
 
-	deleted := 0
-	p := &Performer{}
-	err := dbw.db.QueryRow(dbQuery, id).
-		Scan(&p.Id, &p.Name, &p.Email, &deleted)
+	p, err := scanPerformer(dbw.db.QueryRow(dbQuery, id))
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -222,112 +551,419 @@ func (dbw *DBWrapper) GetPerformerById(id int) (*Performer, error) {
 	return p, nil
 }
 
-// TODO: change from just delete to archive
-// Deletes the performance with the given id
+// Archives the performance with the given id. it stays in the db so it can be restored
 func (dbw *DBWrapper) DeletePerformanceById(id int) error {
-	dbQuery := `
-		UPDATE performances
-		SET deleted = 1
-		WHERE id = ?
-	`
-	_, err := dbw.db.Exec(dbQuery, id)
-	if err != nil {
-		return err
-	}
-	return nil
+	return dbw.deletePerformanceById(id, anyVersion)
 }
 
-// TODO: change from just delete to archive
-// Deletes the performer with the given id
+// Archives the performance only if it's still at the given version, returning ErrVersionMismatch if it isn't
+func (dbw *DBWrapper) DeletePerformanceByIdIfVersion(id, version int) error {
+	return dbw.deletePerformanceById(id, version)
+}
+
+// anyVersion deletes whatever version the performance is at
+func (dbw *DBWrapper) deletePerformanceById(id, version int) error {
+	return dbw.InTransaction(func(tx *DBWrapper) error {
+		before, err := tx.GetPerformanceById(id)
+		if err != nil {
+			return err
+		}
+		if version != anyVersion {
+			if before == nil {
+				return sql.ErrNoRows
+			}
+			if before.Version != version {
+				return ErrVersionMismatch
+			}
+		}
+
+		dbQuery := `
+			UPDATE performances
+			SET deleted = 1, version = version + 1
+			WHERE id = ? AND deleted = 0
+		`
+		_, err = tx.db.Exec(dbQuery, id)
+		if err != nil {
+			return err
+		}
+
+		err = tx.reindexPerformance(id)
+		if err != nil {
+			return err
+		}
+
+		// deleting something that's already gone doesn't change anything
+		if before == nil {
+			return nil
+		}
+		return tx.audit(auditEntityPerformance, strconv.Itoa(id), auditActionDelete, before, nil)
+	})
+}
+
+// Archives the performer with the given id. they stay in the db so they can be restored
 func (dbw *DBWrapper) DeletePerformerById(id int) error {
-	dbQuery := `
-		UPDATE performers
-		SET deleted = 1
-		WHERE id = ?
-	`
-	_, err := dbw.db.Exec(dbQuery, id)
-	if err != nil {
-		return err
-	}
-	return nil
+	return dbw.deletePerformerById(id, anyVersion)
+}
+
+// Archives the performer only if it's still at the given version, returning ErrVersionMismatch if it isn't
+func (dbw *DBWrapper) DeletePerformerByIdIfVersion(id, version int) error {
+	return dbw.deletePerformerById(id, version)
 }
 
-// Updates the performance with the given id to have the details of the given performance
+// anyVersion deletes whatever version the performer is at
+func (dbw *DBWrapper) deletePerformerById(id, version int) error {
+	return dbw.InTransaction(func(tx *DBWrapper) error {
+		before, err := tx.GetPerformerById(id)
+		if err != nil {
+			return err
+		}
+		if version != anyVersion {
+			if before == nil {
+				return sql.ErrNoRows
+			}
+			if before.Version != version {
+				return ErrVersionMismatch
+			}
+		}
+
+		dbQuery := `
+			UPDATE performers
+			SET deleted = 1, version = version + 1
+			WHERE id = ? AND deleted = 0
+		`
+		_, err = tx.db.Exec(dbQuery, id)
+		if err != nil {
+			return err
+		}
+
+		err = tx.reindexPerformer(id)
+		if err != nil {
+			return err
+		}
+
+		// deleting something that's already gone doesn't change anything
+		if before == nil {
+			return nil
+		}
+		return tx.audit(auditEntityPerformer, strconv.Itoa(id), auditActionDelete, before, nil)
+	})
+}
+
+// Updates the performance with the given id to have the details of the given performance. if p
+// has a version, the update only goes ahead if the performance is still at it
 func (dbw *DBWrapper) UpdatePerformanceById(id int, p *Performance) error {
-	dbQuery := `
-		UPDATE performances
-		SET itemName = ?, genreName = ?, groupName = ?, location = ?, startTime = ?, endTime = ?
-		WHERE id = ? AND deleted = 0
-	`
+	return dbw.updatePerformanceById(id, p, false)
+}
+
+// Updates the performance even if it then clashes with another performance at the same location
+func (dbw *DBWrapper) ForceUpdatePerformanceById(id int, p *Performance) error {
+	return dbw.updatePerformanceById(id, p, true)
+}
+
+func (dbw *DBWrapper) updatePerformanceById(id int, p *Performance, force bool) error {
+	normalisePerformanceTimes(p)
 
-	result, err := dbw.db.Exec(dbQuery, p.ItemName, p.GenreName, p.GroupName, p.Location, p.StartTime, p.EndTime, id)
+	err := dbw.validatePerformance(p)
 	if err != nil {
 		return err
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	return dbw.InTransaction(func(tx *DBWrapper) error {
+		before, err := tx.GetPerformanceById(id)
+		if err != nil {
+			return err
+		}
+		if before == nil {
+			return sql.ErrNoRows
+		}
+		// anyVersion updates whatever version the performance is at
+		if p.Version != anyVersion && p.Version != before.Version {
+			return ErrVersionMismatch
+		}
+
+		err = tx.resolveLocation(p)
+		if err != nil {
+			return err
+		}
+		err = tx.resolveGenre(p)
+		if err != nil {
+			return err
+		}
+		err = tx.resolveGroup(p)
+		if err != nil {
+			return err
+		}
+
+		// performances stay in their edition unless they're moved to another
+		err = tx.resolveEdition(p, before.EditionId)
+		if err != nil {
+			return err
+		}
+
+		candidate := *p
+		candidate.Id = id
+		if !force {
+			err = tx.checkLocationClashes(&candidate)
+			if err != nil {
+				return err
+			}
+		}
+
+		// moving the performance mustn't double-book anyone already in it
+		err = tx.checkPerformanceConflicts(id, p)
+		if err != nil {
+			return err
+		}
+
+		dbQuery := `
+			UPDATE performances
+			SET itemName = ?, genreName = ?, genreId = ?, groupName = ?, groupId = ?, location = ?, locationId = ?, editionId = ?, startTime = ?, endTime = ?, duration = ?, version = version + 1
+			WHERE id = ? AND deleted = 0
+		`
+
+		result, err := tx.db.Exec(dbQuery, p.ItemName, p.GenreName, nullableId(p.GenreId), p.GroupName, nullableId(p.GroupId), p.Location, nullableId(p.LocationId), nullableId(p.EditionId), p.StartTime, p.EndTime, p.Duration, id)
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		// error if no matching rows were found and updated
+		if rowsAffected == 0 {
+			return sql.ErrNoRows
+		}
+
+		err = tx.reindexPerformance(id)
+		if err != nil {
+			return err
+		}
+
+		after, err := tx.GetPerformanceById(id)
+		if err != nil {
+			return err
+		}
+		p.Version = after.Version
+		// updates don't change the delay or check-in times, so hand back the ones that were kept
+		p.PlannedStartTime, p.PlannedEndTime = after.PlannedStartTime, after.PlannedEndTime
+		p.ActualStartTime, p.ActualEndTime = after.ActualStartTime, after.ActualEndTime
+		err = tx.audit(auditEntityPerformance, strconv.Itoa(id), auditActionUpdate, before, after)
+		if err != nil {
+			return err
+		}
+
+		// changing the group swaps its members for the new group's
+		return tx.syncGroupJunctions(id)
+	})
+}
+
+// Updates the performer with the given id to have the details of the given performer. if p has
+// a version, the update only goes ahead if the performer is still at it
+func (dbw *DBWrapper) UpdatePerformerById(id int, p *Performer) error {
+	err := validatePerformer(p)
 	if err != nil {
 		return err
 	}
 
-	// error if no matching rows were found and updated
-	if rowsAffected == 0 {
-		return sql.ErrNoRows
-	}
+	return dbw.InTransaction(func(tx *DBWrapper) error {
+		before, err := tx.GetPerformerById(id)
+		if err != nil {
+			return err
+		}
+		if p.Version != anyVersion {
+			if before == nil {
+				return sql.ErrNoRows
+			}
+			if p.Version != before.Version {
+				return ErrVersionMismatch
+			}
+		}
 
-	return nil
+		dbQuery := `
+			UPDATE performers
+			SET name = ?, email = ?, version = version + 1
+			WHERE id = ?
+		`
+
+		result, err := tx.db.Exec(dbQuery, p.Name, p.Email, id)
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		// error if no matching rows were found and updated
+		if rowsAffected == 0 {
+			return sql.ErrNoRows
+		}
+
+		err = tx.reindexPerformer(id)
+		if err != nil {
+			return err
+		}
+
+		after, err := tx.GetPerformerById(id)
+		if err != nil {
+			return err
+		}
+		if after != nil {
+			p.Version = after.Version
+		}
+		return tx.audit(auditEntityPerformer, strconv.Itoa(id), auditActionUpdate, before, after)
+	})
 }
 
-// Updates the performer with the given id to have the details of the given performer
-func (dbw *DBWrapper) UpdatePerformerById(id int, p *Performer) error {
-	dbQuery := `
-		UPDATE performers
-		SET name = ?, email = ?
-		WHERE id = ?
-	`
+// returns the performerId:performanceId pair, or nil if they aren't linked
+func (dbw *DBWrapper) GetJunction(performerId, performanceId int) (*ExportedJunction, error) {
+	dbQuery := `SELECT ` + junctionColumns + ` FROM junction WHERE performer_id = ? AND performance_id = ?`
 
-	result, err := dbw.db.Exec(dbQuery, p.Name, p.Email, id)
-	if err != nil {
-		return err
+	j, err := scanJunction(dbw.db.QueryRow(dbQuery, performerId, performanceId))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
 	}
+	return j, nil
+}
 
-	rowsAffected, err := result.RowsAffected()
+// returns the junctions whose column matches id, e.g. every junction of a performance
+func (dbw *DBWrapper) getJunctions(column string, id int) ([]*ExportedJunction, error) {
+	rows, err := dbw.db.Query(`SELECT `+junctionColumns+` FROM junction WHERE `+column+` = ? ORDER BY performer_id ASC, performance_id ASC`, id)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer rows.Close()
 
-	// error if no matching rows were found and updated
-	if rowsAffected == 0 {
-		return sql.ErrNoRows
+	junctions := []*ExportedJunction{}
+	for rows.Next() {
+		j, err := scanJunction(rows)
+		if err != nil {
+			return nil, err
+		}
+		junctions = append(junctions, j)
 	}
-
-	return nil
+	return junctions, rows.Err()
 }
 
 // creates a performer:performance relationship
 func (dbw *DBWrapper) CreateJunction(performerId, performanceId int) error {
-	dbQuery := `
-		INSERT INTO junction (performer_id, performance_id)
-		VALUES (?, ?)
-	`
+	_, err := dbw.CreateJunctionWithDetails(performerId, performanceId, &JunctionDetails{})
+	return err
+}
 
-	_, err := dbw.db.Exec(dbQuery, performerId, performanceId)
+// creates a performer:performance relationship, saying what the performer does in it
+func (dbw *DBWrapper) CreateJunctionWithDetails(performerId, performanceId int, details *JunctionDetails) (*ExportedJunction, error) {
+	normaliseJunctionDetails(details)
+	err := validateJunctionDetails(details)
 	if err != nil {
-		return errors.New("error creating junction")
+		return nil, err
 	}
-	return nil
+
+	junction := &ExportedJunction{PerformerId: performerId, PerformanceId: performanceId, JunctionDetails: *details}
+	err = dbw.InTransaction(func(tx *DBWrapper) error {
+		performance, err := tx.GetPerformanceById(performanceId)
+		if err != nil {
+			return err
+		}
+
+		// refuse to book the performer into something that overlaps their other performances.
+		// checked in the same transaction as the insert, so two bookings can't both get through
+		if performance != nil {
+			conflicts, err := tx.FindPerformerConflicts(performerId, performance)
+			if err != nil {
+				return err
+			}
+			if len(conflicts) > 0 {
+				return &ConflictError{Conflicts: conflicts}
+			}
+		}
+
+		dbQuery := `
+			INSERT INTO junction (performer_id, performance_id, role, instrument, notes)
+			VALUES (?, ?, ?, ?, ?)
+		`
+
+		_, err = tx.db.Exec(dbQuery, performerId, performanceId, details.Role, details.Instrument, details.Notes)
+		if err != nil {
+			return errors.New("error creating junction")
+		}
+
+		return tx.audit(auditEntityJunction, junctionAuditId(performerId, performanceId), auditActionCreate, nil, junction)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return junction, nil
 }
 
-// deletes the performerId:performanceId pair
-func (dbw *DBWrapper) DeleteJunction(performerId, performanceId int) error {
-	dbQuery := `
-		DELETE FROM junction WHERE performer_id = ? AND performance_id = ?;
-	`
-	_, err := dbw.db.Exec(dbQuery, performerId, performanceId)
+// changes what the performer does in the performance. returns sql.ErrNoRows if the performer
+// isn't booked for it
+func (dbw *DBWrapper) UpdateJunction(performerId, performanceId int, details *JunctionDetails) (*ExportedJunction, error) {
+	normaliseJunctionDetails(details)
+	err := validateJunctionDetails(details)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+
+	var after *ExportedJunction
+	err = dbw.InTransaction(func(tx *DBWrapper) error {
+		before, err := tx.GetJunction(performerId, performanceId)
+		if err != nil {
+			return err
+		}
+		if before == nil {
+			return sql.ErrNoRows
+		}
+
+		j := *before
+		j.JunctionDetails = *details
+
+		_, err = tx.db.Exec(`UPDATE junction SET role = ?, instrument = ?, notes = ? WHERE performer_id = ? AND performance_id = ?`,
+			j.Role, j.Instrument, j.Notes, performerId, performanceId)
+		if err != nil {
+			return err
+		}
+
+		after = &j
+		return tx.audit(auditEntityJunction, junctionAuditId(performerId, performanceId), auditActionUpdate, before, after)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return after, nil
+}
+
+// trims the details so blank ones are stored as blank
+func normaliseJunctionDetails(d *JunctionDetails) {
+	d.Role = strings.TrimSpace(d.Role)
+	d.Instrument = strings.TrimSpace(d.Instrument)
+	d.Notes = strings.TrimSpace(d.Notes)
+}
+
+// deletes the performerId:performanceId pair
+func (dbw *DBWrapper) DeleteJunction(performerId, performanceId int) error {
+	return dbw.InTransaction(func(tx *DBWrapper) error {
+		// deleting a pair that doesn't exist doesn't change anything
+		junction, err := tx.GetJunction(performerId, performanceId)
+		if err != nil || junction == nil {
+			return err
+		}
+
+		dbQuery := `
+			DELETE FROM junction WHERE performer_id = ? AND performance_id = ?;
+		`
+		_, err = tx.db.Exec(dbQuery, performerId, performanceId)
+		if err != nil {
+			return err
+		}
+
+		return tx.audit(auditEntityJunction, junctionAuditId(performerId, performanceId), auditActionDelete, junction, nil)
+	})
 }
 
 /*
@@ -338,33 +974,99 @@ func (dbw *DBWrapper) DeleteJunction(performerId, performanceId int) error {
 
  */
 
-// gets the head of rows and returns it as a Performance
-func getNextPerformance(rows *sql.Rows) (*Performance, error) {
+// anything that can be scanned, so a *sql.Row and *sql.Rows can share the same scanning code
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scans a row selected with performanceColumns into a Performance
+func scanPerformance(row rowScanner) (*Performance, error) {
 	p := &Performance{}
-	deleted := 0
-	err := rows.Scan(&p.Id, &p.ItemName, &p.GenreName, &p.GroupName, &p.Location, &p.StartTime, &p.EndTime, &deleted)
+	err := row.Scan(&p.Id, &p.ItemName, &p.GenreName, &p.GenreId, &p.GroupName, &p.GroupId, &p.Location, &p.LocationId, &p.EditionId, &p.StartTime, &p.EndTime, &p.Duration, &p.PlannedStartTime, &p.PlannedEndTime, &p.ActualStartTime, &p.ActualEndTime, &p.Version)
 	if err != nil {
 		return nil, err
 	}
 	return p, nil
 }
 
-// gets the head of rows and returns it as a Performer
-func getNextPerformer(rows *sql.Rows) (*Performer, error) {
+// scans a row selected with performerColumns into a Performer
+func scanPerformer(row rowScanner) (*Performer, error) {
 	p := &Performer{}
-	deleted := 0
-	err := rows.Scan(&p.Id, &p.Name, &p.Email, &deleted)
+	err := row.Scan(&p.Id, &p.Name, &p.Email, &p.Version)
 	if err != nil {
 		return nil, err
 	}
 	return p, nil
 }
 
-// validates the contents of a performance and returns its validity
-func validatePerformance(p *Performance) bool {
-	if len([]rune(p.ItemName)) < 2 || len([]rune(p.ItemName)) > 32 {
-		return false
+// scans a row selected with junctionColumns into an ExportedJunction
+func scanJunction(row rowScanner) (*ExportedJunction, error) {
+	j := &ExportedJunction{}
+	var checkedInAt sql.NullTime
+	err := row.Scan(&j.PerformerId, &j.PerformanceId, &j.Attendance, &checkedInAt, &j.GroupId, &j.Role, &j.Instrument, &j.Notes)
+	if err != nil {
+		return nil, err
 	}
-	return true
-	// TODO: this
+	j.CheckedInAt = checkedInAt.Time.UTC()
+	return j, nil
+}
+
+// times are stored in UTC so that they sort and compare correctly as text inside sqlite.
+// a start time and duration without an end time are taken to mean the performance ends that
+// long after it starts, and once both times are set the duration always follows from them
+func normalisePerformanceTimes(p *Performance) {
+	p.StartTime = p.StartTime.UTC()
+	p.EndTime = p.EndTime.UTC()
+	p.PlannedStartTime = p.PlannedStartTime.UTC()
+	p.PlannedEndTime = p.PlannedEndTime.UTC()
+	p.ActualStartTime = p.ActualStartTime.UTC()
+	p.ActualEndTime = p.ActualEndTime.UTC()
+
+	if !p.StartTime.IsZero() && p.EndTime.IsZero() && p.Duration > 0 {
+		p.EndTime = p.StartTime.Add(time.Duration(p.Duration) * time.Second)
+	}
+	if isScheduled(p) {
+		p.Duration = int(p.EndTime.Sub(p.StartTime) / time.Second)
+	}
+}
+
+// ids of 0 mean "not set", which is stored as NULL
+func nullableId(id int) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+// zero times mean "not set", which is stored as NULL
+func nullableTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC()
+}
+
+// returns a ConflictError if giving performance id the times in p would double-book any of its performers
+func (dbw *DBWrapper) checkPerformanceConflicts(id int, p *Performance) error {
+	performers, err := dbw.GetPerformersByPerformanceId(id)
+	if err != nil {
+		return err
+	}
+
+	candidate := *p
+	candidate.Id = id
+
+	conflicts := []*Conflict{}
+	for _, performer := range performers {
+		found, err := dbw.FindPerformerConflicts(performer.Id, &candidate)
+		if err != nil {
+			return err
+		}
+		conflicts = append(conflicts, found...)
+	}
+
+	if len(conflicts) > 0 {
+		return &ConflictError{Conflicts: conflicts}
+	}
+	return nil
 }
@@ -3,6 +3,7 @@ package internal_test
 import (
 	internal "foc_api/internal"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -27,6 +28,19 @@ func getTestPerformance() *internal.Performance {
 	return testPerformance
 }
 
+// creates a performance at location running from start for length. a zero start leaves it
+// unscheduled, with just the length
+func createTestPerformance(t *testing.T, dbw *internal.DBWrapper, name, location string, start time.Time, length time.Duration) *internal.Performance {
+	p := &internal.Performance{ItemName: name, Location: location, StartTime: start, Duration: int(length / time.Second)}
+	if !start.IsZero() {
+		p.EndTime = start.Add(length)
+	}
+
+	p, err := dbw.CreatePerformance(p)
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+	return p
+}
+
 func getTestPerformer() *internal.Performer {
 	return &internal.Performer{
 		Name:  "FirstName, LastName",
@@ -420,3 +434,71 @@ func TestUpdatePerformerById(t *testing.T) {
 	assert.Equal(t, expected.Email, actual.Email, "Expected and Actual email are different")
 
 }
+
+func TestCreatePerformanceDerivesDuration(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	start := time.Date(2025, 9, 1, 18, 0, 0, 0, time.UTC)
+	fromTimes := &internal.Performance{ItemName: "From Times", StartTime: start, EndTime: start.Add(5 * time.Minute)}
+	fromDuration := &internal.Performance{ItemName: "From Duration", StartTime: start, Duration: 90}
+	unscheduled := &internal.Performance{ItemName: "Unscheduled", Duration: 240}
+
+	// act
+	for _, p := range []*internal.Performance{fromTimes, fromDuration, unscheduled} {
+		_, err := dbw.CreatePerformance(p)
+		require.NoError(t, err, "CreatePerformance() failed: %v", err)
+	}
+
+	// assert
+	stored, err := dbw.GetPerformanceById(fromTimes.Id)
+	require.NoError(t, err, "GetPerformanceById() failed: %v", err)
+	assert.Equal(t, 300, stored.Duration, "Duration should be worked out from the times")
+
+	stored, err = dbw.GetPerformanceById(fromDuration.Id)
+	require.NoError(t, err, "GetPerformanceById() failed: %v", err)
+	assert.True(t, start.Add(90*time.Second).Equal(stored.EndTime), "End time should be worked out from the duration")
+
+	stored, err = dbw.GetPerformanceById(unscheduled.Id)
+	require.NoError(t, err, "GetPerformanceById() failed: %v", err)
+	assert.Equal(t, 240, stored.Duration, "Unscheduled performances should keep their duration")
+	assert.True(t, stored.EndTime.IsZero(), "Unscheduled performances should stay unscheduled")
+}
+
+func TestUpdateJunction(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	performer, err := dbw.CreatePerformer(getTestPerformer())
+	require.NoError(t, err, "CreatePerformer() failed: %v", err)
+	performance, err := dbw.CreatePerformance(getTestPerformance())
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+	_, err = dbw.CreateJunctionWithDetails(performer.Id, performance.Id, &internal.JunctionDetails{Role: " leader ", Instrument: "Guitar"})
+	require.NoError(t, err, "CreateJunctionWithDetails() failed: %v", err)
+
+	// act
+	updated, err := dbw.UpdateJunction(performer.Id, performance.Id, &internal.JunctionDetails{Role: "leader", Instrument: "Drums", Notes: "Brings own kit"})
+	require.NoError(t, err, "UpdateJunction() failed: %v", err)
+	_, missingErr := dbw.UpdateJunction(performer.Id, performance.Id+1, &internal.JunctionDetails{Role: "leader"})
+	_, invalidErr := dbw.UpdateJunction(performer.Id, performance.Id, &internal.JunctionDetails{Role: strings.Repeat("a", 65)})
+
+	// assert
+	stored, err := dbw.GetJunction(performer.Id, performance.Id)
+	require.NoError(t, err, "GetJunction() failed: %v", err)
+	assert.Equal(t, updated, stored)
+	assert.Equal(t, "Drums", stored.Instrument)
+	assert.Equal(t, "Brings own kit", stored.Notes)
+
+	booked, err := dbw.GetBookedPerformersByPerformanceId(performance.Id)
+	require.NoError(t, err, "GetBookedPerformersByPerformanceId() failed: %v", err)
+	require.Len(t, booked, 1)
+	assert.Equal(t, *performer, booked[0].Performer)
+	assert.Equal(t, "leader", booked[0].Role)
+
+	assert.Error(t, missingErr, "Updating a performer who isn't booked should fail")
+	assert.IsType(t, &internal.ValidationError{}, invalidErr)
+}
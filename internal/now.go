@@ -0,0 +1,118 @@
+package internal
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+)
+
+// what's on at a location right now, and what's on after it
+type NowPlaying struct {
+	LocationId int          `json:"locationId"`
+	Location   string       `json:"location"`
+	Current    *Performance `json:"current"`
+	Next       *Performance `json:"next"`
+}
+
+// returns what's on at every location at the given time. a location with nothing on has a nil
+// current, and one with nothing left to come has a nil next
+func (dbw *DBWrapper) GetNowPlaying(at time.Time) ([]*NowPlaying, error) {
+	at = at.UTC()
+
+	locations, err := dbw.GetAllLocations()
+	if err != nil {
+		return nil, err
+	}
+
+	playing := []*NowPlaying{}
+	for _, l := range locations {
+		entry := &NowPlaying{LocationId: l.Id, Location: l.Name}
+
+		// if performances were forced into the same slot, the one that started first is shown
+		entry.Current, err = dbw.findPerformance(`p.locationId = ? AND p.startTime <= ? AND p.endTime > ?`, `p.startTime ASC`, l.Id, at, at)
+		if err != nil {
+			return nil, err
+		}
+		entry.Next, err = dbw.findPerformance(`p.locationId = ? AND p.startTime > ?`, `p.startTime ASC`, l.Id, at)
+		if err != nil {
+			return nil, err
+		}
+
+		playing = append(playing, entry)
+	}
+
+	return playing, nil
+}
+
+// returns the next time after at that any performance starts or ends, or the zero time if
+// nothing else is going to happen
+func (dbw *DBWrapper) nextSlotChange(at time.Time) (time.Time, error) {
+	at = at.UTC()
+
+	starting, err := dbw.findPerformance(`p.startTime > ?`, `p.startTime ASC`, at)
+	if err != nil {
+		return time.Time{}, err
+	}
+	ending, err := dbw.findPerformance(`p.endTime > ?`, `p.endTime ASC`, at)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	next := time.Time{}
+	if starting != nil {
+		next = starting.StartTime
+	}
+	if ending != nil && (next.IsZero() || ending.EndTime.Before(next)) {
+		next = ending.EndTime
+	}
+	return next, nil
+}
+
+// returns the first performance that isn't deleted and meets condition, in the given order
+func (dbw *DBWrapper) findPerformance(condition, orderBy string, args ...interface{}) (*Performance, error) {
+	dbQuery := `
+		SELECT ` + performanceColumns + `
+		FROM performances AS p
+		WHERE p.deleted = 0 AND ` + condition + `
+		ORDER BY ` + orderBy + `, p.id ASC
+		LIMIT 1
+	`
+
+	p, err := scanPerformance(dbw.db.QueryRow(dbQuery, args...))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Handles requests for what's on now
+func (api *API) NowHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		api.GetNowPlaying(w, r)
+	}
+}
+
+// GET /now - returns the current and next performance at every location. ?at= shows what was or
+// will be on at another time instead
+func (api *API) GetNowPlaying(w http.ResponseWriter, r *http.Request) {
+	at := time.Now()
+	if value := r.URL.Query().Get("at"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			api.respondError(w, http.StatusBadRequest, "at must be a time like 2025-09-01T18:00:00Z")
+			return
+		}
+		at = parsed
+	}
+
+	playing, err := api.wrapper.GetNowPlaying(at)
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Unable to find what's on")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, map[string]interface{}{"at": at.UTC(), "locations": playing})
+}
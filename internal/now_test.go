@@ -0,0 +1,69 @@
+package internal_test
+
+import (
+	"encoding/json"
+	internal "foc_api/internal"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetNowPlayingShowsCurrentAndNext(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	start := time.Date(2025, 9, 1, 18, 0, 0, 0, time.UTC)
+	first := createTestPerformance(t, dbw, "Take Five", "Take Five Stage", start, 10*time.Minute)
+	second, err := dbw.CreatePerformance(&internal.Performance{ItemName: "Clair de Lune", Location: first.Location, StartTime: start.Add(15 * time.Minute), EndTime: start.Add(20 * time.Minute)})
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+
+	// act
+	during, err := dbw.GetNowPlaying(start.Add(5 * time.Minute))
+	require.NoError(t, err, "GetNowPlaying() failed: %v", err)
+
+	between, err := dbw.GetNowPlaying(start.Add(12 * time.Minute))
+	require.NoError(t, err, "GetNowPlaying() failed: %v", err)
+
+	// assert
+	require.Len(t, during, 1)
+	assert.Equal(t, first, during[0].Current)
+	assert.Equal(t, second, during[0].Next)
+
+	require.Len(t, between, 1)
+	assert.Nil(t, between[0].Current, "Nothing should be on during the changeover")
+	assert.Equal(t, second, between[0].Next)
+}
+
+func TestGetNowPlayingEndpointAcceptsTime(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+	api := internal.NewAPI(dbw)
+
+	start := time.Date(2025, 9, 1, 18, 0, 0, 0, time.UTC)
+	performance := createTestPerformance(t, dbw, "Take Five", "Take Five Stage", start, 10*time.Minute)
+
+	r := httptest.NewRequest("GET", "/now?at=2025-09-01T18:05:00Z", nil)
+	w := httptest.NewRecorder()
+
+	// act
+	api.NowHandler(w, r)
+
+	// assert
+	require.Equal(t, http.StatusOK, w.Code, "NowHandler() returned status %v", w.Code)
+
+	var body struct {
+		Locations []*internal.NowPlaying `json:"locations"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&body), "Error decoding response from endpoint")
+	require.Len(t, body.Locations, 1)
+	require.NotNil(t, body.Locations[0].Current)
+	assert.Equal(t, performance.Id, body.Locations[0].Current.Id)
+}
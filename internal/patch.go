@@ -0,0 +1,223 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+)
+
+const mergePatchContentType = "application/merge-patch+json"
+
+// applies an RFC 7396 merge patch to target, where both are decoded json. objects are merged
+// key by key, a null removes a key, and anything else replaces what was there
+func mergePatch(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = mergePatch(targetObject[key], value)
+	}
+	return targetObject
+}
+
+// applies the merge patch in body to current and decodes the result into patched. returns the
+// patch itself so callers can see which fields it touched
+func applyMergePatch(current interface{}, body []byte, patched interface{}) (map[string]interface{}, error) {
+	var patch map[string]interface{}
+	err := decodeJSONNumbers(body, &patch)
+	if err != nil || patch == nil {
+		return nil, errors.New("patch must be a JSON object")
+	}
+
+	encoded, err := json.Marshal(current)
+	if err != nil {
+		return nil, err
+	}
+	var target interface{}
+	err = decodeJSONNumbers(encoded, &target)
+	if err != nil {
+		return nil, err
+	}
+
+	merged, err := json.Marshal(mergePatch(target, patch))
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(merged, patched)
+	if err != nil {
+		return nil, errors.New("patch does not fit the resource: " + err.Error())
+	}
+	return patch, nil
+}
+
+// decodes json keeping numbers exactly as they were written
+func decodeJSONNumbers(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// reads a merge patch from the request body. responds with an error and returns false if the
+// body isn't one
+func (api *API) readMergePatch(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || (mediaType != mergePatchContentType && mediaType != "application/json") {
+			api.respondError(w, http.StatusUnsupportedMediaType, "PATCH bodies must be "+mergePatchContentType)
+			return nil, false
+		}
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Unable to read body")
+		return nil, false
+	}
+	return body, true
+}
+
+// PATCH /performances/:id - changes only the fields in the merge patch, leaving the rest as they are
+func (api *API) PatchPerformance(w http.ResponseWriter, r *http.Request) {
+	id, err := api.extractId(r.URL.Path)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid ID provided")
+		return
+	}
+
+	version, ok := api.requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+
+	body, ok := api.readMergePatch(w, r)
+	if !ok {
+		return
+	}
+
+	current, err := api.wrapper.GetPerformanceById(id)
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Unable to find performance")
+		return
+	}
+	if current == nil {
+		api.respondError(w, http.StatusNotFound, "Performance Not Found")
+		return
+	}
+	if version != anyVersion && version != current.Version {
+		api.respondIfVersionMismatch(w, ErrVersionMismatch)
+		return
+	}
+
+	var performance Performance
+	patch, err := applyMergePatch(current, body, &performance)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// location and locationId describe the same thing, so changing one means the other is
+	// worked out again from it rather than kept
+	_, patchedLocation := patch["location"]
+	_, patchedLocationId := patch["locationId"]
+	if patchedLocation && !patchedLocationId {
+		performance.LocationId = 0
+	} else if patchedLocationId && !patchedLocation {
+		performance.Location = ""
+	}
+
+	// and so do genreName and genreId, and groupName and groupId
+	_, patchedGenre := patch["genreName"]
+	_, patchedGenreId := patch["genreId"]
+	if patchedGenre && !patchedGenreId {
+		performance.GenreId = 0
+	} else if patchedGenreId && !patchedGenre {
+		performance.GenreName = ""
+	}
+	_, patchedGroup := patch["groupName"]
+	_, patchedGroupId := patch["groupId"]
+	if patchedGroup && !patchedGroupId {
+		performance.GroupId = 0
+	} else if patchedGroupId && !patchedGroup {
+		performance.GroupName = ""
+	}
+
+	// the same goes for the end time and duration, except a start time is kept either way
+	_, patchedDuration := patch["duration"]
+	_, patchedEndTime := patch["endTime"]
+	if patchedDuration && !patchedEndTime {
+		performance.EndTime = time.Time{}
+	}
+
+	// the patch was applied to this version, so only save it if that's still the latest
+	performance.Version = current.Version
+	if !api.savePerformance(w, r, id, &performance) {
+		return
+	}
+
+	performance.Id = id
+	api.respondJSON(w, http.StatusOK, &performance)
+}
+
+// PATCH /performers/:id - changes only the fields in the merge patch, leaving the rest as they are
+func (api *API) PatchPerformer(w http.ResponseWriter, r *http.Request) {
+	id, err := api.extractId(r.URL.Path)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid ID provided")
+		return
+	}
+
+	version, ok := api.requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+
+	body, ok := api.readMergePatch(w, r)
+	if !ok {
+		return
+	}
+
+	current, err := api.wrapper.GetPerformerById(id)
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Unable to find performer")
+		return
+	}
+	if current == nil {
+		api.respondError(w, http.StatusNotFound, "Performer Not Found")
+		return
+	}
+	if version != anyVersion && version != current.Version {
+		api.respondIfVersionMismatch(w, ErrVersionMismatch)
+		return
+	}
+
+	var performer Performer
+	_, err = applyMergePatch(current, body, &performer)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// the patch was applied to this version, so only save it if that's still the latest
+	performer.Version = current.Version
+	if !api.savePerformer(w, r, id, &performer) {
+		return
+	}
+
+	performer.Id = id
+	api.respondJSON(w, http.StatusOK, &performer)
+}
@@ -0,0 +1,126 @@
+package internal_test
+
+import (
+	"encoding/json"
+	internal "foc_api/internal"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func patchRequest(handler http.HandlerFunc, path, contentType, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("PATCH", path, strings.NewReader(body))
+	r.Header.Set("Content-Type", contentType)
+	r.Header.Set("If-Match", "*")
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func TestPatchPerformanceChangesOnlyGivenFields(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+	api := internal.NewAPI(dbw)
+
+	original, err := dbw.CreatePerformance(getTestPerformance())
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+
+	// act
+	w := patchRequest(api.PerformanceHandler, "/performances/1", "application/merge-patch+json",
+		`{"location": "Side Stage", "startTime": "2025-09-01T20:00:00Z", "groupName": null}`)
+
+	// assert
+	require.Equal(t, http.StatusOK, w.Code, "PATCH failed: %s", w.Body.String())
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"), "PATCH should return the new ETag")
+
+	stored, err := dbw.GetPerformanceById(original.Id)
+	require.NoError(t, err, "GetPerformanceById() failed: %v", err)
+	assert.Equal(t, original.ItemName, stored.ItemName, "Untouched field was changed")
+	assert.Equal(t, original.GenreName, stored.GenreName, "Untouched field was changed")
+	assert.Equal(t, original.EndTime, stored.EndTime, "Untouched field was changed")
+	assert.Equal(t, "", stored.GroupName, "null should clear the field")
+	assert.Equal(t, "Side Stage", stored.Location, "Location was not changed")
+	assert.NotEqual(t, original.LocationId, stored.LocationId, "Location id should follow the new location")
+	assert.True(t, time.Date(2025, 9, 1, 20, 0, 0, 0, time.UTC).Equal(stored.StartTime), "Start time was not changed")
+}
+
+func TestPatchPerformerKeepsEmail(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+	api := internal.NewAPI(dbw)
+
+	original, err := dbw.CreatePerformer(getTestPerformer())
+	require.NoError(t, err, "CreatePerformer() failed: %v", err)
+
+	// act
+	w := patchRequest(api.PerformerHandler, "/performers/1", "application/merge-patch+json", `{"name": "New Name"}`)
+
+	// assert
+	require.Equal(t, http.StatusOK, w.Code, "PATCH failed: %s", w.Body.String())
+
+	var patched internal.Performer
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&patched))
+	assert.Equal(t, "New Name", patched.Name, "Name was not changed")
+	assert.Equal(t, original.Email, patched.Email, "Email should be left alone")
+}
+
+func TestPatchRejectsInvalidPatches(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+	api := internal.NewAPI(dbw)
+
+	_, err := dbw.CreatePerformance(getTestPerformance())
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+
+	cases := []struct {
+		name, contentType, body string
+		expected                int
+	}{
+		{"not an object", "application/merge-patch+json", `["itemName"]`, http.StatusBadRequest},
+		{"wrong type", "application/merge-patch+json", `{"startTime": 12}`, http.StatusBadRequest},
+		{"blanks a required field", "application/merge-patch+json", `{"itemName": null}`, http.StatusUnprocessableEntity},
+		{"wrong content type", "text/plain", `{"itemName": "x"}`, http.StatusUnsupportedMediaType},
+	}
+
+	for _, c := range cases {
+		// act
+		w := patchRequest(api.PerformanceHandler, "/performances/1", c.contentType, c.body)
+
+		// assert
+		assert.Equal(t, c.expected, w.Code, "%s: unexpected status", c.name)
+	}
+}
+
+func TestPatchPerformanceDurationMovesEndTime(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+	api := internal.NewAPI(dbw)
+
+	start := time.Date(2025, 9, 1, 18, 0, 0, 0, time.UTC)
+	original := createTestPerformance(t, dbw, "Take Five", "Take Five Stage", start, 5*time.Minute)
+
+	// act
+	w := patchRequest(api.PerformanceHandler, "/performances/1", "application/merge-patch+json", `{"duration": 600}`)
+
+	// assert
+	require.Equal(t, http.StatusOK, w.Code, "PATCH failed: %s", w.Body.String())
+
+	stored, err := dbw.GetPerformanceById(original.Id)
+	require.NoError(t, err, "GetPerformanceById() failed: %v", err)
+	assert.True(t, start.Equal(stored.StartTime), "Start time should be kept")
+	assert.True(t, start.Add(10*time.Minute).Equal(stored.EndTime), "End time should follow the new duration")
+	assert.Equal(t, 600, stored.Duration)
+}
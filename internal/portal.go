@@ -0,0 +1,399 @@
+package internal
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// how long an emailed login code can be used for
+	loginCodeTTL = 15 * time.Minute
+	// wrong guesses allowed before a login code stops working
+	maxLoginCodeAttempts = 5
+	// login codes that can be sent to one performer in an hour, so their inbox can't be flooded
+	maxLoginCodesPerHour = 5
+	// how long a performer stays logged in
+	performerSessionTTL = 30 * 24 * time.Hour
+
+	// performer session tokens look different to api keys so the two can't be mixed up
+	performerTokenPrefix = "focp_"
+)
+
+var ErrInvalidLoginCode = errors.New("login code is invalid or has expired")
+var ErrTooManyLoginCodes = errors.New("too many login codes have been requested")
+
+// what a performer gets back for a valid login code
+type PerformerSession struct {
+	Token     string     `json:"token"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	Performer *Performer `json:"performer"`
+}
+
+// a random six digit code, short enough to type from an email
+func generateLoginCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+func generatePerformerToken() (string, error) {
+	bytes := make([]byte, 32)
+	_, err := rand.Read(bytes)
+	if err != nil {
+		return "", err
+	}
+	return performerTokenPrefix + hex.EncodeToString(bytes), nil
+}
+
+// creates a login code for the performer with the given email, replacing any earlier ones.
+// returns a nil performer if nobody has that email, and ErrTooManyLoginCodes if they've already
+// been sent maxLoginCodesPerHour codes in the last hour
+func (dbw *DBWrapper) CreatePerformerLoginCode(email string) (*Performer, string, error) {
+	var performer *Performer
+	var code string
+
+	err := dbw.InTransaction(func(tx *DBWrapper) error {
+		var err error
+		performer, err = tx.GetPerformerByEmail(email)
+		if err != nil || performer == nil {
+			return err
+		}
+
+		// codes aren't deleted once used, and each one was created loginCodeTTL before it expires
+		var recent int
+		dbQuery := `SELECT COUNT(*) FROM performer_login_codes WHERE performerId = ? AND expiresAt > ?`
+		err = tx.db.QueryRow(dbQuery, performer.Id, time.Now().UTC().Add(loginCodeTTL-time.Hour)).Scan(&recent)
+		if err != nil {
+			return err
+		}
+		if recent >= maxLoginCodesPerHour {
+			return ErrTooManyLoginCodes
+		}
+
+		code, err = generateLoginCode()
+		if err != nil {
+			return err
+		}
+
+		// only the newest code works
+		_, err = tx.db.Exec(`UPDATE performer_login_codes SET used = 1 WHERE performerId = ? AND used = 0`, performer.Id)
+		if err != nil {
+			return err
+		}
+
+		dbQuery = `
+			INSERT INTO performer_login_codes (performerId, codeHash, expiresAt)
+			VALUES (?, ?, ?)
+		`
+		_, err = tx.db.Exec(dbQuery, performer.Id, hashAPIKey(code), time.Now().UTC().Add(loginCodeTTL))
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return performer, code, nil
+}
+
+// exchanges a login code for a new session. returns ErrInvalidLoginCode if the code is wrong,
+// used up or expired
+func (dbw *DBWrapper) VerifyPerformerLoginCode(email, code string) (*PerformerSession, error) {
+	var session *PerformerSession
+
+	// wrong guesses are counted, so the transaction commits even when the code doesn't match
+	err := dbw.InTransaction(func(tx *DBWrapper) error {
+		performer, err := tx.GetPerformerByEmail(email)
+		if err != nil || performer == nil {
+			return err
+		}
+
+		dbQuery := `
+			SELECT id, codeHash, attempts
+			FROM performer_login_codes
+			WHERE performerId = ? AND used = 0 AND expiresAt > ?
+			ORDER BY id DESC
+			LIMIT 1
+		`
+
+		var id, attempts int
+		var codeHash string
+		err = tx.db.QueryRow(dbQuery, performer.Id, time.Now().UTC()).
+			Scan(&id, &codeHash, &attempts)
+		if err == sql.ErrNoRows {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		matches := subtle.ConstantTimeCompare([]byte(codeHash), []byte(hashAPIKey(strings.TrimSpace(code)))) == 1
+		if !matches {
+			_, err = tx.db.Exec(`UPDATE performer_login_codes SET attempts = attempts + 1, used = attempts + 1 >= ? WHERE id = ?`, maxLoginCodeAttempts, id)
+			return err
+		}
+
+		_, err = tx.db.Exec(`UPDATE performer_login_codes SET used = 1 WHERE id = ?`, id)
+		if err != nil {
+			return err
+		}
+
+		token, err := generatePerformerToken()
+		if err != nil {
+			return err
+		}
+
+		expiresAt := time.Now().UTC().Add(performerSessionTTL)
+		dbQuery = `
+			INSERT INTO performer_sessions (performerId, tokenHash, expiresAt)
+			VALUES (?, ?, ?)
+		`
+		_, err = tx.db.Exec(dbQuery, performer.Id, hashAPIKey(token), expiresAt)
+		if err != nil {
+			return err
+		}
+
+		session = &PerformerSession{Token: token, ExpiresAt: expiresAt, Performer: performer}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if session == nil {
+		return nil, ErrInvalidLoginCode
+	}
+	return session, nil
+}
+
+// Return the performer a session token belongs to, or nil if the session isn't valid
+func (dbw *DBWrapper) GetPerformerBySessionToken(token string) (*Performer, error) {
+	dbQuery := `
+		SELECT ` + performerColumns + `
+		FROM performer_sessions AS s
+		JOIN performers AS p ON p.id = s.performerId
+		WHERE s.tokenHash = ? AND s.revoked = 0 AND s.expiresAt > ? AND p.deleted = 0
+	`
+
+	p, err := scanPerformer(dbw.db.QueryRow(dbQuery, hashAPIKey(token), time.Now().UTC()))
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Ends the session with the given token
+func (dbw *DBWrapper) RevokePerformerSession(token string) error {
+	_, err := dbw.db.Exec(`UPDATE performer_sessions SET revoked = 1 WHERE tokenHash = ?`, hashAPIKey(token))
+	return err
+}
+
+// reads a performer session token from "Authorization: Bearer <token>"
+func performerTokenFromRequest(r *http.Request) string {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found || !strings.HasPrefix(token, performerTokenPrefix) {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// returns the logged in performer, or responds with a 401 and returns nil if there isn't one
+func (api *API) requirePerformer(w http.ResponseWriter, r *http.Request) *Performer {
+	token := performerTokenFromRequest(r)
+	if token == "" {
+		api.respondError(w, http.StatusUnauthorized, "Authentication required")
+		return nil
+	}
+
+	performer, err := api.wrapper.GetPerformerBySessionToken(token)
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Unable to check credentials")
+		return nil
+	}
+	if performer == nil {
+		api.respondError(w, http.StatusUnauthorized, "Invalid or expired session")
+		return nil
+	}
+	return performer
+}
+
+// Handles all requests to the performer self-service portal
+func (api *API) MeHandler(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimSuffix(r.URL.Path, "/")
+
+	switch {
+	case path == "/me/login" && r.Method == http.MethodPost:
+		api.RequestLoginCode(w, r)
+	case path == "/me/verify" && r.Method == http.MethodPost:
+		api.VerifyLoginCode(w, r)
+	case path == "/me/logout" && r.Method == http.MethodPost:
+		api.Logout(w, r)
+	case path == "/me" && r.Method == http.MethodGet:
+		api.GetMe(w, r)
+	case path == "/me" && r.Method == http.MethodPut:
+		api.UpdateMe(w, r)
+	case path == "/me/performances" && r.Method == http.MethodGet:
+		api.GetMyPerformances(w, r)
+	default:
+		api.respondError(w, http.StatusNotFound, "Not Found")
+	}
+}
+
+// POST /me/login - emails a login code to the performer with the given email. responds the same
+// whether or not the email belongs to anyone, or has had too many codes sent to it already, so
+// it can't be used to find out who's performing
+func (api *API) RequestLoginCode(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Email string `json:"email"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	if strings.TrimSpace(body.Email) == "" {
+		api.respondError(w, http.StatusBadRequest, "Email cannot be blank")
+		return
+	}
+
+	if api.mailer == nil {
+		api.respondError(w, http.StatusServiceUnavailable, "Email login is not configured")
+		return
+	}
+
+	performer, code, err := api.wrapper.CreatePerformerLoginCode(body.Email)
+	if errors.Is(err, ErrTooManyLoginCodes) {
+		performer = nil
+	} else if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Unable to create login code")
+		return
+	}
+
+	if performer != nil {
+		err = api.mailer.Send(&Message{
+			To:      performer.Email,
+			Subject: "Your FOC login code",
+			Body: fmt.Sprintf("Hi %s,\n\nYour login code is %s. It expires in %d minutes.\n\nIf you didn't ask for this, you can ignore this email.\n",
+				performer.Name, code, int(loginCodeTTL.Minutes())),
+		})
+		if err != nil {
+			api.respondError(w, http.StatusInternalServerError, "Unable to send login code")
+			return
+		}
+	}
+
+	api.respondJSON(w, http.StatusAccepted, map[string]string{"status": "if that email belongs to a performer, a login code has been sent to it"})
+}
+
+// POST /me/verify - exchanges an emailed login code for a session token
+func (api *API) VerifyLoginCode(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Email string `json:"email"`
+		Code  string `json:"code"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	session, err := api.wrapper.VerifyPerformerLoginCode(body.Email, body.Code)
+	if errors.Is(err, ErrInvalidLoginCode) {
+		api.respondError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Unable to verify login code")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, session)
+}
+
+// POST /me/logout - ends the current session
+func (api *API) Logout(w http.ResponseWriter, r *http.Request) {
+	if api.requirePerformer(w, r) == nil {
+		return
+	}
+
+	err := api.wrapper.RevokePerformerSession(performerTokenFromRequest(r))
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Unable to log out")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// GET /me - returns the logged in performer
+func (api *API) GetMe(w http.ResponseWriter, r *http.Request) {
+	performer := api.requirePerformer(w, r)
+	if performer == nil {
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, performer)
+}
+
+// PUT /me - updates the logged in performer's name. their email is how they log in,
+// so only an organiser can change it
+func (api *API) UpdateMe(w http.ResponseWriter, r *http.Request) {
+	performer := api.requirePerformer(w, r)
+	if performer == nil {
+		return
+	}
+
+	var update Performer
+	err := json.NewDecoder(r.Body).Decode(&update)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	if update.Email != "" && !strings.EqualFold(strings.TrimSpace(update.Email), performer.Email) {
+		api.respondError(w, http.StatusForbidden, "Email can only be changed by an organiser")
+		return
+	}
+
+	performer.Name = strings.TrimSpace(update.Name)
+	// performers only ever change their own record, so the change is recorded against them
+	err = api.wrapper.WithActor(fmt.Sprintf("performer:%d", performer.Id)).UpdatePerformerById(performer.Id, performer)
+	if api.respondIfInvalid(w, err) || api.respondIfVersionMismatch(w, err) {
+		return
+	}
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Error updating performer")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, performer)
+}
+
+// GET /me/performances - returns the logged in performer's performances
+func (api *API) GetMyPerformances(w http.ResponseWriter, r *http.Request) {
+	performer := api.requirePerformer(w, r)
+	if performer == nil {
+		return
+	}
+
+	performances, err := api.wrapper.GetPerformancesByPerformerId(performer.Id)
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Unable to find performances")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, map[string][]*Performance{"performances": performances})
+}
@@ -0,0 +1,247 @@
+package internal_test
+
+import (
+	"bytes"
+	"encoding/json"
+	internal "foc_api/internal"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// keeps every message instead of sending it
+type recordingMailer struct {
+	sent []*internal.Message
+}
+
+func (m *recordingMailer) Send(msg *internal.Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+var loginCodePattern = regexp.MustCompile(`\b\d{6}\b`)
+
+// sets up the portal behind the auth middleware, with a performer who has one performance
+func setUpPortalTest(t *testing.T) (*internal.DBWrapper, http.Handler, *recordingMailer, *internal.Performer) {
+	db := setUpTestDB(t)
+	t.Cleanup(func() { db.Close() })
+	dbw := internal.CreateDBWrapper(db)
+
+	mailer := &recordingMailer{}
+	api := internal.NewAPI(dbw)
+	api.SetMailer(mailer)
+
+	performer, err := dbw.CreatePerformer(getTestPerformer())
+	require.NoError(t, err, "CreatePerformer() failed: %v", err)
+	performance, err := dbw.CreatePerformance(getTestPerformance())
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+	err = dbw.CreateJunction(performer.Id, performance.Id)
+	require.NoError(t, err, "CreateJunction() failed: %v", err)
+
+	return dbw, api.AuthMiddleware(http.HandlerFunc(api.MeHandler)), mailer, performer
+}
+
+func portalRequest(handler http.Handler, method, path, token string, body interface{}) *httptest.ResponseRecorder {
+	encoded, _ := json.Marshal(body)
+	r := httptest.NewRequest(method, path, bytes.NewReader(encoded))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+// logs the performer in through the api, returning their session token
+func logInPerformer(t *testing.T, handler http.Handler, mailer *recordingMailer, email string) string {
+	w := portalRequest(handler, "POST", "/me/login", "", map[string]string{"email": email})
+	require.Equal(t, http.StatusAccepted, w.Code, "Login request failed: %s", w.Body.String())
+	require.NotEmpty(t, mailer.sent, "No login code was sent")
+
+	code := loginCodePattern.FindString(mailer.sent[len(mailer.sent)-1].Body)
+	w = portalRequest(handler, "POST", "/me/verify", "", map[string]string{"email": email, "code": code})
+	require.Equal(t, http.StatusOK, w.Code, "Verify failed: %s", w.Body.String())
+
+	var session internal.PerformerSession
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&session))
+	return session.Token
+}
+
+func TestPortalLoginAndViewOwnRecord(t *testing.T) {
+	// arrange
+	_, handler, mailer, performer := setUpPortalTest(t)
+
+	// act
+	token := logInPerformer(t, handler, mailer, performer.Email)
+	me := portalRequest(handler, "GET", "/me", token, nil)
+	performances := portalRequest(handler, "GET", "/me/performances", token, nil)
+
+	// assert
+	assert.Equal(t, performer.Email, mailer.sent[0].To, "Login code sent to the wrong address")
+
+	require.Equal(t, http.StatusOK, me.Code, "GET /me failed: %s", me.Body.String())
+	var got internal.Performer
+	require.NoError(t, json.NewDecoder(me.Body).Decode(&got))
+	assert.Equal(t, *performer, got, "GET /me returned the wrong performer")
+
+	require.Equal(t, http.StatusOK, performances.Code, "GET /me/performances failed: %s", performances.Body.String())
+	var body map[string][]*internal.Performance
+	require.NoError(t, json.NewDecoder(performances.Body).Decode(&body))
+	assert.Len(t, body["performances"], 1, "Expected the performer's one performance")
+}
+
+func TestPortalLoginForUnknownEmailSendsNothing(t *testing.T) {
+	// arrange
+	_, handler, mailer, _ := setUpPortalTest(t)
+
+	// act
+	w := portalRequest(handler, "POST", "/me/login", "", map[string]string{"email": "nobody@example.com"})
+
+	// assert
+	assert.Equal(t, http.StatusAccepted, w.Code, "Unknown emails should look the same as known ones")
+	assert.Empty(t, mailer.sent, "Mail was sent to an unknown address")
+}
+
+func TestPortalLimitsLoginCodesPerHour(t *testing.T) {
+	// arrange
+	dbw, handler, mailer, performer := setUpPortalTest(t)
+
+	// act
+	statuses := []int{}
+	for i := 0; i < 6; i++ {
+		w := portalRequest(handler, "POST", "/me/login", "", map[string]string{"email": performer.Email})
+		statuses = append(statuses, w.Code)
+	}
+	_, _, err := dbw.CreatePerformerLoginCode(performer.Email)
+
+	// assert
+	assert.Equal(t, []int{202, 202, 202, 202, 202, 202}, statuses, "Being over the limit should look the same as an unknown email")
+	assert.Len(t, mailer.sent, 5, "Only five codes should be sent in an hour")
+	assert.ErrorIs(t, err, internal.ErrTooManyLoginCodes)
+
+	code := loginCodePattern.FindString(mailer.sent[4].Body)
+	_, err = dbw.VerifyPerformerLoginCode(performer.Email, code)
+	assert.NoError(t, err, "The last code sent should still work")
+}
+
+func TestPortalRejectsBadCodes(t *testing.T) {
+	// arrange
+	dbw, _, _, performer := setUpPortalTest(t)
+
+	_, code, err := dbw.CreatePerformerLoginCode(performer.Email)
+	require.NoError(t, err, "CreatePerformerLoginCode() failed: %v", err)
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+
+	// act
+	_, wrongErr := dbw.VerifyPerformerLoginCode(performer.Email, wrong)
+	session, err := dbw.VerifyPerformerLoginCode(performer.Email, code)
+	_, reusedErr := dbw.VerifyPerformerLoginCode(performer.Email, code)
+
+	// assert
+	assert.ErrorIs(t, wrongErr, internal.ErrInvalidLoginCode, "Wrong code was accepted")
+	require.NoError(t, err, "Right code was rejected: %v", err)
+	assert.NotEmpty(t, session.Token, "No session token returned")
+	assert.ErrorIs(t, reusedErr, internal.ErrInvalidLoginCode, "Code was accepted twice")
+}
+
+func TestPortalCodeStopsWorkingAfterTooManyGuesses(t *testing.T) {
+	// arrange
+	dbw, _, _, performer := setUpPortalTest(t)
+
+	_, code, err := dbw.CreatePerformerLoginCode(performer.Email)
+	require.NoError(t, err, "CreatePerformerLoginCode() failed: %v", err)
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+
+	// act
+	for i := 0; i < 5; i++ {
+		dbw.VerifyPerformerLoginCode(performer.Email, wrong)
+	}
+	_, err = dbw.VerifyPerformerLoginCode(performer.Email, code)
+
+	// assert
+	assert.ErrorIs(t, err, internal.ErrInvalidLoginCode, "Code still worked after too many wrong guesses")
+}
+
+func TestPortalUpdateMeOnlyChangesName(t *testing.T) {
+	// arrange
+	dbw, handler, mailer, performer := setUpPortalTest(t)
+	token := logInPerformer(t, handler, mailer, performer.Email)
+
+	// act
+	renamed := portalRequest(handler, "PUT", "/me", token, map[string]string{"name": "New Name"})
+	emailChange := portalRequest(handler, "PUT", "/me", token, map[string]string{"name": "New Name", "email": "other@example.com"})
+
+	// assert
+	assert.Equal(t, http.StatusOK, renamed.Code, "Rename failed: %s", renamed.Body.String())
+	assert.Equal(t, http.StatusForbidden, emailChange.Code, "Performer changed their own email")
+
+	stored, err := dbw.GetPerformerById(performer.Id)
+	require.NoError(t, err, "GetPerformerById() failed: %v", err)
+	assert.Equal(t, "New Name", stored.Name, "Name was not updated")
+	assert.Equal(t, performer.Email, stored.Email, "Email was changed")
+}
+
+func TestPortalRequiresSession(t *testing.T) {
+	// arrange
+	_, handler, mailer, performer := setUpPortalTest(t)
+	token := logInPerformer(t, handler, mailer, performer.Email)
+
+	// act
+	noToken := portalRequest(handler, "GET", "/me", "", nil)
+	loggedOut := portalRequest(handler, "POST", "/me/logout", token, nil)
+	afterLogout := portalRequest(handler, "GET", "/me", token, nil)
+
+	// assert
+	assert.Equal(t, http.StatusUnauthorized, noToken.Code, "GET /me worked without a session")
+	assert.Equal(t, http.StatusOK, loggedOut.Code, "Logout failed: %s", loggedOut.Body.String())
+	assert.Equal(t, http.StatusUnauthorized, afterLogout.Code, "Session still worked after logging out")
+}
+
+func TestOutboxMailerWritesMessages(t *testing.T) {
+	// arrange
+	dir := t.TempDir()
+	mailer := &internal.OutboxMailer{Dir: dir, From: "foc@example.com"}
+
+	// act
+	err := mailer.Send(&internal.Message{To: "performer@example.com", Subject: "Hello", Body: "Your code is 123456"})
+
+	// assert
+	require.NoError(t, err, "Send() failed: %v", err)
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	require.NoError(t, err)
+	require.Len(t, files, 1, "Expected one message in the outbox")
+
+	contents, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	assert.Contains(t, string(contents), "To: performer@example.com", "Message is missing its recipient")
+	assert.Contains(t, string(contents), "Your code is 123456", "Message is missing its body")
+}
+
+func TestRestoreRevokesPerformerSessions(t *testing.T) {
+	// arrange
+	dbw, handler, mailer, performer := setUpPortalTest(t)
+	token := logInPerformer(t, handler, mailer, performer.Email)
+
+	doc, err := dbw.Export()
+	require.NoError(t, err, "Export() failed: %v", err)
+
+	// act
+	err = dbw.Restore(doc)
+	require.NoError(t, err, "Restore() failed: %v", err)
+	w := portalRequest(handler, "GET", "/me", token, nil)
+
+	// assert
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "Sessions from before a restore should stop working")
+}
@@ -0,0 +1,228 @@
+package internal
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// the most rows a single page can hold
+	maxPageLimit = 500
+)
+
+// returned when list parameters can't be turned into a query
+type QueryError struct {
+	message string
+}
+
+func (e *QueryError) Error() string {
+	return e.message
+}
+
+func queryErrorf(format string, args ...interface{}) error {
+	return &QueryError{fmt.Sprintf(format, args...)}
+}
+
+// where a page of results sits within the whole result set
+type Pagination struct {
+	Total int `json:"total"`
+	// 0 means every row was returned
+	Limit      int    `json:"limit"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// the WHERE, ORDER BY and LIMIT of a list query. every value goes in args so nothing
+// from the request is ever formatted into the sql itself
+type listQuery struct {
+	conditions []string
+	args       []interface{}
+	orderBy    []string
+	limit      int
+	offset     int
+}
+
+// adds a condition that rows have to meet, with its ? arguments
+func (q *listQuery) where(condition string, args ...interface{}) {
+	q.conditions = append(q.conditions, condition)
+	q.args = append(q.args, args...)
+}
+
+// the WHERE clause, whose arguments are q.args
+func (q *listQuery) whereSQL() string {
+	if len(q.conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(q.conditions, " AND ")
+}
+
+// the ORDER BY and LIMIT clauses, with their arguments appended to the WHERE clause's
+func (q *listQuery) pageSQL() (string, []interface{}) {
+	clause := " ORDER BY " + strings.Join(q.orderBy, ", ")
+	args := append([]interface{}{}, q.args...)
+
+	if q.limit > 0 {
+		clause += " LIMIT ? OFFSET ?"
+		args = append(args, q.limit, q.offset)
+	}
+	return clause, args
+}
+
+// works out the pagination metadata once the total number of matching rows is known
+func (q *listQuery) pagination(total int) *Pagination {
+	page := &Pagination{Total: total, Limit: q.limit}
+	if q.limit > 0 && q.offset+q.limit < total {
+		page.NextCursor = encodeCursor(q.offset + q.limit)
+	}
+	return page
+}
+
+// reads limit, cursor and sort from the request parameters. sortable maps the names
+// clients sort by to the columns they refer to, and idColumn breaks ties
+func parseListQuery(params url.Values, sortable map[string]string, idColumn string) (*listQuery, error) {
+	q := &listQuery{}
+
+	if value := params.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return nil, queryErrorf("limit must be a number between 1 and %d", maxPageLimit)
+		}
+		q.limit = limit
+	}
+
+	if value := params.Get("cursor"); value != "" {
+		offset, err := decodeCursor(value)
+		if err != nil {
+			return nil, err
+		}
+		q.offset = offset
+		// without a limit the whole list comes back, so the cursor would be ignored
+		if q.limit == 0 {
+			return nil, queryErrorf("cursor can only be used with a limit")
+		}
+	}
+
+	// ?sort=startTime,-itemName sorts by startTime, then itemName descending
+	if value := params.Get("sort"); value != "" {
+		for _, field := range strings.Split(value, ",") {
+			direction := "ASC"
+			if strings.HasPrefix(field, "-") {
+				direction = "DESC"
+				field = field[1:]
+			}
+
+			column, ok := sortable[field]
+			if !ok {
+				return nil, queryErrorf("cannot sort by %q", field)
+			}
+			q.orderBy = append(q.orderBy, column+" "+direction)
+		}
+	}
+	// always finish on the id so pages are stable when the sort fields tie
+	q.orderBy = append(q.orderBy, idColumn+" ASC")
+
+	return q, nil
+}
+
+// adds a case-insensitive equality filter for every parameter in filters that is present
+func (q *listQuery) filterEqual(params url.Values, filters map[string]string) {
+	// go randomises map order, so walk the parameters in a fixed order to keep the sql stable
+	names := make([]string, 0, len(filters))
+	for name := range filters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if value := params.Get(name); value != "" {
+			q.where(filters[name]+" = ? COLLATE NOCASE", strings.TrimSpace(value))
+		}
+	}
+}
+
+// adds an inclusive time range filter on column from the named parameters. rows without a time
+// (stored as the zero time) never fall inside a range
+func (q *listQuery) filterTimeRange(params url.Values, column, fromParam, toParam string) error {
+	if params.Get(fromParam) != "" || params.Get(toParam) != "" {
+		q.where(column+" > ?", time.Time{})
+	}
+
+	for _, bound := range []struct {
+		param    string
+		operator string
+	}{{fromParam, ">="}, {toParam, "<="}} {
+		value := params.Get(bound.param)
+		if value == "" {
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return queryErrorf("%s must be a time like 2025-09-01T18:00:00Z", bound.param)
+		}
+		// times are stored in utc, which compares correctly as text
+		q.where(column+" "+bound.operator+" ?", t.UTC())
+	}
+	return nil
+}
+
+// adds an inclusive range filter on an integer column from the named parameters. rows where the
+// column is 0, meaning it isn't known, never fall inside a range
+func (q *listQuery) filterIntRange(params url.Values, column, minParam, maxParam string) error {
+	if params.Get(minParam) != "" || params.Get(maxParam) != "" {
+		q.where(column + " > 0")
+	}
+
+	for _, bound := range []struct {
+		param    string
+		operator string
+	}{{minParam, ">="}, {maxParam, "<="}} {
+		value := params.Get(bound.param)
+		if value == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return queryErrorf("%s must be a whole number that isn't negative", bound.param)
+		}
+		q.where(column+" "+bound.operator+" ?", n)
+	}
+	return nil
+}
+
+// cursors are opaque to clients, so they can't come to rely on what's inside
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("offset:" + strconv.Itoa(offset)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	invalid := queryErrorf("invalid cursor")
+
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, invalid
+	}
+
+	value, found := strings.CutPrefix(string(decoded), "offset:")
+	if !found {
+		return 0, invalid
+	}
+
+	offset, err := strconv.Atoi(value)
+	if err != nil || offset < 0 {
+		return 0, invalid
+	}
+	return offset, nil
+}
+
+// reports whether err came from bad list parameters
+func isQueryError(err error) bool {
+	var queryErr *QueryError
+	return errors.As(err, &queryErr)
+}
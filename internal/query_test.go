@@ -0,0 +1,193 @@
+package internal_test
+
+import (
+	"encoding/json"
+	internal "foc_api/internal"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// creates performances an hour apart, with alternating genres
+func createListTestPerformances(t *testing.T, dbw *internal.DBWrapper, amount int) []*internal.Performance {
+	start := time.Date(2025, 9, 1, 18, 0, 0, 0, time.UTC)
+	genres := []string{"Rock", "Jazz"}
+
+	performances := []*internal.Performance{}
+	for i, p := range getTestPerformances(amount) {
+		p.GenreName = genres[i%2]
+		p.StartTime = start.Add(time.Duration(i) * time.Hour)
+		p.EndTime = p.StartTime.Add(10 * time.Minute)
+
+		created, err := dbw.CreatePerformance(p)
+		require.NoError(t, err, "CreatePerformance() failed: %v", err)
+		performances = append(performances, created)
+	}
+	return performances
+}
+
+func TestListPerformancesPaginates(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	expected := createListTestPerformances(t, dbw, 5)
+
+	// act
+	firstPage, firstPagination, err := dbw.ListPerformances(url.Values{"limit": {"2"}})
+	require.NoError(t, err, "ListPerformances() failed: %v", err)
+
+	secondPage, secondPagination, err := dbw.ListPerformances(url.Values{"limit": {"2"}, "cursor": {firstPagination.NextCursor}})
+	require.NoError(t, err, "ListPerformances() failed: %v", err)
+
+	lastPage, lastPagination, err := dbw.ListPerformances(url.Values{"limit": {"2"}, "cursor": {secondPagination.NextCursor}})
+	require.NoError(t, err, "ListPerformances() failed: %v", err)
+
+	// assert
+	assert.Equal(t, 5, firstPagination.Total)
+	assert.Equal(t, expected[0:2], firstPage)
+	assert.Equal(t, expected[2:4], secondPage)
+	assert.Equal(t, expected[4:], lastPage)
+	assert.Empty(t, lastPagination.NextCursor, "Last page should not have a next cursor")
+}
+
+func TestListPerformancesSortsAndFilters(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	expected := createListTestPerformances(t, dbw, 6)
+
+	params := url.Values{
+		"genreName":     {"rock"},
+		"startTimeFrom": {"2025-09-01T19:00:00Z"},
+		"sort":          {"-startTime"},
+	}
+
+	// act
+	actual, pagination, err := dbw.ListPerformances(params)
+
+	// assert
+	require.NoError(t, err, "ListPerformances() failed: %v", err)
+	assert.Equal(t, 2, pagination.Total)
+	assert.Equal(t, []*internal.Performance{expected[4], expected[2]}, actual)
+}
+
+func TestListPerformersFiltersByEmail(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	performers := getTestPerformers(3)
+	for i, p := range performers {
+		created, err := dbw.CreatePerformer(p)
+		require.NoError(t, err, "CreatePerformer() failed: %v", err)
+		performers[i] = created
+	}
+
+	// act
+	actual, pagination, err := dbw.ListPerformers(url.Values{"email": {performers[1].Email}})
+
+	// assert
+	require.NoError(t, err, "ListPerformers() failed: %v", err)
+	assert.Equal(t, 1, pagination.Total)
+	assert.Equal(t, []*internal.Performer{performers[1]}, actual)
+}
+
+func TestGetAllPerformancesEndpointRejectsUnknownSort(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+	api := internal.NewAPI(dbw)
+
+	r := httptest.NewRequest("GET", "/performances?sort=deleted", nil)
+	w := httptest.NewRecorder()
+
+	// act
+	api.PerformanceHandler(w, r)
+
+	// assert
+	assert.Equal(t, http.StatusBadRequest, w.Code, "PerformanceHandler() returned status %v", w.Code)
+}
+
+func TestGetAllPerformancesEndpointRejectsCursorWithoutLimit(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+	api := internal.NewAPI(dbw)
+
+	createListTestPerformances(t, dbw, 2)
+	_, pagination, err := dbw.ListPerformances(url.Values{"limit": {"1"}})
+	require.NoError(t, err, "ListPerformances() failed: %v", err)
+
+	r := httptest.NewRequest("GET", "/performances?cursor="+pagination.NextCursor, nil)
+	w := httptest.NewRecorder()
+
+	// act
+	api.PerformanceHandler(w, r)
+
+	// assert
+	assert.Equal(t, http.StatusBadRequest, w.Code, "PerformanceHandler() returned status %v", w.Code)
+}
+
+func TestGetAllPerformancesEndpointIncludesPagination(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+	api := internal.NewAPI(dbw)
+
+	createListTestPerformances(t, dbw, 3)
+
+	r := httptest.NewRequest("GET", "/performances?limit=2", nil)
+	w := httptest.NewRecorder()
+
+	// act
+	api.PerformanceHandler(w, r)
+
+	// assert
+	require.Equal(t, http.StatusOK, w.Code, "PerformanceHandler() returned status %v", w.Code)
+
+	response := struct {
+		Performances []*internal.Performance `json:"performances"`
+		Pagination   *internal.Pagination    `json:"pagination"`
+	}{}
+	err := json.NewDecoder(w.Body).Decode(&response)
+	require.NoError(t, err, "Error decoding response from endpoint: %v", err)
+	assert.Len(t, response.Performances, 2)
+	assert.Equal(t, 3, response.Pagination.Total)
+	assert.NotEmpty(t, response.Pagination.NextCursor)
+}
+
+func TestListPerformancesFiltersByDuration(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	start := time.Date(2025, 9, 1, 18, 0, 0, 0, time.UTC)
+	short := createTestPerformance(t, dbw, "Short", "Short Stage", start, 3*time.Minute)
+	createTestPerformance(t, dbw, "Long", "Long Stage", start, 20*time.Minute)
+	_, err := dbw.CreatePerformance(&internal.Performance{ItemName: "No Length Yet"})
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+
+	// act
+	performances, _, err := dbw.ListPerformances(url.Values{"durationMax": {"299"}})
+	require.NoError(t, err, "ListPerformances() failed: %v", err)
+
+	_, _, invalidErr := dbw.ListPerformances(url.Values{"durationMin": {"five"}})
+
+	// assert
+	assert.Equal(t, []*internal.Performance{short}, performances, "Only performances shorter than 5 minutes should be listed")
+	assert.Error(t, invalidErr, "A duration that isn't a number should be rejected")
+}
@@ -0,0 +1,297 @@
+package internal
+
+import (
+	"database/sql"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// how a performance ran compared to when it was meant to. the planned times are the ones it had
+// before any delays. differences are in seconds and are nil until the actual times are known
+type PerformanceTiming struct {
+	PerformanceId    int       `json:"performanceId"`
+	ItemName         string    `json:"itemName"`
+	PlannedStartTime time.Time `json:"plannedStartTime"`
+	PlannedEndTime   time.Time `json:"plannedEndTime"`
+	ActualStartTime  time.Time `json:"actualStartTime"`
+	ActualEndTime    time.Time `json:"actualEndTime"`
+	// positive when it started or ended late, negative when early
+	StartDelay *int `json:"startDelay"`
+	EndDelay   *int `json:"endDelay"`
+	// how much longer than planned it ran for, or negative if it was cut short
+	Overrun *int `json:"overrun"`
+}
+
+// how a location kept to time overall
+type TimingSummary struct {
+	Scheduled int `json:"scheduled"`
+	Started   int `json:"started"`
+	Finished  int `json:"finished"`
+	// started more than a minute late
+	StartedLate       int  `json:"startedLate"`
+	AverageStartDelay *int `json:"averageStartDelay"`
+	MaxStartDelay     *int `json:"maxStartDelay"`
+	TotalOverrun      int  `json:"totalOverrun"`
+}
+
+// the timing report for a single location
+type LocationTiming struct {
+	LocationId   int                  `json:"locationId"`
+	Location     string               `json:"location"`
+	Summary      *TimingSummary       `json:"summary"`
+	Performances []*PerformanceTiming `json:"performances"`
+}
+
+// who turned up for a performance
+type PerformanceAttendance struct {
+	PerformanceId int                 `json:"performanceId"`
+	ItemName      string              `json:"itemName"`
+	Location      string              `json:"location"`
+	StartTime     time.Time           `json:"startTime"`
+	Present       int                 `json:"present"`
+	Absent        int                 `json:"absent"`
+	Unchecked     int                 `json:"unchecked"`
+	Performers    []*PerformerCheckIn `json:"performers"`
+}
+
+// a single performer's check-in for a performance
+type PerformerCheckIn struct {
+	PerformerId int       `json:"performerId"`
+	Name        string    `json:"name"`
+	Attendance  string    `json:"attendance"`
+	CheckedInAt time.Time `json:"checkedInAt"`
+}
+
+// starting less than this late still counts as on time
+const lateStartTolerance = time.Minute
+
+// compares planned and actual times for every scheduled performance, grouped by location in
+// location order and then by planned start. an editionId other than 0 only reports on that edition
+func (dbw *DBWrapper) GetTimingReport(editionId int) ([]*LocationTiming, error) {
+	dbQuery := `
+		SELECT ` + performanceColumns + `
+		FROM performances AS p
+		WHERE p.deleted = 0 AND (? = 0 OR p.editionId = ?)
+		ORDER BY p.location ASC, p.id ASC
+	`
+	rows, err := dbw.db.Query(dbQuery, editionId, editionId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := []*LocationTiming{}
+	byLocation := map[string]*LocationTiming{}
+	for rows.Next() {
+		p, err := scanPerformance(rows)
+		if err != nil {
+			return nil, err
+		}
+		if !isScheduled(p) {
+			continue
+		}
+
+		l := byLocation[p.Location]
+		if l == nil {
+			l = &LocationTiming{LocationId: p.LocationId, Location: p.Location, Summary: &TimingSummary{}, Performances: []*PerformanceTiming{}}
+			byLocation[p.Location] = l
+			report = append(report, l)
+		}
+		l.Performances = append(l.Performances, performanceTiming(p))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, l := range report {
+		// delayed performances are ordered by when they were planned for
+		sort.SliceStable(l.Performances, func(i, j int) bool {
+			return l.Performances[i].PlannedStartTime.Before(l.Performances[j].PlannedStartTime)
+		})
+		l.Summary = summariseTimings(l.Performances)
+	}
+	return report, nil
+}
+
+// works out how p ran compared to its plan
+func performanceTiming(p *Performance) *PerformanceTiming {
+	t := &PerformanceTiming{
+		PerformanceId:    p.Id,
+		ItemName:         p.ItemName,
+		PlannedStartTime: p.StartTime,
+		PlannedEndTime:   p.EndTime,
+		ActualStartTime:  p.ActualStartTime,
+		ActualEndTime:    p.ActualEndTime,
+	}
+	// the planned times are only kept once it has been delayed
+	if !p.PlannedStartTime.IsZero() {
+		t.PlannedStartTime = p.PlannedStartTime
+		t.PlannedEndTime = p.PlannedEndTime
+	}
+
+	if !t.ActualStartTime.IsZero() {
+		t.StartDelay = secondsBetween(t.PlannedStartTime, t.ActualStartTime)
+	}
+	if !t.ActualEndTime.IsZero() {
+		t.EndDelay = secondsBetween(t.PlannedEndTime, t.ActualEndTime)
+	}
+	if !t.ActualStartTime.IsZero() && !t.ActualEndTime.IsZero() {
+		planned := t.PlannedEndTime.Sub(t.PlannedStartTime)
+		actual := t.ActualEndTime.Sub(t.ActualStartTime)
+		overrun := int((actual - planned) / time.Second)
+		t.Overrun = &overrun
+	}
+	return t
+}
+
+func summariseTimings(timings []*PerformanceTiming) *TimingSummary {
+	s := &TimingSummary{Scheduled: len(timings)}
+	totalStartDelay := 0
+	for _, t := range timings {
+		if t.StartDelay != nil {
+			s.Started++
+			totalStartDelay += *t.StartDelay
+			if time.Duration(*t.StartDelay)*time.Second >= lateStartTolerance {
+				s.StartedLate++
+			}
+			if s.MaxStartDelay == nil || *t.StartDelay > *s.MaxStartDelay {
+				maxDelay := *t.StartDelay
+				s.MaxStartDelay = &maxDelay
+			}
+		}
+		if t.EndDelay != nil {
+			s.Finished++
+		}
+		if t.Overrun != nil {
+			s.TotalOverrun += *t.Overrun
+		}
+	}
+	if s.Started > 0 {
+		average := totalStartDelay / s.Started
+		s.AverageStartDelay = &average
+	}
+	return s
+}
+
+func secondsBetween(from, to time.Time) *int {
+	seconds := int(to.Sub(from) / time.Second)
+	return &seconds
+}
+
+// returns the check-ins for every performance with performers booked, in start time order. an
+// editionId other than 0 only reports on that edition
+func (dbw *DBWrapper) GetAttendanceReport(editionId int) ([]*PerformanceAttendance, error) {
+	dbQuery := `
+		SELECT p.id, p.itemName, p.location, p.startTime, j.performer_id, pr.name, j.attendance, j.checkedInAt
+		FROM performances AS p
+		INNER JOIN junction AS j ON j.performance_id = p.id
+		INNER JOIN performers AS pr ON pr.id = j.performer_id
+		WHERE p.deleted = 0 AND pr.deleted = 0 AND (? = 0 OR p.editionId = ?)
+		ORDER BY p.startTime ASC, p.id ASC, pr.name ASC, pr.id ASC
+	`
+	rows, err := dbw.db.Query(dbQuery, editionId, editionId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := []*PerformanceAttendance{}
+	var current *PerformanceAttendance
+	for rows.Next() {
+		a := &PerformanceAttendance{}
+		c := &PerformerCheckIn{}
+		var checkedInAt sql.NullTime
+		err := rows.Scan(&a.PerformanceId, &a.ItemName, &a.Location, &a.StartTime, &c.PerformerId, &c.Name, &c.Attendance, &checkedInAt)
+		if err != nil {
+			return nil, err
+		}
+		c.CheckedInAt = checkedInAt.Time.UTC()
+
+		if current == nil || current.PerformanceId != a.PerformanceId {
+			a.Performers = []*PerformerCheckIn{}
+			current = a
+			report = append(report, current)
+		}
+		current.Performers = append(current.Performers, c)
+
+		switch c.Attendance {
+		case attendancePresent:
+			current.Present++
+		case attendanceAbsent:
+			current.Absent++
+		default:
+			current.Unchecked++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// Handles requests for reports
+func (api *API) ReportHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		switch strings.TrimSuffix(r.URL.Path, "/") {
+		case "/reports/timing":
+			api.GetTimingReport(w, r)
+		case "/reports/attendance":
+			api.GetAttendanceReport(w, r)
+		default:
+			api.respondError(w, http.StatusNotFound, "Report Not Found")
+		}
+	}
+}
+
+// GET /reports/timing - planned against actual times for each location
+func (api *API) GetTimingReport(w http.ResponseWriter, r *http.Request) {
+	editionId, ok := api.reportEditionId(w, r)
+	if !ok {
+		return
+	}
+
+	report, err := api.wrapper.GetTimingReport(editionId)
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Unable to build timing report")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, map[string]interface{}{"locations": report})
+}
+
+// GET /reports/attendance - which performers turned up for each performance
+func (api *API) GetAttendanceReport(w http.ResponseWriter, r *http.Request) {
+	editionId, ok := api.reportEditionId(w, r)
+	if !ok {
+		return
+	}
+
+	report, err := api.wrapper.GetAttendanceReport(editionId)
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Unable to build attendance report")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, map[string]interface{}{"performances": report})
+}
+
+// reads the optional ?editionId= a report is limited to. responds with an error and returns false
+// if it isn't a number
+func (api *API) reportEditionId(w http.ResponseWriter, r *http.Request) (int, bool) {
+	value := r.URL.Query().Get("editionId")
+	if value == "" {
+		return 0, true
+	}
+
+	editionId, err := strconv.Atoi(value)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "editionId must be a number")
+		return 0, false
+	}
+	return editionId, true
+}
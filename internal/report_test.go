@@ -0,0 +1,113 @@
+package internal_test
+
+import (
+	"encoding/json"
+	internal "foc_api/internal"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimingReportComparesPlannedAndActual(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	start := time.Date(2025, 9, 1, 18, 0, 0, 0, time.UTC)
+	first := createTestPerformance(t, dbw, "Act One", "Main Stage", start, 30*time.Minute)
+	second := createTestPerformance(t, dbw, "Act Two", "Main Stage", start.Add(30*time.Minute), 30*time.Minute)
+	createTestPerformance(t, dbw, "Side Act", "Side Stage", start, 30*time.Minute)
+
+	// the first act went on five minutes late and overran by ten, pushing the second back
+	_, err := dbw.StartPerformance(first.Id, start.Add(5*time.Minute))
+	require.NoError(t, err, "StartPerformance() failed: %v", err)
+	_, err = dbw.FinishPerformance(first.Id, start.Add(45*time.Minute))
+	require.NoError(t, err, "FinishPerformance() failed: %v", err)
+	_, err = dbw.DelayPerformance(second.Id, 15*time.Minute, false)
+	require.NoError(t, err, "DelayPerformance() failed: %v", err)
+	_, err = dbw.StartPerformance(second.Id, start.Add(46*time.Minute))
+	require.NoError(t, err, "StartPerformance() failed: %v", err)
+
+	// act
+	report, err := dbw.GetTimingReport(0)
+	require.NoError(t, err, "GetTimingReport() failed: %v", err)
+
+	// assert
+	require.Len(t, report, 2)
+	main := report[0]
+	assert.Equal(t, "Main Stage", main.Location)
+	require.Len(t, main.Performances, 2)
+
+	timing := main.Performances[0]
+	assert.Equal(t, first.Id, timing.PerformanceId)
+	assert.Equal(t, 300, *timing.StartDelay)
+	assert.Equal(t, 900, *timing.EndDelay)
+	assert.Equal(t, 600, *timing.Overrun)
+
+	timing = main.Performances[1]
+	assert.Equal(t, second.Id, timing.PerformanceId)
+	assert.True(t, start.Add(30*time.Minute).Equal(timing.PlannedStartTime), "Delayed performance should be compared with its original plan")
+	assert.Equal(t, 960, *timing.StartDelay)
+	assert.Nil(t, timing.EndDelay, "Unfinished performance should have no end delay")
+	assert.Nil(t, timing.Overrun)
+
+	assert.Equal(t, 2, main.Summary.Started)
+	assert.Equal(t, 1, main.Summary.Finished)
+	assert.Equal(t, 2, main.Summary.StartedLate)
+	assert.Equal(t, 630, *main.Summary.AverageStartDelay)
+	assert.Equal(t, 960, *main.Summary.MaxStartDelay)
+	assert.Equal(t, 600, main.Summary.TotalOverrun)
+
+	assert.Equal(t, 0, report[1].Summary.Started)
+	assert.Nil(t, report[1].Summary.AverageStartDelay)
+}
+
+func TestAttendanceReportEndpoint(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+	api := internal.NewAPI(dbw)
+
+	start := time.Date(2025, 9, 1, 18, 0, 0, 0, time.UTC)
+	p := createTestPerformance(t, dbw, "Act One", "Main Stage", start, 30*time.Minute)
+	names := []string{"Ada", "Brian", "Cleo"}
+	for _, name := range names {
+		performer, err := dbw.CreatePerformer(&internal.Performer{Name: name, Email: name + "@test.com"})
+		require.NoError(t, err, "CreatePerformer() failed: %v", err)
+		require.NoError(t, dbw.CreateJunction(performer.Id, p.Id))
+	}
+	_, err := dbw.CheckInPerformer(1, p.Id, "present", start)
+	require.NoError(t, err, "CheckInPerformer() failed: %v", err)
+	_, err = dbw.CheckInPerformer(2, p.Id, "absent", start)
+	require.NoError(t, err, "CheckInPerformer() failed: %v", err)
+
+	r := httptest.NewRequest("GET", "/reports/attendance", nil)
+	w := httptest.NewRecorder()
+
+	// act
+	api.ReportHandler(w, r)
+
+	// assert
+	require.Equal(t, http.StatusOK, w.Code, "ReportHandler() returned status %v", w.Code)
+	var response struct {
+		Performances []*internal.PerformanceAttendance `json:"performances"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	require.Len(t, response.Performances, 1)
+
+	attendance := response.Performances[0]
+	assert.Equal(t, p.Id, attendance.PerformanceId)
+	assert.Equal(t, 1, attendance.Present)
+	assert.Equal(t, 1, attendance.Absent)
+	assert.Equal(t, 1, attendance.Unchecked)
+	require.Len(t, attendance.Performers, 3)
+	assert.Equal(t, "Cleo", attendance.Performers[2].Name)
+	assert.Equal(t, "", attendance.Performers[2].Attendance)
+	assert.True(t, attendance.Performers[2].CheckedInAt.IsZero())
+}
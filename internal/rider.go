@@ -0,0 +1,495 @@
+package internal
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// what an act needs from the stage crew: the channels they plug into the desk, the gear they
+// need on stage, and links to stage plots, audio tracks and the like
+type TechRider struct {
+	PerformanceId int               `json:"performanceId"`
+	Inputs        []*RiderInput     `json:"inputs"`
+	Equipment     []*RiderEquipment `json:"equipment"`
+	Files         []*RiderFile      `json:"files"`
+	Notes         string            `json:"notes"`
+	UpdatedAt     time.Time         `json:"updatedAt"`
+}
+
+// a single channel on the desk
+type RiderInput struct {
+	// numbered from 1. left out, it's the input's place in the list
+	Channel int `json:"channel"`
+	// e.g. "Kick" or "Lead vocal"
+	Name string `json:"name"`
+	// mic, di, line or playback
+	Kind  string `json:"kind"`
+	Notes string `json:"notes"`
+}
+
+type RiderEquipment struct {
+	// e.g. "Guitar amp" or "Follow spot"
+	Item string `json:"item"`
+	// backline, lighting, audio or other
+	Category string `json:"category"`
+	// defaults to 1
+	Quantity int `json:"quantity"`
+	// festival or act. defaults to festival
+	ProvidedBy string `json:"providedBy"`
+	Notes      string `json:"notes"`
+}
+
+type RiderFile struct {
+	Name string `json:"name"`
+	Url  string `json:"url"`
+}
+
+// the kinds of input a rider can ask for
+const (
+	riderInputMic      = "mic"
+	riderInputDI       = "di"
+	riderInputLine     = "line"
+	riderInputPlayback = "playback"
+)
+
+// the kinds of equipment a rider can ask for
+const (
+	equipmentBackline = "backline"
+	equipmentLighting = "lighting"
+	equipmentAudio    = "audio"
+	equipmentOther    = "other"
+)
+
+// who brings a piece of equipment
+const (
+	providedByFestival = "festival"
+	providedByAct      = "act"
+)
+
+var (
+	riderInputKinds     = []string{riderInputMic, riderInputDI, riderInputLine, riderInputPlayback}
+	equipmentCategories = []string{equipmentBackline, equipmentLighting, equipmentAudio, equipmentOther}
+	equipmentProviders  = []string{providedByFestival, providedByAct}
+)
+
+// everything a location needs during one hour
+type EquipmentHour struct {
+	Start          time.Time `json:"start"`
+	End            time.Time `json:"end"`
+	PerformanceIds []int     `json:"performanceIds"`
+	// performances in the hour that haven't sent a rider yet
+	WithoutRider []int `json:"withoutRider"`
+	// the most inputs, and mic inputs, any one of the hour's performances needs
+	Inputs    int               `json:"inputs"`
+	Mics      int               `json:"mics"`
+	Equipment []*EquipmentTotal `json:"equipment"`
+}
+
+type EquipmentTotal struct {
+	Item       string `json:"item"`
+	Category   string `json:"category"`
+	ProvidedBy string `json:"providedBy"`
+	// the most any one performance in the hour needs. performances at a location don't overlap,
+	// so this is how many have to be on hand
+	Quantity int `json:"quantity"`
+	// how many of the hour's performances need it, i.e. how often it's part of a changeover
+	Performances int `json:"performances"`
+}
+
+// Return the tech rider of the performance with the given id, or nil if it hasn't got one
+func (dbw *DBWrapper) GetRider(performanceId int) (*TechRider, error) {
+	rider := &TechRider{
+		PerformanceId: performanceId,
+		Inputs:        []*RiderInput{},
+		Equipment:     []*RiderEquipment{},
+		Files:         []*RiderFile{},
+	}
+	err := dbw.db.QueryRow(`SELECT notes, updatedAt FROM riders WHERE performanceId = ?`, performanceId).Scan(&rider.Notes, &rider.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	rider.UpdatedAt = rider.UpdatedAt.UTC()
+
+	rows, err := dbw.db.Query(`SELECT channel, name, kind, notes FROM rider_inputs WHERE performanceId = ? ORDER BY channel ASC`, performanceId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		input := &RiderInput{}
+		err := rows.Scan(&input.Channel, &input.Name, &input.Kind, &input.Notes)
+		if err != nil {
+			return nil, err
+		}
+		rider.Inputs = append(rider.Inputs, input)
+	}
+
+	rows, err = dbw.db.Query(`SELECT item, category, quantity, providedBy, notes FROM rider_equipment WHERE performanceId = ? ORDER BY position ASC`, performanceId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		e := &RiderEquipment{}
+		err := rows.Scan(&e.Item, &e.Category, &e.Quantity, &e.ProvidedBy, &e.Notes)
+		if err != nil {
+			return nil, err
+		}
+		rider.Equipment = append(rider.Equipment, e)
+	}
+
+	rows, err = dbw.db.Query(`SELECT name, url FROM rider_files WHERE performanceId = ? ORDER BY position ASC`, performanceId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		f := &RiderFile{}
+		err := rows.Scan(&f.Name, &f.Url)
+		if err != nil {
+			return nil, err
+		}
+		rider.Files = append(rider.Files, f)
+	}
+
+	return rider, rows.Err()
+}
+
+// Replaces the tech rider of the performance with the given id. returns sql.ErrNoRows if
+// there's no such performance
+func (dbw *DBWrapper) SaveRider(performanceId int, rider *TechRider) (*TechRider, error) {
+	normaliseRider(rider)
+	err := validateRider(rider)
+	if err != nil {
+		return nil, err
+	}
+	// sorted after validating, so errors point at the inputs as they were sent
+	sort.SliceStable(rider.Inputs, func(i, j int) bool {
+		return rider.Inputs[i].Channel < rider.Inputs[j].Channel
+	})
+
+	err = dbw.InTransaction(func(tx *DBWrapper) error {
+		performance, err := tx.GetPerformanceById(performanceId)
+		if err != nil {
+			return err
+		}
+		if performance == nil {
+			return sql.ErrNoRows
+		}
+
+		before, err := tx.GetRider(performanceId)
+		if err != nil {
+			return err
+		}
+
+		rider.PerformanceId = performanceId
+		rider.UpdatedAt = time.Now().UTC()
+		err = tx.removeRider(performanceId)
+		if err != nil {
+			return err
+		}
+		err = tx.insertRider(rider)
+		if err != nil {
+			return err
+		}
+
+		action := auditActionUpdate
+		if before == nil {
+			action = auditActionCreate
+		}
+		return tx.audit(auditEntityRider, strconv.Itoa(performanceId), action, before, rider)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rider, nil
+}
+
+// Deletes the tech rider of the performance with the given id
+func (dbw *DBWrapper) DeleteRider(performanceId int) error {
+	return dbw.InTransaction(func(tx *DBWrapper) error {
+		before, err := tx.GetRider(performanceId)
+		if err != nil {
+			return err
+		}
+		// deleting something that's already gone doesn't change anything
+		if before == nil {
+			return nil
+		}
+
+		err = tx.removeRider(performanceId)
+		if err != nil {
+			return err
+		}
+		return tx.audit(auditEntityRider, strconv.Itoa(performanceId), auditActionDelete, before, nil)
+	})
+}
+
+// puts every row of the rider into the db
+func (dbw *DBWrapper) insertRider(rider *TechRider) error {
+	_, err := dbw.db.Exec(`INSERT INTO riders (performanceId, notes, updatedAt) VALUES (?, ?, ?)`, rider.PerformanceId, rider.Notes, rider.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	for _, input := range rider.Inputs {
+		_, err := dbw.db.Exec(`INSERT INTO rider_inputs (performanceId, channel, name, kind, notes) VALUES (?, ?, ?, ?, ?)`,
+			rider.PerformanceId, input.Channel, input.Name, input.Kind, input.Notes)
+		if err != nil {
+			return err
+		}
+	}
+	for i, e := range rider.Equipment {
+		_, err := dbw.db.Exec(`INSERT INTO rider_equipment (performanceId, position, item, category, quantity, providedBy, notes) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			rider.PerformanceId, i, e.Item, e.Category, e.Quantity, e.ProvidedBy, e.Notes)
+		if err != nil {
+			return err
+		}
+	}
+	for i, f := range rider.Files {
+		_, err := dbw.db.Exec(`INSERT INTO rider_files (performanceId, position, name, url) VALUES (?, ?, ?, ?)`, rider.PerformanceId, i, f.Name, f.Url)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deletes every row of the performance's rider, children first
+func (dbw *DBWrapper) removeRider(performanceId int) error {
+	for _, table := range []string{"rider_files", "rider_equipment", "rider_inputs", "riders"} {
+		_, err := dbw.db.Exec(`DELETE FROM `+table+` WHERE performanceId = ?`, performanceId)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns what the location with the given id needs for each hour something is on there. an
+// editionId other than 0 only looks at that edition
+func (dbw *DBWrapper) GetLocationEquipment(locationId, editionId int) ([]*EquipmentHour, error) {
+	performances, err := dbw.GetPerformancesByLocationId(locationId)
+	if err != nil {
+		return nil, err
+	}
+
+	hours := []*EquipmentHour{}
+	byStart := map[time.Time]*EquipmentHour{}
+	for _, p := range performances {
+		if !isScheduled(p) || (editionId != 0 && p.EditionId != editionId) {
+			continue
+		}
+
+		rider, err := dbw.GetRider(p.Id)
+		if err != nil {
+			return nil, err
+		}
+
+		for start := p.StartTime.UTC().Truncate(time.Hour); start.Before(p.EndTime); start = start.Add(time.Hour) {
+			hour, ok := byStart[start]
+			if !ok {
+				hour = &EquipmentHour{Start: start, End: start.Add(time.Hour), PerformanceIds: []int{}, WithoutRider: []int{}, Equipment: []*EquipmentTotal{}}
+				byStart[start] = hour
+				hours = append(hours, hour)
+			}
+			addToEquipmentHour(hour, p.Id, rider)
+		}
+	}
+
+	sort.SliceStable(hours, func(i, j int) bool {
+		return hours[i].Start.Before(hours[j].Start)
+	})
+	return hours, nil
+}
+
+// counts the performance's rider towards the hour
+func addToEquipmentHour(hour *EquipmentHour, performanceId int, rider *TechRider) {
+	hour.PerformanceIds = append(hour.PerformanceIds, performanceId)
+	if rider == nil {
+		hour.WithoutRider = append(hour.WithoutRider, performanceId)
+		return
+	}
+
+	mics := 0
+	for _, input := range rider.Inputs {
+		if input.Kind == riderInputMic {
+			mics++
+		}
+	}
+	hour.Inputs = max(hour.Inputs, len(rider.Inputs))
+	hour.Mics = max(hour.Mics, mics)
+
+	// the same item can be listed more than once, so add up what this performance needs first
+	needed := map[string]*EquipmentTotal{}
+	keys := []string{}
+	for _, e := range rider.Equipment {
+		key := strings.ToLower(e.Item) + "\x00" + e.Category + "\x00" + e.ProvidedBy
+		if total, ok := needed[key]; ok {
+			total.Quantity += e.Quantity
+			continue
+		}
+		needed[key] = &EquipmentTotal{Item: e.Item, Category: e.Category, ProvidedBy: e.ProvidedBy, Quantity: e.Quantity, Performances: 1}
+		keys = append(keys, key)
+	}
+
+	for _, key := range keys {
+		total := equipmentTotalFor(hour, needed[key])
+		if total == nil {
+			hour.Equipment = append(hour.Equipment, needed[key])
+			continue
+		}
+		total.Quantity = max(total.Quantity, needed[key].Quantity)
+		total.Performances++
+	}
+}
+
+// returns the hour's total for the same item as e, or nil if nothing in the hour has needed it yet
+func equipmentTotalFor(hour *EquipmentHour, e *EquipmentTotal) *EquipmentTotal {
+	for _, total := range hour.Equipment {
+		if strings.EqualFold(total.Item, e.Item) && total.Category == e.Category && total.ProvidedBy == e.ProvidedBy {
+			return total
+		}
+	}
+	return nil
+}
+
+// trims the rider's text, lower cases its kinds and fills in the defaults
+func normaliseRider(rider *TechRider) {
+	rider.Notes = strings.TrimSpace(rider.Notes)
+	if rider.Inputs == nil {
+		rider.Inputs = []*RiderInput{}
+	}
+	if rider.Equipment == nil {
+		rider.Equipment = []*RiderEquipment{}
+	}
+	if rider.Files == nil {
+		rider.Files = []*RiderFile{}
+	}
+
+	for i, input := range rider.Inputs {
+		if input.Channel == 0 {
+			input.Channel = i + 1
+		}
+		input.Name = strings.TrimSpace(input.Name)
+		input.Kind = strings.ToLower(strings.TrimSpace(input.Kind))
+		input.Notes = strings.TrimSpace(input.Notes)
+	}
+
+	for _, e := range rider.Equipment {
+		e.Item = strings.TrimSpace(e.Item)
+		e.Category = strings.ToLower(strings.TrimSpace(e.Category))
+		if e.Quantity == 0 {
+			e.Quantity = 1
+		}
+		e.ProvidedBy = strings.ToLower(strings.TrimSpace(e.ProvidedBy))
+		if e.ProvidedBy == "" {
+			e.ProvidedBy = providedByFestival
+		}
+		e.Notes = strings.TrimSpace(e.Notes)
+	}
+
+	for _, f := range rider.Files {
+		f.Name = strings.TrimSpace(f.Name)
+		f.Url = strings.TrimSpace(f.Url)
+	}
+}
+
+// GET /performances/:id/rider - returns the tech rider of the performance with the specified id
+func (api *API) GetRider(w http.ResponseWriter, r *http.Request) {
+	id, err := api.extractId(r.URL.Path)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	rider, err := api.wrapper.GetRider(id)
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Unable to find rider")
+		return
+	}
+	if rider == nil {
+		api.respondError(w, http.StatusNotFound, "Rider Not Found")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, rider)
+}
+
+// PUT /performances/:id/rider - replaces the tech rider of the performance with the specified id
+func (api *API) SaveRider(w http.ResponseWriter, r *http.Request) {
+	var rider TechRider
+
+	err := json.NewDecoder(r.Body).Decode(&rider)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	id, err := api.extractId(r.URL.Path)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid ID provided")
+		return
+	}
+
+	saved, err := api.wrapperFor(r).SaveRider(id, &rider)
+	if api.respondIfInvalid(w, err) {
+		return
+	}
+	if err == sql.ErrNoRows {
+		api.respondError(w, http.StatusNotFound, "Performance Not Found")
+		return
+	}
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Error saving rider")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, saved)
+}
+
+// DELETE /performances/:id/rider - deletes the tech rider of the performance with the specified id
+func (api *API) DeleteRider(w http.ResponseWriter, r *http.Request) {
+	id, err := api.extractId(r.URL.Path)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid ID provided")
+		return
+	}
+
+	err = api.wrapperFor(r).DeleteRider(id)
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Error deleting rider")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// GET /locations/:id/equipment - returns what the location needs for each hour something is on
+// there. the location can be given as name:<name> instead of id, and ?editionId= only looks at one
+// edition
+func (api *API) GetLocationEquipment(w http.ResponseWriter, r *http.Request) {
+	location, ok := api.locationFromPath(w, r)
+	if !ok {
+		return
+	}
+	editionId, ok := api.reportEditionId(w, r)
+	if !ok {
+		return
+	}
+
+	hours, err := api.wrapper.GetLocationEquipment(location.Id, editionId)
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Unable to total equipment")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, map[string]interface{}{"location": location, "hours": hours})
+}
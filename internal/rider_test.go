@@ -0,0 +1,213 @@
+package internal_test
+
+import (
+	"encoding/json"
+	internal "foc_api/internal"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaveRiderReplacesTheRider(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	p, err := dbw.CreatePerformance(getTestPerformance())
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+
+	rider := &internal.TechRider{
+		Inputs: []*internal.RiderInput{
+			{Channel: 2, Name: "Vocal", Kind: "MIC"},
+			{Channel: 1, Name: "Keys", Kind: "di"},
+		},
+		Equipment: []*internal.RiderEquipment{
+			{Item: " Guitar amp ", Category: "backline"},
+			{Item: "Pedalboard", Category: "other", Quantity: 2, ProvidedBy: "act"},
+		},
+		Files: []*internal.RiderFile{{Name: "Stage plot", Url: "https://example.com/plot.pdf"}},
+	}
+
+	// act
+	_, err = dbw.SaveRider(p.Id, rider)
+	require.NoError(t, err, "SaveRider() failed: %v", err)
+	saved, err := dbw.GetRider(p.Id)
+	require.NoError(t, err, "GetRider() failed: %v", err)
+
+	_, err = dbw.SaveRider(p.Id, &internal.TechRider{Notes: "Just a laptop"})
+	require.NoError(t, err, "SaveRider() failed: %v", err)
+	replaced, err := dbw.GetRider(p.Id)
+	require.NoError(t, err, "GetRider() failed: %v", err)
+
+	require.NoError(t, dbw.DeleteRider(p.Id))
+	deleted, err := dbw.GetRider(p.Id)
+	require.NoError(t, err, "GetRider() failed: %v", err)
+
+	// assert
+	require.NotNil(t, saved)
+	require.Len(t, saved.Inputs, 2)
+	assert.Equal(t, "Keys", saved.Inputs[0].Name, "Inputs should be in channel order")
+	assert.Equal(t, "mic", saved.Inputs[1].Kind)
+	require.Len(t, saved.Equipment, 2)
+	assert.Equal(t, internal.RiderEquipment{Item: "Guitar amp", Category: "backline", Quantity: 1, ProvidedBy: "festival"}, *saved.Equipment[0])
+	assert.Equal(t, "act", saved.Equipment[1].ProvidedBy)
+	require.Len(t, saved.Files, 1)
+
+	require.NotNil(t, replaced)
+	assert.Empty(t, replaced.Inputs, "Saving should replace the whole rider")
+	assert.Empty(t, replaced.Equipment)
+	assert.Equal(t, "Just a laptop", replaced.Notes)
+
+	assert.Nil(t, deleted)
+}
+
+func TestSaveRiderValidation(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	p, err := dbw.CreatePerformance(getTestPerformance())
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+
+	rider := &internal.TechRider{
+		Inputs: []*internal.RiderInput{
+			{Channel: 1, Name: "Kick", Kind: "mic"},
+			{Channel: 1, Name: "Snare", Kind: "theremin"},
+		},
+		Equipment: []*internal.RiderEquipment{{Item: "Monitor", Category: "audio", Quantity: -1}},
+		Files:     []*internal.RiderFile{{Name: "Backing track", Url: "ftp://example.com/track.wav"}},
+	}
+
+	// act
+	_, err = dbw.SaveRider(p.Id, rider)
+
+	// assert
+	var validationErr *internal.ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	fields := []string{}
+	for _, fieldErr := range validationErr.Errors {
+		fields = append(fields, fieldErr.Field)
+	}
+	assert.ElementsMatch(t, []string{"inputs[1].kind", "inputs[1].channel", "equipment[0].quantity", "files[0].url"}, fields)
+
+	stored, err := dbw.GetRider(p.Id)
+	require.NoError(t, err, "GetRider() failed: %v", err)
+	assert.Nil(t, stored, "An invalid rider shouldn't be saved")
+}
+
+func TestLocationEquipmentTotalsEachHour(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+	api := internal.NewAPI(dbw)
+
+	start := time.Date(2025, 9, 1, 18, 0, 0, 0, time.UTC)
+	first := createTestPerformance(t, dbw, "Act One", "Main Stage", start, 45*time.Minute)
+	second := createTestPerformance(t, dbw, "Act Two", "Main Stage", start.Add(45*time.Minute), 45*time.Minute)
+	third := createTestPerformance(t, dbw, "Act Three", "Main Stage", start.Add(90*time.Minute), 30*time.Minute)
+	side := createTestPerformance(t, dbw, "Side Act", "Side Stage", start, time.Hour)
+
+	_, err := dbw.SaveRider(first.Id, &internal.TechRider{
+		Inputs: []*internal.RiderInput{{Name: "Vocal", Kind: "mic"}, {Name: "Guitar", Kind: "mic"}, {Name: "Keys", Kind: "di"}},
+		Equipment: []*internal.RiderEquipment{
+			{Item: "Guitar amp", Category: "backline", Quantity: 2},
+			{Item: "Drum kit", Category: "backline"},
+		},
+	})
+	require.NoError(t, err, "SaveRider() failed: %v", err)
+	_, err = dbw.SaveRider(second.Id, &internal.TechRider{
+		Inputs: []*internal.RiderInput{{Name: "Lead", Kind: "mic"}, {Name: "Harmony", Kind: "mic"}, {Name: "Choir", Kind: "mic"}},
+		Equipment: []*internal.RiderEquipment{
+			{Item: "guitar amp", Category: "backline"},
+			{Item: "Follow spot", Category: "lighting"},
+		},
+	})
+	require.NoError(t, err, "SaveRider() failed: %v", err)
+	_, err = dbw.SaveRider(side.Id, &internal.TechRider{
+		Equipment: []*internal.RiderEquipment{{Item: "Guitar amp", Category: "backline", Quantity: 4}},
+	})
+	require.NoError(t, err, "SaveRider() failed: %v", err)
+
+	r := httptest.NewRequest("GET", "/locations/name:Main%20Stage/equipment", nil)
+	w := httptest.NewRecorder()
+
+	// act
+	api.LocationHandler(w, r)
+
+	// assert
+	require.Equal(t, http.StatusOK, w.Code, "LocationHandler() returned status %v", w.Code)
+	var response struct {
+		Location *internal.Location        `json:"location"`
+		Hours    []*internal.EquipmentHour `json:"hours"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	assert.Equal(t, "Main Stage", response.Location.Name)
+	require.Len(t, response.Hours, 2)
+
+	hour := response.Hours[0]
+	assert.True(t, start.Equal(hour.Start))
+	assert.Equal(t, []int{first.Id, second.Id}, hour.PerformanceIds)
+	assert.Empty(t, hour.WithoutRider)
+	assert.Equal(t, 3, hour.Inputs)
+	assert.Equal(t, 3, hour.Mics, "Mics needed at once should be the most any one act needs")
+	require.Len(t, hour.Equipment, 3)
+	assert.Equal(t, internal.EquipmentTotal{Item: "Guitar amp", Category: "backline", ProvidedBy: "festival", Quantity: 2, Performances: 2}, *hour.Equipment[0])
+	assert.Equal(t, "Follow spot", hour.Equipment[2].Item)
+
+	hour = response.Hours[1]
+	assert.Equal(t, []int{second.Id, third.Id}, hour.PerformanceIds)
+	assert.Equal(t, []int{third.Id}, hour.WithoutRider)
+	assert.Equal(t, 1, hour.Equipment[0].Quantity, "Only the acts on in the hour should count")
+}
+
+func TestRiderEndpoints(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+	api := internal.NewAPI(dbw)
+
+	_, err := dbw.CreatePerformance(getTestPerformance())
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+
+	cases := []struct {
+		method, path, body string
+		expected           int
+	}{
+		{"GET", "/performances/1/rider", "", http.StatusNotFound},
+		{"PUT", "/performances/1/rider", `{"inputs": [{"name": "Vocal", "kind": "mic"}]}`, http.StatusOK},
+		{"PUT", "/performances/1/rider", `{"files": [{"name": "Plot"}]}`, http.StatusUnprocessableEntity},
+		{"PUT", "/performances/99/rider", `{}`, http.StatusNotFound},
+		{"GET", "/performances/1/rider", "", http.StatusOK},
+		{"GET", "/locations/99/equipment", "", http.StatusNotFound},
+		{"DELETE", "/performances/1/rider", "", http.StatusOK},
+		{"GET", "/performances/1", "", http.StatusOK},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest(c.method, c.path, strings.NewReader(c.body))
+		w := httptest.NewRecorder()
+
+		// act
+		if strings.HasPrefix(c.path, "/locations") {
+			api.LocationHandler(w, r)
+		} else {
+			api.PerformanceHandler(w, r)
+		}
+
+		// assert
+		assert.Equal(t, c.expected, w.Code, "%s %s %s returned the wrong status", c.method, c.path, c.body)
+	}
+
+	p, err := dbw.GetPerformanceById(1)
+	require.NoError(t, err, "GetPerformanceById() failed: %v", err)
+	assert.NotNil(t, p, "Deleting the rider shouldn't delete the performance")
+}
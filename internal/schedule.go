@@ -0,0 +1,426 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// a stretch of time a location is available for performances
+type ScheduleWindow struct {
+	// the location is given by id or by name
+	LocationId int       `json:"locationId"`
+	Location   string    `json:"location"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+}
+
+// what the running order generator should schedule, and where
+type ScheduleRequest struct {
+	Windows []*ScheduleWindow `json:"windows"`
+	// minimum gap in minutes between two performances at the same location
+	ChangeoverMinutes int `json:"changeoverMinutes"`
+	// limits the run to these performances. every unscheduled performance is used when it's empty
+	PerformanceIds []int `json:"performanceIds"`
+	// the edition being scheduled. defaults to the current edition, if there is one
+	EditionId int `json:"editionId"`
+}
+
+// where and when the generator put a performance
+type ScheduleSlot struct {
+	PerformanceId int       `json:"performanceId"`
+	ItemName      string    `json:"itemName"`
+	LocationId    int       `json:"locationId"`
+	Location      string    `json:"location"`
+	StartTime     time.Time `json:"startTime"`
+	EndTime       time.Time `json:"endTime"`
+}
+
+// a performance the generator couldn't find a slot for, and why
+type UnplacedPerformance struct {
+	PerformanceId int    `json:"performanceId"`
+	ItemName      string `json:"itemName"`
+	Reason        string `json:"reason"`
+}
+
+// a running order, either proposed or applied
+type Schedule struct {
+	Applied  bool                   `json:"applied"`
+	Slots    []*ScheduleSlot        `json:"slots"`
+	Unplaced []*UnplacedPerformance `json:"unplaced"`
+}
+
+// a period of time nothing else can be booked into
+type busyPeriod struct {
+	start, end time.Time
+}
+
+// the bookings the generator has to work around, which grow as it places performances
+type scheduleState struct {
+	byLocation  map[int][]busyPeriod
+	byPerformer map[int][]busyPeriod
+	// gap needed between performances at the same location
+	changeover time.Duration
+	// gap needed between performances of the same performer
+	buffer time.Duration
+}
+
+func (s *scheduleState) book(p *Performance, performerIds []int) {
+	s.byLocation[p.LocationId] = append(s.byLocation[p.LocationId], busyPeriod{p.StartTime.Add(-s.changeover), p.EndTime.Add(s.changeover)})
+	for _, id := range performerIds {
+		s.byPerformer[id] = append(s.byPerformer[id], busyPeriod{p.StartTime.Add(-s.buffer), p.EndTime.Add(s.buffer)})
+	}
+}
+
+// returns the earliest start inside window at which a performance of the given length is clear of
+// everything booked at the window's location and everything its performers are booked into
+func (s *scheduleState) earliestStart(window *ScheduleWindow, length time.Duration, performerIds []int) (time.Time, bool) {
+	busy := append([]busyPeriod{}, s.byLocation[window.LocationId]...)
+	for _, id := range performerIds {
+		busy = append(busy, s.byPerformer[id]...)
+	}
+
+	// the earliest start is either the start of the window or just as something busy ends
+	starts := []time.Time{window.Start}
+	for _, b := range busy {
+		if b.end.After(window.Start) && b.end.Before(window.End) {
+			starts = append(starts, b.end)
+		}
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i].Before(starts[j]) })
+
+	for _, start := range starts {
+		end := start.Add(length)
+		if end.After(window.End) {
+			break
+		}
+
+		clear := true
+		for _, b := range busy {
+			if start.Before(b.end) && b.start.Before(end) {
+				clear = false
+				break
+			}
+		}
+		if clear {
+			return start, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Works out a running order for the unscheduled performances, fitting each into the earliest slot
+// in the windows that keeps clear of its location's other performances and its performers' other
+// bookings. the same request against the same data always gives the same running order. nothing
+// is saved unless apply is set, but either way the slots are checked exactly as if they were
+func (dbw *DBWrapper) GenerateSchedule(req *ScheduleRequest, apply bool) (*Schedule, error) {
+	schedule := &Schedule{Applied: apply, Slots: []*ScheduleSlot{}, Unplaced: []*UnplacedPerformance{}}
+
+	err := dbw.inTransaction(func(tx *DBWrapper) error {
+		edition, err := tx.scheduleEdition(req)
+		if err != nil {
+			return err
+		}
+
+		windows, err := tx.resolveScheduleWindows(req, edition)
+		if err != nil {
+			return err
+		}
+
+		candidates, err := tx.scheduleCandidates(req, edition, schedule)
+		if err != nil {
+			return err
+		}
+
+		state, err := tx.loadScheduleState(req)
+		if err != nil {
+			return err
+		}
+
+		// place the hardest performances first, while there's still the most room: the ones with
+		// the most performers, then the longest, then in id order so ties always go the same way
+		performerIds := map[int][]int{}
+		for _, p := range candidates {
+			performers, err := tx.GetPerformersByPerformanceId(p.Id)
+			if err != nil {
+				return err
+			}
+			for _, performer := range performers {
+				performerIds[p.Id] = append(performerIds[p.Id], performer.Id)
+			}
+		}
+		sort.SliceStable(candidates, func(i, j int) bool {
+			a, b := candidates[i], candidates[j]
+			if len(performerIds[a.Id]) != len(performerIds[b.Id]) {
+				return len(performerIds[a.Id]) > len(performerIds[b.Id])
+			}
+			if a.Duration != b.Duration {
+				return a.Duration > b.Duration
+			}
+			return a.Id < b.Id
+		})
+
+		for _, p := range candidates {
+			slot, reason := state.place(p, windows, performerIds[p.Id])
+			if slot == nil {
+				schedule.Unplaced = append(schedule.Unplaced, &UnplacedPerformance{PerformanceId: p.Id, ItemName: p.ItemName, Reason: reason})
+				continue
+			}
+
+			// saved through the normal update so it's validated, checked and audited like any other change
+			p.LocationId = slot.LocationId
+			p.Location = slot.Location
+			p.StartTime = slot.StartTime
+			p.EndTime = slot.EndTime
+			// nothing else can change it mid-transaction, so there's no version to check against
+			p.Version = anyVersion
+			err = tx.UpdatePerformanceById(p.Id, p)
+			if err != nil {
+				return err
+			}
+			schedule.Slots = append(schedule.Slots, slot)
+		}
+		return nil
+	}, apply)
+	if err != nil {
+		return nil, err
+	}
+
+	return schedule, nil
+}
+
+// finds the earliest slot for p across the windows it can go in, or explains why there isn't one
+func (s *scheduleState) place(p *Performance, windows []*ScheduleWindow, performerIds []int) (*ScheduleSlot, string) {
+	if p.Duration <= 0 {
+		return nil, "performance has no duration"
+	}
+	length := time.Duration(p.Duration) * time.Second
+
+	var best *ScheduleSlot
+	var bestWindow *ScheduleWindow
+	eligible := false
+	for _, window := range windows {
+		// performances already given a location can only go there
+		if p.LocationId != 0 && window.LocationId != p.LocationId {
+			continue
+		}
+		eligible = true
+
+		start, ok := s.earliestStart(window, length, performerIds)
+		if !ok {
+			continue
+		}
+		if best == nil || start.Before(best.StartTime) {
+			best = &ScheduleSlot{PerformanceId: p.Id, ItemName: p.ItemName, LocationId: window.LocationId, Location: window.Location, StartTime: start, EndTime: start.Add(length)}
+			bestWindow = window
+		}
+	}
+
+	if !eligible {
+		return nil, fmt.Sprintf("no window was given for %s", p.Location)
+	}
+	if best == nil {
+		return nil, "no window has room for it"
+	}
+
+	placed := *p
+	placed.LocationId = bestWindow.LocationId
+	placed.StartTime = best.StartTime
+	placed.EndTime = best.EndTime
+	s.book(&placed, performerIds)
+	return best, ""
+}
+
+// returns the edition being scheduled, or nil if the request doesn't name one and none is current
+func (dbw *DBWrapper) scheduleEdition(req *ScheduleRequest) (*Edition, error) {
+	if req.EditionId == 0 {
+		return dbw.GetCurrentEdition()
+	}
+
+	edition, err := dbw.GetEditionById(req.EditionId)
+	if err != nil {
+		return nil, err
+	}
+	if edition == nil {
+		v := &validator{}
+		v.add("editionId", validationInvalid, "is not a known edition")
+		return nil, v.err()
+	}
+	return edition, nil
+}
+
+// points every window at its location and puts its times in utc, keeping them inside the festival
+// and the edition being scheduled
+func (dbw *DBWrapper) resolveScheduleWindows(req *ScheduleRequest, edition *Edition) ([]*ScheduleWindow, error) {
+	v := &validator{}
+	if len(req.Windows) == 0 {
+		v.add("windows", validationRequired, "at least one window is needed")
+	}
+	if req.ChangeoverMinutes < 0 {
+		v.add("changeoverMinutes", validationInvalid, "cannot be negative")
+	}
+
+	rules := dbw.validationRules
+	windows := []*ScheduleWindow{}
+	for i, w := range req.Windows {
+		field := fmt.Sprintf("windows[%d]", i)
+
+		var location *Location
+		var err error
+		if w.LocationId != 0 {
+			location, err = dbw.GetLocationById(w.LocationId)
+		} else {
+			location, err = dbw.GetLocationByName(w.Location)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if location == nil {
+			v.add(field+".location", validationInvalid, "is not a known location")
+			continue
+		}
+
+		window := &ScheduleWindow{LocationId: location.Id, Location: location.Name, Start: w.Start.UTC(), End: w.End.UTC()}
+		if !rules.FestivalStart.IsZero() && window.Start.Before(rules.FestivalStart) {
+			window.Start = rules.FestivalStart
+		}
+		if !rules.FestivalEnd.IsZero() && window.End.After(rules.FestivalEnd) {
+			window.End = rules.FestivalEnd
+		}
+		if edition != nil && !edition.StartTime.IsZero() && window.Start.Before(edition.StartTime) {
+			window.Start = edition.StartTime
+		}
+		if edition != nil && !edition.EndTime.IsZero() && window.End.After(edition.EndTime) {
+			window.End = edition.EndTime
+		}
+
+		if w.Start.IsZero() || w.End.IsZero() {
+			v.add(field, validationRequired, "needs a start and an end")
+			continue
+		}
+		if !window.End.After(window.Start) {
+			v.add(field+".end", validationInvalid, "must be after start, and inside the festival")
+			continue
+		}
+		windows = append(windows, window)
+	}
+
+	// windows are tried in time order, so an earlier window always wins a tie
+	sort.SliceStable(windows, func(i, j int) bool { return windows[i].Start.Before(windows[j].Start) })
+	return windows, v.err()
+}
+
+// returns the performances to schedule, adding any of the requested ones that can't be to unplaced
+func (dbw *DBWrapper) scheduleCandidates(req *ScheduleRequest, edition *Edition, schedule *Schedule) ([]*Performance, error) {
+	if len(req.PerformanceIds) == 0 {
+		all, err := dbw.GetAllPerformances()
+		if err != nil {
+			return nil, err
+		}
+
+		candidates := []*Performance{}
+		for _, p := range all {
+			// leftovers from other editions aren't part of this running order
+			if !isScheduled(p) && (edition == nil || p.EditionId == edition.Id) {
+				candidates = append(candidates, p)
+			}
+		}
+		return candidates, nil
+	}
+
+	candidates := []*Performance{}
+	seen := map[int]bool{}
+	for _, id := range req.PerformanceIds {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		p, err := dbw.GetPerformanceById(id)
+		if err != nil {
+			return nil, err
+		}
+		if p == nil {
+			schedule.Unplaced = append(schedule.Unplaced, &UnplacedPerformance{PerformanceId: id, Reason: "performance not found"})
+			continue
+		}
+		if isScheduled(p) {
+			schedule.Unplaced = append(schedule.Unplaced, &UnplacedPerformance{PerformanceId: id, ItemName: p.ItemName, Reason: "performance is already scheduled"})
+			continue
+		}
+		if edition != nil && p.EditionId != edition.Id {
+			schedule.Unplaced = append(schedule.Unplaced, &UnplacedPerformance{PerformanceId: id, ItemName: p.ItemName, Reason: "performance is in another edition"})
+			continue
+		}
+		candidates = append(candidates, p)
+	}
+	return candidates, nil
+}
+
+// books in everything that's already scheduled, so new slots are fitted around it
+func (dbw *DBWrapper) loadScheduleState(req *ScheduleRequest) (*scheduleState, error) {
+	state := &scheduleState{
+		byLocation:  map[int][]busyPeriod{},
+		byPerformer: map[int][]busyPeriod{},
+		changeover:  time.Duration(req.ChangeoverMinutes) * time.Minute,
+		buffer:      dbw.changeoverBuffer,
+	}
+
+	all, err := dbw.GetAllPerformances()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range all {
+		if !isScheduled(p) {
+			continue
+		}
+
+		performers, err := dbw.GetPerformersByPerformanceId(p.Id)
+		if err != nil {
+			return nil, err
+		}
+		performerIds := []int{}
+		for _, performer := range performers {
+			performerIds = append(performerIds, performer.Id)
+		}
+		state.book(p, performerIds)
+	}
+	return state, nil
+}
+
+// Handles requests related to building the running order
+func (api *API) ScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		if r.URL.Path == "/schedule/generate" {
+			api.GenerateSchedule(w, r)
+		} else {
+			api.respondError(w, http.StatusNotFound, "Not Found")
+		}
+	}
+}
+
+// POST /schedule/generate - proposes a running order for the unscheduled performances.
+// ?apply=true saves it as well
+func (api *API) GenerateSchedule(w http.ResponseWriter, r *http.Request) {
+	var req ScheduleRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		api.respondError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	schedule, err := api.wrapperFor(r).GenerateSchedule(&req, queryFlag(r, "apply"))
+	if api.respondIfInvalid(w, err) || api.respondIfConflict(w, err) || api.respondIfLocationClash(w, err) {
+		return
+	}
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Unable to generate schedule")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, schedule)
+}
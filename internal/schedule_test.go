@@ -0,0 +1,145 @@
+package internal_test
+
+import (
+	internal "foc_api/internal"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateSchedulePreviewsWithoutSaving(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	opening := time.Date(2025, 9, 1, 18, 0, 0, 0, time.UTC)
+	first := createTestPerformance(t, dbw, "Take Five", "Main Stage", time.Time{}, 10*time.Minute)
+	second := createTestPerformance(t, dbw, "Clair de Lune", "Main Stage", time.Time{}, 5*time.Minute)
+	req := &internal.ScheduleRequest{
+		Windows:           []*internal.ScheduleWindow{{Location: "Main Stage", Start: opening, End: opening.Add(time.Hour)}},
+		ChangeoverMinutes: 5,
+	}
+
+	// act
+	preview, err := dbw.GenerateSchedule(req, false)
+	require.NoError(t, err, "GenerateSchedule() failed: %v", err)
+
+	stored, err := dbw.GetPerformanceById(first.Id)
+	require.NoError(t, err, "GetPerformanceById() failed: %v", err)
+
+	applied, err := dbw.GenerateSchedule(req, true)
+	require.NoError(t, err, "GenerateSchedule() failed: %v", err)
+
+	// assert
+	require.Len(t, preview.Slots, 2)
+	assert.Equal(t, first.Id, preview.Slots[0].PerformanceId, "Longest performance should be placed first")
+	assert.True(t, opening.Equal(preview.Slots[0].StartTime))
+	assert.Equal(t, second.Id, preview.Slots[1].PerformanceId)
+	assert.True(t, opening.Add(15*time.Minute).Equal(preview.Slots[1].StartTime), "Changeover should be left between performances")
+	assert.True(t, stored.StartTime.IsZero(), "Preview should not save anything")
+
+	assert.True(t, applied.Applied)
+	assert.Equal(t, preview.Slots, applied.Slots, "Applying should give the same running order as the preview")
+
+	stored, err = dbw.GetPerformanceById(second.Id)
+	require.NoError(t, err, "GetPerformanceById() failed: %v", err)
+	assert.True(t, opening.Add(15*time.Minute).Equal(stored.StartTime), "Applied slot was not saved")
+	assert.True(t, opening.Add(20*time.Minute).Equal(stored.EndTime), "Applied slot was not saved")
+}
+
+func TestGenerateScheduleWorksAroundBookings(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	opening := time.Date(2025, 9, 1, 18, 0, 0, 0, time.UTC)
+	performer, err := dbw.CreatePerformer(getTestPerformer())
+	require.NoError(t, err, "CreatePerformer() failed: %v", err)
+
+	// the performer is already on the side stage for the first half hour
+	booked := createTestPerformance(t, dbw, "Side Stage Set", "Side Stage Set Stage", opening, 30*time.Minute)
+	require.NoError(t, dbw.CreateJunction(performer.Id, booked.Id))
+
+	solo := createTestPerformance(t, dbw, "Solo", "Main Stage", time.Time{}, 10*time.Minute)
+	require.NoError(t, dbw.CreateJunction(performer.Id, solo.Id))
+	noLength := createTestPerformance(t, dbw, "No Length", "Main Stage", time.Time{}, 0)
+
+	req := &internal.ScheduleRequest{
+		Windows: []*internal.ScheduleWindow{{Location: "Main Stage", Start: opening, End: opening.Add(time.Hour)}},
+	}
+
+	// act
+	schedule, err := dbw.GenerateSchedule(req, false)
+	require.NoError(t, err, "GenerateSchedule() failed: %v", err)
+
+	// assert
+	require.Len(t, schedule.Slots, 1)
+	assert.Equal(t, solo.Id, schedule.Slots[0].PerformanceId)
+	assert.True(t, opening.Add(30*time.Minute).Equal(schedule.Slots[0].StartTime), "Performer should not be double-booked")
+
+	require.Len(t, schedule.Unplaced, 1)
+	assert.Equal(t, noLength.Id, schedule.Unplaced[0].PerformanceId)
+	assert.Equal(t, "performance has no duration", schedule.Unplaced[0].Reason)
+}
+
+func TestGenerateScheduleEndpointRejectsInvalidWindows(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	api := internal.NewAPI(internal.CreateDBWrapper(db))
+
+	body := `{"windows": [{"location": "Nowhere", "start": "2025-09-01T18:00:00Z", "end": "2025-09-01T19:00:00Z"}]}`
+	r := httptest.NewRequest("POST", "/schedule/generate", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	// act
+	api.ScheduleHandler(w, r)
+
+	// assert
+	require.Equal(t, http.StatusUnprocessableEntity, w.Code, "ScheduleHandler() returned status %v", w.Code)
+	assert.Equal(t, map[string]string{"windows[0].location": "invalid"}, decodeFieldErrors(t, w))
+}
+
+func TestGenerateScheduleLeavesOtherEditionsAlone(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	opening := time.Date(2025, 9, 1, 18, 0, 0, 0, time.UTC)
+	_, err := dbw.CreateEdition(&internal.Edition{Name: "2024", Current: true})
+	require.NoError(t, err, "CreateEdition() failed: %v", err)
+	leftover := createTestPerformance(t, dbw, "Never Scheduled", "Main Stage", time.Time{}, 10*time.Minute)
+
+	_, err = dbw.CreateEdition(&internal.Edition{Name: "2025", StartTime: opening, Current: true})
+	require.NoError(t, err, "CreateEdition() failed: %v", err)
+	fresh := createTestPerformance(t, dbw, "This Year", "Main Stage", time.Time{}, 10*time.Minute)
+
+	// the window opens before the edition does
+	req := &internal.ScheduleRequest{
+		Windows: []*internal.ScheduleWindow{{Location: "Main Stage", Start: opening.Add(-time.Hour), End: opening.Add(time.Hour)}},
+	}
+
+	// act
+	schedule, err := dbw.GenerateSchedule(req, false)
+	require.NoError(t, err, "GenerateSchedule() failed: %v", err)
+
+	req.PerformanceIds = []int{leftover.Id}
+	explicit, err := dbw.GenerateSchedule(req, false)
+	require.NoError(t, err, "GenerateSchedule() failed: %v", err)
+
+	// assert
+	require.Len(t, schedule.Slots, 1)
+	assert.Equal(t, fresh.Id, schedule.Slots[0].PerformanceId)
+	assert.True(t, opening.Equal(schedule.Slots[0].StartTime), "Window should be kept inside the edition")
+
+	require.Len(t, explicit.Unplaced, 1)
+	assert.Equal(t, "performance is in another edition", explicit.Unplaced[0].Reason)
+}
@@ -0,0 +1,179 @@
+package internal
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	searchEntityPerformance = "performance"
+	searchEntityPerformer   = "performer"
+
+	// how many results a search returns when no limit is given
+	defaultSearchLimit = 20
+)
+
+// a single match from the search index
+type SearchResult struct {
+	Type  string `json:"type"`
+	Id    int    `json:"id"`
+	Title string `json:"title"`
+	// the best matching part of the row, with matches wrapped in <mark></mark>
+	Snippet string `json:"snippet"`
+	// lower is a better match
+	Rank float64 `json:"rank"`
+}
+
+// brings the search index entry for a performance in line with the performances table,
+// removing it if the performance has been deleted
+func (dbw *DBWrapper) reindexPerformance(id int) error {
+	_, err := dbw.db.Exec(`DELETE FROM search_index WHERE entity = ? AND entityId = ?`, searchEntityPerformance, id)
+	if err != nil {
+		return err
+	}
+
+	dbQuery := `
+		INSERT INTO search_index (entity, entityId, name, genre, groupName)
+		SELECT ?, id, itemName, genreName, groupName
+		FROM performances
+		WHERE id = ? AND deleted = 0
+	`
+	_, err = dbw.db.Exec(dbQuery, searchEntityPerformance, id)
+	return err
+}
+
+// brings the search index entry for a performer in line with the performers table,
+// removing it if the performer has been deleted
+func (dbw *DBWrapper) reindexPerformer(id int) error {
+	_, err := dbw.db.Exec(`DELETE FROM search_index WHERE entity = ? AND entityId = ?`, searchEntityPerformer, id)
+	if err != nil {
+		return err
+	}
+
+	dbQuery := `
+		INSERT INTO search_index (entity, entityId, name, genre, groupName)
+		SELECT ?, id, name, '', ''
+		FROM performers
+		WHERE id = ? AND deleted = 0
+	`
+	_, err = dbw.db.Exec(dbQuery, searchEntityPerformer, id)
+	return err
+}
+
+// throws away the search index and builds it again from scratch
+func (dbw *DBWrapper) rebuildSearchIndex() error {
+	return rebuildSearchIndex(dbw.db)
+}
+
+func rebuildSearchIndex(db dbConn) error {
+	statements := []string{
+		`DELETE FROM search_index`,
+		`INSERT INTO search_index (entity, entityId, name, genre, groupName)
+			SELECT '` + searchEntityPerformance + `', id, itemName, genreName, groupName FROM performances WHERE deleted = 0`,
+		`INSERT INTO search_index (entity, entityId, name, genre, groupName)
+			SELECT '` + searchEntityPerformer + `', id, name, '', '' FROM performers WHERE deleted = 0`,
+	}
+
+	for _, statement := range statements {
+		_, err := db.Exec(statement)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// turns what the user typed into an fts5 query that matches every word as a prefix.
+// each word is quoted so characters like - and * can't be read as fts5 syntax
+func buildSearchQuery(text string) string {
+	terms := []string{}
+	for _, word := range strings.Fields(text) {
+		word = strings.ReplaceAll(word, `"`, "")
+		if word == "" {
+			continue
+		}
+		terms = append(terms, `"`+word+`"*`)
+	}
+	return strings.Join(terms, " ")
+}
+
+// returns the best matches for text across performances and performers.
+// entity restricts the results to one type when it isn't blank
+func (dbw *DBWrapper) Search(text, entity string, limit int) ([]*SearchResult, error) {
+	results := []*SearchResult{}
+
+	match := buildSearchQuery(text)
+	if match == "" {
+		return results, nil
+	}
+
+	dbQuery := `
+		SELECT entity, entityId, name, snippet(search_index, -1, '<mark>', '</mark>', '…', 12), rank
+		FROM search_index
+		WHERE search_index MATCH ? AND (? = '' OR entity = ?)
+		ORDER BY rank
+		LIMIT ?
+	`
+
+	rows, err := dbw.db.Query(dbQuery, match, entity, entity, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		result := &SearchResult{}
+		err := rows.Scan(&result.Type, &result.Id, &result.Title, &result.Snippet, &result.Rank)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+
+	return results, rows.Err()
+}
+
+// Handles requests related to searching
+func (api *API) SearchHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		api.Search(w, r)
+	}
+}
+
+// GET /search?q=:text - returns performances and performers matching text, best first.
+// &type=performance or &type=performer narrows the results, and &limit caps them
+func (api *API) Search(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	text := strings.TrimSpace(params.Get("q"))
+	if text == "" {
+		api.respondError(w, http.StatusBadRequest, "Search query cannot be blank")
+		return
+	}
+
+	entity := params.Get("type")
+	if entity != "" && entity != searchEntityPerformance && entity != searchEntityPerformer {
+		api.respondError(w, http.StatusBadRequest, "type must be performance or performer")
+		return
+	}
+
+	limit := defaultSearchLimit
+	if value := params.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxPageLimit {
+			api.respondError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		limit = parsed
+	}
+
+	results, err := api.wrapper.Search(text, entity, limit)
+	if err != nil {
+		api.respondError(w, http.StatusInternalServerError, "Search failed")
+		return
+	}
+
+	api.respondJSON(w, http.StatusOK, map[string][]*SearchResult{"results": results})
+}
@@ -0,0 +1,100 @@
+package internal_test
+
+import (
+	"encoding/json"
+	internal "foc_api/internal"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchAcrossPerformancesAndPerformers(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	jazzItem, err := dbw.CreatePerformance(&internal.Performance{ItemName: "Jazz Standards", GenreName: "Swing", GroupName: "Big Band"})
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+	jazzGenre, err := dbw.CreatePerformance(&internal.Performance{ItemName: "Take Five", GenreName: "Jazz", GroupName: "Quartet"})
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+	_, err = dbw.CreatePerformance(&internal.Performance{ItemName: "Thunderstruck", GenreName: "Rock", GroupName: "The Amps"})
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+	jazzPerformer, err := dbw.CreatePerformer(&internal.Performer{Name: "Jazmine Jazzington", Email: "jj@test.com"})
+	require.NoError(t, err, "CreatePerformer() failed: %v", err)
+
+	// act
+	results, err := dbw.Search("jazz", "", 10)
+
+	// assert
+	require.NoError(t, err, "Search() failed: %v", err)
+	require.Len(t, results, 3)
+
+	found := map[string]int{}
+	for _, result := range results {
+		found[result.Type+":"+result.Title] = result.Id
+		assert.Contains(t, result.Snippet, "<mark>", "Snippet not highlighted")
+	}
+	assert.Equal(t, jazzItem.Id, found["performance:Jazz Standards"])
+	assert.Equal(t, jazzGenre.Id, found["performance:Take Five"])
+	assert.Equal(t, jazzPerformer.Id, found["performer:Jazmine Jazzington"])
+}
+
+func TestSearchIndexFollowsUpdatesAndDeletes(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	performance, err := dbw.CreatePerformance(&internal.Performance{ItemName: "Clair de Lune", GenreName: "Classical"})
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+	performer, err := dbw.CreatePerformer(&internal.Performer{Name: "Claire", Email: "claire@test.com"})
+	require.NoError(t, err, "CreatePerformer() failed: %v", err)
+
+	// act
+	err = dbw.UpdatePerformanceById(performance.Id, &internal.Performance{ItemName: "Moonlight Sonata", GenreName: "Classical"})
+	require.NoError(t, err, "UpdatePerformanceById() failed: %v", err)
+	err = dbw.DeletePerformerById(performer.Id)
+	require.NoError(t, err, "DeletePerformerById() failed: %v", err)
+
+	// assert
+	results, err := dbw.Search("clair", "", 10)
+	require.NoError(t, err, "Search() failed: %v", err)
+	assert.Empty(t, results, "Stale entries left in the search index")
+
+	results, err = dbw.Search("moonlight", "", 10)
+	require.NoError(t, err, "Search() failed: %v", err)
+	require.Len(t, results, 1)
+	assert.Equal(t, performance.Id, results[0].Id)
+}
+
+func TestSearchEndpointHandlesQuerySyntax(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+	api := internal.NewAPI(dbw)
+
+	_, err := dbw.CreatePerformance(&internal.Performance{ItemName: "Hip-Hop Medley", GenreName: "Hip Hop"})
+	require.NoError(t, err, "CreatePerformance() failed: %v", err)
+
+	// characters that mean something to fts5 shouldn't break the search
+	r := httptest.NewRequest("GET", `/search?q=hip-hop+"medley&type=performance`, nil)
+	w := httptest.NewRecorder()
+
+	// act
+	api.SearchHandler(w, r)
+
+	// assert
+	require.Equal(t, http.StatusOK, w.Code, "SearchHandler() returned status %v: %s", w.Code, w.Body.String())
+
+	response := struct {
+		Results []*internal.SearchResult `json:"results"`
+	}{}
+	err = json.NewDecoder(w.Body).Decode(&response)
+	require.NoError(t, err, "Error decoding response from endpoint: %v", err)
+	assert.Len(t, response.Results, 1)
+}
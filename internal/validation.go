@@ -0,0 +1,308 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	minItemNameLength      = 2
+	maxItemNameLength      = 200
+	maxGenreNameLength     = 64
+	maxGroupNameLength     = 128
+	maxLocationLength      = 200
+	maxPerformerNameLength = 128
+	maxEditionNameLength   = 128
+	maxRoleLength          = 64
+	maxInstrumentLength    = 64
+	maxJunctionNotesLength = 1000
+	maxRiderItemLength     = 128
+	maxRiderNotesLength    = 1000
+	// more channels than any desk the festival hires
+	maxRiderChannel = 256
+	// the longest address smtp allows
+	maxEmailLength = 254
+)
+
+// codes the frontend can switch on, so it doesn't have to parse messages
+const (
+	validationRequired   = "required"
+	validationTooShort   = "too_short"
+	validationTooLong    = "too_long"
+	validationInvalid    = "invalid"
+	validationOutOfRange = "out_of_range"
+	validationNotAllowed = "not_allowed"
+)
+
+// a problem with a single field, named as it is in the json so it can be shown next to its input
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// returned when a performance or performer can't be saved as it is, listing every problem with it
+// rather than just the first
+type ValidationError struct {
+	Errors []*FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, fieldErr := range e.Errors {
+		messages[i] = fieldErr.Field + " " + fieldErr.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// festival-specific limits on what performances can be saved. zero values leave that check off
+type ValidationRules struct {
+	// performances can't start before FestivalStart or end after FestivalEnd
+	FestivalStart time.Time
+	FestivalEnd   time.Time
+	// the genres performances are allowed to have, matched ignoring case
+	AllowedGenres []string
+}
+
+// sets the festival-specific limits performances are checked against
+func (dbw *DBWrapper) SetValidationRules(rules ValidationRules) {
+	rules.FestivalStart = rules.FestivalStart.UTC()
+	rules.FestivalEnd = rules.FestivalEnd.UTC()
+	dbw.validationRules = rules
+}
+
+// collects field errors as checks are made
+type validator struct {
+	errors []*FieldError
+}
+
+func (v *validator) add(field, code, message string) {
+	v.errors = append(v.errors, &FieldError{Field: field, Code: code, Message: message})
+}
+
+// checks value isn't blank and is no longer than max characters
+func (v *validator) required(field, value string, max int) {
+	if strings.TrimSpace(value) == "" {
+		v.add(field, validationRequired, "cannot be blank")
+		return
+	}
+	v.maxLength(field, value, max)
+}
+
+func (v *validator) maxLength(field, value string, max int) {
+	if utf8.RuneCountInString(value) > max {
+		v.add(field, validationTooLong, fmt.Sprintf("must be at most %d characters", max))
+	}
+}
+
+// returns a ValidationError with everything collected, or nil if nothing was
+func (v *validator) err() error {
+	if len(v.errors) == 0 {
+		return nil
+	}
+	return &ValidationError{Errors: v.errors}
+}
+
+// checks p against the general rules for performances and the festival's own rules. p's times
+// are expected to already be normalised
+func (dbw *DBWrapper) validatePerformance(p *Performance) error {
+	v := &validator{}
+
+	v.required("itemName", p.ItemName, maxItemNameLength)
+	if strings.TrimSpace(p.ItemName) != "" && utf8.RuneCountInString(strings.TrimSpace(p.ItemName)) < minItemNameLength {
+		v.add("itemName", validationTooShort, fmt.Sprintf("must be at least %d characters", minItemNameLength))
+	}
+	v.maxLength("genreName", p.GenreName, maxGenreNameLength)
+	v.maxLength("groupName", p.GroupName, maxGroupNameLength)
+	v.maxLength("location", p.Location, maxLocationLength)
+
+	if p.GenreName != "" && len(dbw.validationRules.AllowedGenres) > 0 && !genreAllowed(p.GenreName, dbw.validationRules.AllowedGenres) {
+		v.add("genreName", validationNotAllowed, "must be one of "+strings.Join(dbw.validationRules.AllowedGenres, ", "))
+	}
+
+	// a scheduled performance's duration comes from its times, which are checked below
+	if p.Duration < 0 && !isScheduled(p) {
+		v.add("duration", validationInvalid, "cannot be negative")
+	}
+
+	// performances can be left unscheduled, but not half scheduled
+	switch {
+	case p.StartTime.IsZero() && !p.EndTime.IsZero():
+		v.add("startTime", validationRequired, "is required when endTime is set")
+	case !p.StartTime.IsZero() && p.EndTime.IsZero():
+		v.add("endTime", validationRequired, "is required when startTime is set, unless duration is")
+	case isScheduled(p):
+		if !p.EndTime.After(p.StartTime) {
+			v.add("endTime", validationInvalid, "must be after startTime")
+		}
+		rules := dbw.validationRules
+		if !rules.FestivalStart.IsZero() && p.StartTime.Before(rules.FestivalStart) {
+			v.add("startTime", validationOutOfRange, "must not be before the festival starts at "+rules.FestivalStart.Format(time.RFC3339))
+		}
+		if !rules.FestivalEnd.IsZero() && p.EndTime.After(rules.FestivalEnd) {
+			v.add("endTime", validationOutOfRange, "must not be after the festival ends at "+rules.FestivalEnd.Format(time.RFC3339))
+		}
+	}
+
+	return v.err()
+}
+
+// genres are compared the same way they're matched to the genres table, so "hip-hop" is allowed
+// when "Hip Hop" is
+func genreAllowed(genre string, allowed []string) bool {
+	for _, candidate := range allowed {
+		if genreKey(genre) == genreKey(candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+// checks p has a single line name and a usable email address
+func validatePerformer(p *Performer) error {
+	v := &validator{}
+
+	v.required("name", p.Name, maxPerformerNameLength)
+	if strings.ContainsFunc(p.Name, unicode.IsControl) {
+		v.add("name", validationInvalid, "cannot contain line breaks or other control characters")
+	}
+	v.required("email", p.Email, maxEmailLength)
+	if strings.TrimSpace(p.Email) != "" && !validEmail(p.Email) {
+		v.add("email", validationInvalid, "is not a valid email address")
+	}
+
+	return v.err()
+}
+
+// checks e has a name and, if both its times are set, that it ends after it starts
+func validateEdition(e *Edition) error {
+	v := &validator{}
+
+	v.required("name", e.Name, maxEditionNameLength)
+	if !e.StartTime.IsZero() && !e.EndTime.IsZero() && !e.EndTime.After(e.StartTime) {
+		v.add("endTime", validationInvalid, "must be after startTime")
+	}
+
+	return v.err()
+}
+
+// checks g has a name and that its aliases aren't too long
+func validateGenre(g *Genre) error {
+	v := &validator{}
+
+	v.required("name", g.Name, maxGenreNameLength)
+	if strings.TrimSpace(g.Name) != "" && genreKey(g.Name) == "" {
+		v.add("name", validationInvalid, "must contain a letter or digit")
+	}
+	for i, alias := range g.Aliases {
+		v.maxLength(fmt.Sprintf("aliases[%d]", i), alias, maxGenreNameLength)
+	}
+
+	return v.err()
+}
+
+// checks none of what a performer does in a performance is too long
+func validateJunctionDetails(d *JunctionDetails) error {
+	v := &validator{}
+
+	v.maxLength("role", d.Role, maxRoleLength)
+	v.maxLength("instrument", d.Instrument, maxInstrumentLength)
+	v.maxLength("notes", d.Notes, maxJunctionNotesLength)
+
+	return v.err()
+}
+
+// checks every input, piece of equipment and file on the rider is named and of a known kind, and
+// that no two inputs share a channel. r is expected to already be normalised
+func validateRider(r *TechRider) error {
+	v := &validator{}
+
+	channels := map[int]bool{}
+	for i, input := range r.Inputs {
+		field := fmt.Sprintf("inputs[%d]", i)
+		v.required(field+".name", input.Name, maxRiderItemLength)
+		v.maxLength(field+".notes", input.Notes, maxRiderNotesLength)
+		if !slices.Contains(riderInputKinds, input.Kind) {
+			v.add(field+".kind", validationNotAllowed, "must be one of "+strings.Join(riderInputKinds, ", "))
+		}
+		if input.Channel < 1 || input.Channel > maxRiderChannel {
+			v.add(field+".channel", validationOutOfRange, fmt.Sprintf("must be between 1 and %d", maxRiderChannel))
+		} else if channels[input.Channel] {
+			v.add(field+".channel", validationInvalid, "is already used by another input")
+		}
+		channels[input.Channel] = true
+	}
+
+	for i, e := range r.Equipment {
+		field := fmt.Sprintf("equipment[%d]", i)
+		v.required(field+".item", e.Item, maxRiderItemLength)
+		v.maxLength(field+".notes", e.Notes, maxRiderNotesLength)
+		if !slices.Contains(equipmentCategories, e.Category) {
+			v.add(field+".category", validationNotAllowed, "must be one of "+strings.Join(equipmentCategories, ", "))
+		}
+		if !slices.Contains(equipmentProviders, e.ProvidedBy) {
+			v.add(field+".providedBy", validationNotAllowed, "must be one of "+strings.Join(equipmentProviders, ", "))
+		}
+		if e.Quantity < 0 {
+			v.add(field+".quantity", validationInvalid, "cannot be negative")
+		}
+	}
+
+	for i, f := range r.Files {
+		field := fmt.Sprintf("files[%d]", i)
+		v.required(field+".name", f.Name, maxRiderItemLength)
+		if f.Url == "" {
+			v.add(field+".url", validationRequired, "cannot be blank")
+		} else if !validWebUrl(f.Url) {
+			v.add(field+".url", validationInvalid, "must be an http or https link")
+		}
+	}
+
+	v.maxLength("notes", r.Notes, maxRiderNotesLength)
+
+	return v.err()
+}
+
+// checks g has a name
+func validateGroup(g *Group) error {
+	v := &validator{}
+
+	v.required("name", g.Name, maxGroupNameLength)
+
+	return v.err()
+}
+
+// reports whether email is a bare address like someone@example.com, without a display name
+// or angle brackets
+func validEmail(email string) bool {
+	address, err := mail.ParseAddress(email)
+	return err == nil && address.Name == "" && address.Address == email
+}
+
+// reports whether link is an absolute http or https url, so the crew can open it
+func validWebUrl(link string) bool {
+	u, err := url.Parse(link)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// responds with a 422 listing the field errors if err is a ValidationError, and reports whether it did
+func (api *API) respondIfInvalid(w http.ResponseWriter, err error) bool {
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		return false
+	}
+
+	api.respondJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+		"error":  "Validation failed",
+		"fields": validationErr.Errors,
+	})
+	return true
+}
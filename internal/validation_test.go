@@ -0,0 +1,124 @@
+package internal_test
+
+import (
+	"encoding/json"
+	internal "foc_api/internal"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// decodes a 422 response into the field and code of each error
+func decodeFieldErrors(t *testing.T, w *httptest.ResponseRecorder) map[string]string {
+	var body struct {
+		Fields []*internal.FieldError `json:"fields"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&body), "Error decoding response from endpoint")
+
+	codes := map[string]string{}
+	for _, fieldErr := range body.Fields {
+		codes[fieldErr.Field] = fieldErr.Code
+	}
+	return codes
+}
+
+func TestCreatePerformanceReportsEveryInvalidField(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	api := internal.NewAPI(internal.CreateDBWrapper(db))
+
+	start := time.Date(2025, 9, 1, 18, 0, 0, 0, time.UTC)
+	body, _ := json.Marshal(&internal.Performance{
+		ItemName:  " ",
+		GroupName: strings.Repeat("x", 200),
+		StartTime: start,
+		EndTime:   start.Add(-time.Hour),
+	})
+	r := httptest.NewRequest("POST", "/performances", strings.NewReader(string(body)))
+	w := httptest.NewRecorder()
+
+	// act
+	api.PerformanceHandler(w, r)
+
+	// assert
+	require.Equal(t, http.StatusUnprocessableEntity, w.Code, "PerformanceHandler() returned status %v", w.Code)
+	assert.Equal(t, map[string]string{
+		"itemName":  "required",
+		"groupName": "too_long",
+		"endTime":   "invalid",
+	}, decodeFieldErrors(t, w))
+}
+
+func TestCreatePerformerRejectsInvalidEmail(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	api := internal.NewAPI(internal.CreateDBWrapper(db))
+
+	cases := []string{"", "not-an-email", "Someone <someone@example.com>", "someone@"}
+
+	for _, email := range cases {
+		r := httptest.NewRequest("POST", "/performers", strings.NewReader(`{"name": "Someone", "email": "`+email+`"}`))
+		w := httptest.NewRecorder()
+
+		// act
+		api.PerformerHandler(w, r)
+
+		// assert
+		require.Equal(t, http.StatusUnprocessableEntity, w.Code, "%q should be rejected", email)
+		assert.Contains(t, decodeFieldErrors(t, w), "email", "%q should be reported against email", email)
+	}
+}
+
+func TestCreatePerformerRejectsMultilineName(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	// act
+	_, err := dbw.CreatePerformer(&internal.Performer{Name: "X\r\nBEGIN:VEVENT", Email: "x@test.com"})
+
+	// assert
+	var validationErr *internal.ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, "name", validationErr.Errors[0].Field)
+}
+
+func TestValidationRulesLimitDatesAndGenres(t *testing.T) {
+	// arrange
+	db := setUpTestDB(t)
+	defer db.Close()
+	dbw := internal.CreateDBWrapper(db)
+
+	festivalStart := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	dbw.SetValidationRules(internal.ValidationRules{
+		FestivalStart: festivalStart,
+		FestivalEnd:   festivalStart.Add(72 * time.Hour),
+		AllowedGenres: []string{"Jazz", "Classical"},
+	})
+
+	inside := &internal.Performance{ItemName: "Take Five", GenreName: "jazz", StartTime: festivalStart.Add(time.Hour), EndTime: festivalStart.Add(2 * time.Hour)}
+	outside := &internal.Performance{ItemName: "Thunderstruck", GenreName: "Rock", StartTime: festivalStart.Add(-time.Hour), EndTime: festivalStart.Add(time.Hour)}
+
+	// act
+	_, insideErr := dbw.CreatePerformance(inside)
+	_, outsideErr := dbw.CreatePerformance(outside)
+
+	// assert
+	assert.NoError(t, insideErr, "Performance within the rules should be saved")
+
+	var validationErr *internal.ValidationError
+	require.ErrorAs(t, outsideErr, &validationErr)
+	fields := []string{}
+	for _, fieldErr := range validationErr.Errors {
+		fields = append(fields, fieldErr.Field+":"+fieldErr.Code)
+	}
+	assert.ElementsMatch(t, []string{"genreName:not_allowed", "startTime:out_of_range"}, fields)
+}